@@ -3,6 +3,8 @@ package arping
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"net"
 )
 
@@ -11,6 +13,15 @@ const (
 	responseOper = 2
 )
 
+// arpHeaderLen is the length of the fixed arp header - before the addresses
+const arpHeaderLen = 8
+
+// ErrInvalidArp is returned for frames, which aren't a valid arp datagram - such as truncated ones, see 'DecodeARP'
+var ErrInvalidArp = errors.New("invalid arp datagram")
+
+// minEthernetFrameSize is the minimum size of an ethernet frame - without the frame check sequence
+const minEthernetFrameSize = 60
+
 type arpDatagram struct {
 	htype uint16 // Hardware Type
 	ptype uint16 // Protocol Type
@@ -21,8 +32,15 @@ type arpDatagram struct {
 	spa   []byte // Sender protocol address, length from Plen
 	tha   []byte // Target hardware address, length from Hlen
 	tpa   []byte // Target protocol address, length from Plen
+
+	minFrameSize int    // minimum size of the ethernet frame - zero padded up to it, see 'WithMinFrameSize'
+	ethDst       []byte // destination of the ethernet frame - 'tha' if nil, see 'WithTargetMAC'
+	ethSrc       []byte // source of the received ethernet frame - nil for the sent datagrams
 }
 
+// newArpRequest returns a request from 'srcMac' / 'srcIP' for 'dstIP' - to 'dstMac'.
+// The v4 addresses are normalized per 'To4', so the 4 and 16 byte forms of 'net.IP' build the same datagram:
+// all matching compares the 4 byte addresses of the datagrams.
 func newArpRequest(
 	srcMac net.HardwareAddr,
 	srcIP net.IP,
@@ -57,42 +75,125 @@ func (datagram arpDatagram) Marshal() []byte {
 
 func (datagram arpDatagram) MarshalWithEthernetHeader() []byte {
 	// ethernet frame header
+	ethDst := datagram.ethDst
+	if ethDst == nil {
+		ethDst = datagram.tha
+	}
 	var ethernetHeader []byte
-	ethernetHeader = append(ethernetHeader, datagram.tha...)
+	ethernetHeader = append(ethernetHeader, ethDst...)
 	ethernetHeader = append(ethernetHeader, datagram.sha...)
 	ethernetHeader = append(ethernetHeader, []byte{0x08, 0x06}...) // arp
 
-	return append(ethernetHeader, datagram.Marshal()...)
+	frame := append(ethernetHeader, datagram.Marshal()...)
+
+	// zero padding
+	minFrameSize := datagram.minFrameSize
+	if minFrameSize < minEthernetFrameSize {
+		minFrameSize = minEthernetFrameSize
+	}
+	if len(frame) < minFrameSize {
+		frame = append(frame, make([]byte, minFrameSize-len(frame))...)
+	}
+	return frame
+}
+
+func (datagram arpDatagram) HardwareType() uint16 {
+	return datagram.htype
+}
+
+func (datagram arpDatagram) ProtocolType() uint16 {
+	return datagram.ptype
 }
 
 func (datagram arpDatagram) SenderIP() net.IP {
 	return net.IP(datagram.spa)
 }
+
+// SenderMac returns the sender hardware address of the arp payload - see 'EthSrcMac' for the ethernet source
 func (datagram arpDatagram) SenderMac() net.HardwareAddr {
 	return net.HardwareAddr(datagram.sha)
 }
 
+// EthSrcMac returns the source address of the ethernet header of a received datagram. It differs from
+// 'SenderMac', if a bridge or hypervisor rewrote one of both.
+func (datagram arpDatagram) EthSrcMac() net.HardwareAddr {
+	return net.HardwareAddr(datagram.ethSrc)
+}
+
+func (datagram arpDatagram) TargetIP() net.IP {
+	return net.IP(datagram.tpa)
+}
+
 func (datagram arpDatagram) IsResponseOf(request arpDatagram) bool {
 	return datagram.oper == responseOper && bytes.Equal(request.spa, datagram.tpa) &&
 		bytes.Equal(request.tpa, datagram.spa)
 }
 
-func parseArpDatagram(buffer []byte) arpDatagram {
-	var datagram arpDatagram
+// isSolicitedBy returns true if 'datagram' is a direct answer to 'request' - to its sender ip and hardware address
+func (datagram arpDatagram) isSolicitedBy(request arpDatagram) bool {
+	return datagram.IsResponseOf(request) && bytes.Equal(datagram.tha, request.sha)
+}
+
+// isAddressedTo returns true if 'datagram' is a reply to the sender of 'request' - whatever its sender ip
+func (datagram arpDatagram) isAddressedTo(request arpDatagram) bool {
+	return datagram.oper == responseOper && bytes.Equal(request.spa, datagram.tpa) && bytes.Equal(request.sha, datagram.tha)
+}
+
+// isFromTargetOf returns true if 'datagram' - request or reply - is sent from the target ip of 'request'
+func (datagram arpDatagram) isFromTargetOf(request arpDatagram) bool {
+	return len(request.tpa) > 0 && bytes.Equal(request.tpa, datagram.spa)
+}
+
+// isResponseTo returns true if 'datagram' is a response from the target of 'request' to one of 'localIPs'
+func (datagram arpDatagram) isResponseTo(request arpDatagram, localIPs []net.IP) bool {
+	if datagram.oper != responseOper || !bytes.Equal(request.tpa, datagram.spa) {
+		return false
+	}
+	for _, ip := range localIPs {
+		if bytes.Equal(ip.To4(), datagram.tpa) {
+			return true
+		}
+	}
+	return false
+}
+
+// isFromSenderOf returns true if 'datagram' comes from the hardware address which sent 'request'
+func (datagram arpDatagram) isFromSenderOf(request arpDatagram) bool {
+	return len(request.sha) > 0 && bytes.Equal(request.sha, datagram.sha)
+}
+
+// parseArpDatagram parses the arp datagram in 'buffer' - without the ethernet header.
+// Returns an error wrapping 'ErrInvalidArp' if 'buffer' is shorter than the addresses per 'hlen' and 'plen'.
+func parseArpDatagram(buffer []byte) (arpDatagram, error) {
+	if len(buffer) < arpHeaderLen {
+		return arpDatagram{}, fmt.Errorf("%w: %d bytes - shorter than the header", ErrInvalidArp, len(buffer))
+	}
 
-	b := bytes.NewBuffer(buffer)
-	binary.Read(b, binary.BigEndian, &datagram.htype)
-	binary.Read(b, binary.BigEndian, &datagram.ptype)
-	binary.Read(b, binary.BigEndian, &datagram.hlen)
-	binary.Read(b, binary.BigEndian, &datagram.plen)
-	binary.Read(b, binary.BigEndian, &datagram.oper)
+	datagram := arpDatagram{
+		htype: binary.BigEndian.Uint16(buffer[0:2]),
+		ptype: binary.BigEndian.Uint16(buffer[2:4]),
+		hlen:  buffer[4],
+		plen:  buffer[5],
+		oper:  binary.BigEndian.Uint16(buffer[6:8]),
+	}
 
 	haLen := int(datagram.hlen)
 	paLen := int(datagram.plen)
-	datagram.sha = b.Next(haLen)
-	datagram.spa = b.Next(paLen)
-	datagram.tha = b.Next(haLen)
-	datagram.tpa = b.Next(paLen)
+	if n := arpHeaderLen + 2*haLen + 2*paLen; len(buffer) < n {
+		return arpDatagram{}, fmt.Errorf("%w: %d bytes - %d expected per the address lengths: %d / %d",
+			ErrInvalidArp, len(buffer), n, haLen, paLen)
+	}
+
+	offset := arpHeaderLen
+	next := func(n int) []byte {
+		b := buffer[offset : offset+n : offset+n]
+		offset += n
+		return b
+	}
+	datagram.sha = next(haLen)
+	datagram.spa = next(paLen)
+	datagram.tha = next(haLen)
+	datagram.tpa = next(paLen)
 
-	return datagram
+	return datagram, nil
 }
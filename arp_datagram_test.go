@@ -0,0 +1,232 @@
+package arping
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// a standard arp reply from 02:00:00:00:00:01 / 192.168.1.1 to 02:00:00:00:00:02 / 192.168.1.2
+var arpReplyBytes = []byte{
+	0x00, 0x01, // hardware type: ethernet
+	0x08, 0x00, // protocol type: ipv4
+	0x06,       // hardware address length
+	0x04,       // protocol address length
+	0x00, 0x02, // operation: reply
+	0x02, 0x00, 0x00, 0x00, 0x00, 0x01,
+	192, 168, 1, 1,
+	0x02, 0x00, 0x00, 0x00, 0x00, 0x02,
+	192, 168, 1, 2,
+}
+
+func TestParseArpDatagram(t *testing.T) {
+	datagram, err := parseArpDatagram(arpReplyBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if datagram.HardwareType() != 1 {
+		t.Errorf("hardware type 1 expected, but got: %d", datagram.HardwareType())
+	}
+	if datagram.ProtocolType() != 0x0800 {
+		t.Errorf("protocol type 0x0800 expected, but got: %#04x", datagram.ProtocolType())
+	}
+	if datagram.SenderMac().String() != "02:00:00:00:00:01" {
+		t.Errorf("unexpected sender mac: %s", datagram.SenderMac())
+	}
+	if !datagram.SenderIP().Equal(net.ParseIP("192.168.1.1")) {
+		t.Errorf("unexpected sender ip: %s", datagram.SenderIP())
+	}
+	if !datagram.TargetIP().Equal(net.ParseIP("192.168.1.2")) {
+		t.Errorf("unexpected target ip: %s", datagram.TargetIP())
+	}
+}
+
+func TestResultContainsHardwareAndProtocolType(t *testing.T) {
+	datagram, err := parseArpDatagram(arpReplyBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := newResult(datagram, arpDatagram{}, 0, net.Interface{})
+
+	if result.HardwareType != 1 || result.ProtocolType != 0x0800 {
+		t.Errorf("hardware type 1 and protocol type 0x0800 expected, but got: %d, %#04x",
+			result.HardwareType, result.ProtocolType)
+	}
+}
+
+func TestMarshalWithEthernetHeaderPadding(t *testing.T) {
+	request := newArpRequest(net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}, net.ParseIP("192.168.1.1"),
+		BroadcastMAC(), net.ParseIP("192.168.1.2"))
+	if frame := request.MarshalWithEthernetHeader(); len(frame) != minEthernetFrameSize {
+		t.Errorf("frame padded to %d bytes expected, but got: %d", minEthernetFrameSize, len(frame))
+	}
+
+	request = newConfig([]Option{WithMinFrameSize(100)}).newArpRequest(request.sha, request.SenderIP(),
+		request.tha, request.TargetIP())
+	frame := request.MarshalWithEthernetHeader()
+	if len(frame) != 100 {
+		t.Fatalf("frame padded to 100 bytes expected, but got: %d", len(frame))
+	}
+	for i, b := range frame[14+28:] {
+		if b != 0 {
+			t.Fatalf("zero padding expected, but got: %#02x at offset %d", b, 14+28+i)
+		}
+	}
+	if parsed, err := parseArpDatagram(frame[14:]); err != nil || !parsed.TargetIP().Equal(net.ParseIP("192.168.1.2")) {
+		t.Errorf("padded frame not parseable - target ip: %s, err: %v", parsed.TargetIP(), err)
+	}
+}
+
+func TestParseArpDatagramRejectsTruncated(t *testing.T) {
+	// 8 byte hardware addresses, such as of captured tunnel traffic - but only 6 bytes each in the frame
+	long := append([]byte(nil), arpReplyBytes...)
+	long[4] = 8
+
+	for _, buffer := range [][]byte{nil, arpReplyBytes[:7], arpReplyBytes[:len(arpReplyBytes)-1], long} {
+		if _, err := parseArpDatagram(buffer); !errors.Is(err, ErrInvalidArp) {
+			t.Errorf("ErrInvalidArp expected for %d bytes, but got: %v", len(buffer), err)
+		}
+	}
+
+	long = append(long, 0, 0, 0, 0)
+	datagram, err := parseArpDatagram(long)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(datagram.SenderMac()) != 8 || len(datagram.tha) != 8 {
+		t.Errorf("8 byte hardware addresses expected, but got: %s / %x", datagram.SenderMac(), datagram.tha)
+	}
+}
+
+func TestRetryingSocketIgnoresInvalidArp(t *testing.T) {
+	sock := newFakeSocket(nil)
+	sock.receiveErrs = []error{ErrInvalidArp}
+	sock.inject(arpDatagram{oper: responseOper})
+
+	if _, _, err := (retryingSocket{sock}).receive(time.Now().Add(50 * time.Millisecond)); err != nil {
+		t.Errorf("invalid frame skipped expected, but got: %v", err)
+	}
+}
+
+func FuzzParseArpDatagram(f *testing.F) {
+	f.Add(arpReplyBytes)
+	f.Add(arpReplyBytes[:7])
+	f.Add([]byte{0x00, 0x01, 0x08, 0x00, 0xff, 0xff, 0x00, 0x02})
+	f.Fuzz(func(t *testing.T, buffer []byte) {
+		datagram, err := parseArpDatagram(buffer)
+		if err != nil {
+			return
+		}
+		// a parsed datagram marshals back to the parsed bytes
+		if marshaled := datagram.Marshal(); !bytes.Equal(marshaled, buffer[:len(marshaled)]) {
+			t.Errorf("%x marshaled to: %x", buffer, marshaled)
+		}
+	})
+}
+
+func TestTargetMAC(t *testing.T) {
+	srcMac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	zeroMac := make(net.HardwareAddr, 6)
+	// offset of the target hardware address within the frame
+	const thaOffset = 14 + 18
+
+	request := newConfig(nil).newArpRequest(srcMac, net.ParseIP("192.168.1.1"), BroadcastMAC(), net.ParseIP("192.168.1.2"))
+	frame := request.MarshalWithEthernetHeader()
+	if !bytes.Equal(frame[thaOffset:thaOffset+6], BroadcastMAC()) {
+		t.Errorf("request: broadcast target hardware address per default expected, but got: %x", frame[thaOffset:thaOffset+6])
+	}
+
+	request = newConfig([]Option{WithTargetMAC(zeroMac)}).newArpRequest(srcMac, net.ParseIP("192.168.1.1"),
+		BroadcastMAC(), net.ParseIP("192.168.1.2"))
+	frame = request.MarshalWithEthernetHeader()
+	if !bytes.Equal(frame[thaOffset:thaOffset+6], zeroMac) {
+		t.Errorf("request: zero target hardware address expected, but got: %x", frame[thaOffset:thaOffset+6])
+	}
+	if !bytes.Equal(frame[0:6], BroadcastMAC()) {
+		t.Errorf("request: broadcast ethernet destination expected, but got: %x", frame[0:6])
+	}
+
+	// an announcement with our own address as target - as in gratuitous replies
+	sock := newFakeSocket(nil)
+	useFakeSocket(t, sock)
+	if _, err := GratuitousArpNOverIfaceContext(context.Background(), net.ParseIP("127.0.0.2"), loopbackInterface(t),
+		1, 0, WithSourceMAC(srcMac), WithTargetMAC(srcMac)); err != nil {
+		t.Fatal(err)
+	}
+	sent := sock.sentDatagrams()
+	if len(sent) != 1 {
+		t.Fatalf("one announcement expected, but sent: %d", len(sent))
+	}
+	frame = sent[0].MarshalWithEthernetHeader()
+	if !bytes.Equal(frame[thaOffset:thaOffset+6], srcMac) || !bytes.Equal(frame[0:6], BroadcastMAC()) {
+		t.Errorf("announcement: target hardware address %s to broadcast expected, but got: %x to %x",
+			srcMac, frame[thaOffset:thaOffset+6], frame[0:6])
+	}
+}
+
+func TestFrameExceedingMTU(t *testing.T) {
+	useFakeSocket(t, newFakeSocket(nil))
+	iface := loopbackInterface(t)
+	iface.MTU = 100
+	dstIP := net.ParseIP("127.0.0.2")
+
+	// 114 bytes frame - 100 bytes payload
+	if _, err := PingOverIface(dstIP, iface, WithTimeout(10*time.Millisecond), WithMinFrameSize(114)); err != ErrTimeout {
+		t.Errorf("frame within the MTU: timeout expected, but got: %v", err)
+	}
+	if _, err := PingOverIface(dstIP, iface, WithTimeout(10*time.Millisecond), WithMinFrameSize(115)); err == nil ||
+		err == ErrTimeout {
+		t.Errorf("frame exceeding the MTU: error expected, but got: %v", err)
+	}
+	if err := GratuitousArpOverIface(dstIP, iface, WithMinFrameSize(200)); err == nil {
+		t.Error("announcement exceeding the MTU: error expected")
+	}
+}
+
+func TestNewArpRequestNormalizesIPs(t *testing.T) {
+	srcMac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x0a}
+	short := newArpRequest(srcMac, net.IP{10, 0, 0, 1}, BroadcastMAC(), net.IP{10, 0, 0, 2})
+	long := newArpRequest(srcMac, net.IPv4(10, 0, 0, 1), BroadcastMAC(), net.IPv4(10, 0, 0, 2))
+	if !bytes.Equal(short.MarshalWithEthernetHeader(), long.MarshalWithEthernetHeader()) {
+		t.Errorf("same frame expected for the 4 and 16 byte form, but got:\n% x\n% x",
+			short.MarshalWithEthernetHeader(), long.MarshalWithEthernetHeader())
+	}
+	if n := len(long.Marshal()); n != 28 {
+		t.Errorf("28 bytes arp datagram expected, but got: %d", n)
+	}
+}
+
+func TestPingWithBothIPForms(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	useFakeSocket(t, newFakeSocket(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{newArpReply(request, mac)}
+	}))
+	lo := loopbackInterface(t)
+
+	for _, srcIP := range []net.IP{{127, 0, 0, 1}, net.IPv4(127, 0, 0, 1)} {
+		for _, dstIP := range []net.IP{{127, 0, 0, 2}, net.IPv4(127, 0, 0, 2)} {
+			results, err := PingOverIface(dstIP, lo, WithTimeout(10*time.Millisecond), WithSourceIP(srcIP))
+			if err != nil {
+				t.Fatalf("%d byte source, %d byte target: %v", len(srcIP), len(dstIP), err)
+			}
+			if len(results) != 1 || !results[0].IP.Equal(dstIP) {
+				t.Errorf("%d byte source, %d byte target: one result expected, but got: %v", len(srcIP), len(dstIP), results)
+			}
+		}
+	}
+
+	dstIPs := []net.IP{{127, 0, 0, 2}, net.IPv4(127, 0, 0, 3)}
+	results, err := PingManyOverIfaceContext(context.Background(), dstIPs, lo, WithTimeout(10*time.Millisecond),
+		WithSourceIP(net.IPv4(127, 0, 0, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dstIP := range dstIPs {
+		if _, err := ResultFor(results, dstIP); err != nil {
+			t.Errorf("result for the %d byte form of '%s' expected, but got: %v", len(dstIP), dstIP, err)
+		}
+	}
+}
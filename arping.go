@@ -7,181 +7,698 @@
 package arping
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"os"
+	"sync/atomic"
 	"time"
 )
 
 var (
-	// ErrTimeout error
+	// ErrTimeout error - a single target operation, such as 'Ping', got no reply until its deadline.
+	// Batch operations, such as 'PingManyContext', don't return it - see 'ErrNoReply'.
 	ErrTimeout = errors.New("timeout")
 
+	// ErrNoReply error - a single target of a batch operation, such as 'PingManyContext', didn't reply.
+	// That's no failure of the batch - 'ResultFor' returns it for the missing targets.
+	ErrNoReply = errors.New("no reply")
+
+	// ErrIPv6NotSupported error - arp is v4 only, v6 uses the neighbor discovery protocol (NDP)
+	ErrIPv6NotSupported = errors.New("ipv6 is not supported - use the neighbor discovery protocol (NDP) for v6")
+
+	// ErrInsufficientPrivilege error - the raw socket was denied (EPERM / EACCES).
+	// The returned error wraps it together with the error of the system call.
+	ErrInsufficientPrivilege = errors.New("insufficient privilege for raw sockets - " +
+		"run as root, or under linux with the capability 'cap_net_raw+ep'")
+
+	// ErrMacMismatch error - a unicast ping got a reply from another hardware address than the pinged one,
+	// such as per spoofing - see 'PingUnicast'. The returned error wraps it with the details.
+	ErrMacMismatch = errors.New("reply from unexpected hardware address")
+
+	// ErrSourceMacMismatch error - the requests would be sent from another hardware address than the expected one
+	// - see 'VerifySourceMAC'
+	ErrSourceMacMismatch = errors.New("unexpected source hardware address")
+
+	// ErrInterfaceDown error - the interface is administratively down, or has no link - see 'CheckInterface'
+	ErrInterfaceDown = errors.New("interface is down")
+
+	// ErrNetworkTooLarge error - the network has a shorter prefix than 'MinCIDRPrefix', see 'CIDRHosts'
+	ErrNetworkTooLarge = errors.New("network too large")
+
+	// ErrUnsupportedInterface error - the interface has no arp, such as a loopback, point-to-point
+	// or non-ethernet interface - see 'CheckInterface'
+	ErrUnsupportedInterface = errors.New("interface doesn't support arp")
+
 	verboseLog = log.New(io.Discard, "", 0)
 	timeout    = time.Duration(500 * time.Millisecond)
 )
 
+// Result of a received arp reply
 type Result struct {
-	HwAddr   net.HardwareAddr
-	Duration time.Duration
+	// HwAddr is the sender hardware address of the arp reply - the mac of the answering host
+	HwAddr net.HardwareAddr
+	// EthSrcMac is the source address of the ethernet header of the reply - differs from 'HwAddr',
+	// if a bridge or hypervisor rewrote one of both
+	EthSrcMac net.HardwareAddr
+	Duration  time.Duration
+	// IP is the sender ip of the reply - the ip of the answering host
+	IP net.IP
+	// TargetIP is the target ip of the reply - differs from our sender ip in some NAT / proxy setups
+	TargetIP net.IP
+	// SourceIP is the sender ip of our request - see 'WithSourceIP' and 'WithSourceIPFallback'
+	SourceIP net.IP
+	// Iface is the name of the interface which received the reply
+	Iface string
+	// BridgePort is the name of the bridge port, which learned 'HwAddr' - per 'WithBridgePortReporting'
+	BridgePort string
+	// HardwareType of the reply - 1 for ethernet
+	HardwareType uint16
+	// ProtocolType of the reply - 0x0800 for ipv4
+	ProtocolType uint16
+	// Solicited is true if the reply is a direct answer to our request: a reply from the target ip
+	// to our sender ip and hardware address. False for replies accepted otherwise - such as unsolicited
+	// announcements per 'WithAcceptAnyFromTarget', or replies per 'WithAcceptedLocalIPs'.
+	Solicited bool
+	// ProbeIndex is the index of the probe, which the reply is attributed to - only set by 'PingN', starting at 0.
+	// See 'PingNOverIfaceContext' for the attribution per timing.
+	ProbeIndex int
+	// Duplicate is true if the probe per 'ProbeIndex' was already answered by an earlier reply - only set by 'PingN'.
+	// Replies attributed to different probes are delayed replies instead, with 'Duplicate' false.
+	Duplicate bool
+}
+
+func newResult(response, request arpDatagram, duration time.Duration, iface net.Interface) Result {
+	return Result{
+		HwAddr:    response.SenderMac(),
+		EthSrcMac: response.EthSrcMac(),
+		Duration:  duration,
+		IP:        response.SenderIP(),
+		TargetIP:  response.TargetIP(),
+		SourceIP:  request.SenderIP(),
+		Solicited: response.isSolicitedBy(request),
+		Iface:     iface.Name,
+
+		HardwareType: response.HardwareType(),
+		ProtocolType: response.ProtocolType(),
+	}
 }
 
 // Ping sends an arp ping to 'dstIP'
-func Ping(dstIP net.IP) ([]Result, error) {
+func Ping(dstIP net.IP, opts ...Option) ([]Result, error) {
+	return PingContext(context.Background(), dstIP, opts...)
+}
+
+// PingContext sends an arp ping to 'dstIP' - see 'PingOverIfaceContext' for the context handling
+func PingContext(ctx context.Context, dstIP net.IP, opts ...Option) ([]Result, error) {
 	if err := validateIP(dstIP); err != nil {
 		return nil, err
 	}
 
-	iface, err := findUsableInterfaceForNetwork(dstIP)
+	iface, err := findUsableInterfaceForNetwork(dstIP, newConfig(opts))
 	if err != nil {
 		return nil, err
 	}
-	return PingOverIface(dstIP, *iface)
+	return PingOverIfaceContext(ctx, dstIP, *iface, opts...)
 }
 
-// PingOverIfaceByName sends an arp ping over interface name 'ifaceName' to 'dstIP'
-func PingOverIfaceByName(dstIP net.IP, ifaceName string) ([]Result, error) {
+// PingOverIfaceByName sends an arp ping over interface name 'ifaceName' to 'dstIP'.
+//
+// VLAN subinterfaces, such as 'eth0.100', are supported - the kernel tags the frames.
+// Interfaces without an ethernet address, such as tunnels, require 'WithSourceMAC'.
+func PingOverIfaceByName(dstIP net.IP, ifaceName string, opts ...Option) ([]Result, error) {
+	return PingOverIfaceByNameContext(context.Background(), dstIP, ifaceName, opts...)
+}
+
+// PingOverIfaceByNameContext sends an arp ping over interface name 'ifaceName' to 'dstIP'
+// - see 'PingOverIfaceContext' for the context handling
+func PingOverIfaceByNameContext(ctx context.Context, dstIP net.IP, ifaceName string, opts ...Option) ([]Result, error) {
 	if err := validateIP(dstIP); err != nil {
 		return nil, err
 	}
 
-	iface, err := net.InterfaceByName(ifaceName)
+	iface, err := findInterfaceByName(ifaceName, newConfig(opts))
 	if err != nil {
 		return nil, err
 	}
-	return PingOverIface(dstIP, *iface)
+	return PingOverIfaceContext(ctx, dstIP, *iface, opts...)
 }
 
 // PingOverIface sends an arp ping over interface 'iface' to 'dstIP'
-func PingOverIface(dstIP net.IP, iface net.Interface) ([]Result, error) {
-	if err := validateIP(dstIP); err != nil {
-		return nil, err
-	}
+func PingOverIface(dstIP net.IP, iface net.Interface, opts ...Option) ([]Result, error) {
+	return PingOverIfaceContext(context.Background(), dstIP, iface, opts...)
+}
+
+// PingOverIfaceContext sends an arp ping over interface 'iface' to 'dstIP'
+//
+// Replies are collected until the effective deadline: the earlier one of the deadline
+// from 'ctx' and the timeout (see 'SetTimeout' and 'WithTimeout').
+// Returns 'ErrTimeout' if no reply was received until then, regardless which one of both expired.
+// If 'ctx' gets cancelled, the error from 'ctx' is returned.
+func PingOverIfaceContext(ctx context.Context, dstIP net.IP, iface net.Interface, opts ...Option) ([]Result, error) {
+	cfg := newConfig(opts)
 
-	srcMac := iface.HardwareAddr
-	srcIP, err := findIPInNetworkFromIface(dstIP, iface)
+	results := make([]Result, 0)
+	if cfg.maxResults > 0 {
+		// the results per 'WithMaxResults' fit without growing
+		results = make([]Result, 0, cfg.maxResults)
+	}
+	err := PingOverIfaceFuncContext(ctx, dstIP, iface, func(result Result) bool {
+		if cfg.storeResult(len(results)) {
+			results = append(results, result)
+		}
+		return true
+	}, opts...)
 	if err != nil {
 		return nil, err
 	}
+	if cfg.bridgePortReporting {
+		annotateBridgePorts(results, iface, cfg)
+	}
+	return results, nil
+}
 
-	broadcastMac := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
-	request := newArpRequest(srcMac, srcIP, broadcastMac, dstIP)
+// PingOverIfaceFunc sends an arp ping over interface 'iface' to 'dstIP' - see 'PingOverIfaceFuncContext'
+func PingOverIfaceFunc(dstIP net.IP, iface net.Interface, onReply func(Result) bool, opts ...Option) error {
+	return PingOverIfaceFuncContext(context.Background(), dstIP, iface, onReply, opts...)
+}
 
-	sock, err := initialize(iface)
+// PingOverIfaceFuncContext sends an arp ping over interface 'iface' to 'dstIP'
+// and calls 'onReply' the moment a reply is received - in the calling goroutine.
+//
+// When 'onReply' returns false, no further replies are collected and the call returns.
+// The deadline handling and errors are the same as in 'PingOverIfaceContext'.
+func PingOverIfaceFuncContext(ctx context.Context, dstIP net.IP, iface net.Interface, onReply func(Result) bool,
+	opts ...Option) error {
+	start := time.Now()
+	if err := validateIP(dstIP); err != nil {
+		return err
+	}
+	cfg := newConfig(opts)
+	if cfg.sourceIPFallback && cfg.sourceIP == nil && !cfg.zeroSource {
+		return pingWithSourceIPFallback(ctx, dstIP, iface, onReply, opts)
+	}
+
+	ctx, cancel := cfg.withDeadline(ctx)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+
+	srcIP, sock, err := openPingSocket(iface, dstIP, cfg)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
+	srcMac := cfg.srcMac(iface)
+	request := cfg.newArpRequest(srcMac, srcIP, cfg.dstMac(), dstIP)
+
 	type PingResult struct {
-		mac      net.HardwareAddr
-		duration time.Duration
-		err      error
+		result      Result
+		receiveTime time.Time
+		err         error
 	}
 	pingResultChan := make(chan PingResult)
-	running := true
+	// counted by the receiver
+	var ignored atomic.Int64
 
 	go func() {
 		defer sock.deinitialize()
-		// send arp request
-		verboseLog.Printf("arping '%s' over interface: '%s' with address: '%s'\n", dstIP, iface.Name, srcIP)
-		if sendTime, err := sock.send(request); err != nil {
-			pingResultChan <- PingResult{nil, 0, err}
-		} else {
-			for running {
-				// receive arp response
-				response, receiveTime, err := sock.receive()
-
-				if err != nil {
-					pingResultChan <- PingResult{nil, 0, err}
-					return
-				}
 
-				if response.IsResponseOf(request) {
-					duration := receiveTime.Sub(sendTime)
-					verboseLog.Printf("process received arp: srcIP: '%s', srcMac: '%s'\n",
-						response.SenderIP(), response.SenderMac())
-					pingResultChan <- PingResult{response.SenderMac(), duration, err}
-				}
+		// deliver returns false when nobody is waiting for results anymore
+		deliver := func(pingResult PingResult) bool {
+			select {
+			case pingResultChan <- pingResult:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		// send arp request
+		verboseLog.Printf("arping '%s' over interface: %s with address: '%s'\n", dstIP, ifaceFingerprint(iface, srcMac), srcIP)
+		sendTime, err := sock.send(request)
+		if err != nil {
+			deliver(PingResult{Result{}, time.Time{}, err})
+			return
+		}
+		cfg.emit(Event{Type: EventRequestSent, Time: sendTime, SourceIP: srcIP})
+
+		for {
+			// receive arp response
+			response, receiveTime, err := sock.receive(deadline)
+			if err != nil {
+				deliver(PingResult{Result{}, receiveTime, err})
+				return
+			}
 
-				verboseLog.Printf("ignore received arp: srcIP: '%s', srcMac: '%s'\n",
+			result := newResult(response, request, receiveTime.Sub(sendTime), iface)
+			if cfg.isResponse(response, request) {
+				cfg.emit(Event{Type: EventReplyReceived, Time: receiveTime, Result: &result, Matched: true})
+				verboseLog.Printf("process received arp: srcIP: '%s', srcMac: '%s'\n",
 					response.SenderIP(), response.SenderMac())
+				if !deliver(PingResult{result, receiveTime, nil}) {
+					return
+				}
+				continue
 			}
+
+			cfg.emit(Event{Type: EventReplyReceived, Time: receiveTime, Result: &result})
+			ignored.Add(1)
+			cfg.logIgnored(response)
 		}
 	}()
 
-	results := make([]Result, 0)
+	var stats Stats
+	var durations []time.Duration
+	defer func() {
+		stats.Socket = socketStatsOf(sock)
+		stats.Jitter = jitter(durations)
+		stats.Ignored = int(ignored.Load())
+		cfg.logFrameSummary(stats)
+		cfg.reportStats(stats)
+	}()
+
+	// fires when no further reply arrived within the quiet period - per 'WithQuietPeriod'
+	var quiet <-chan time.Time
 
 Break:
 	for {
 		select {
 		case pingResult := <-pingResultChan:
-			results = append(results, Result{HwAddr: pingResult.mac, Duration: pingResult.duration})
-		case <-time.After(timeout):
-			if len(results) == 0 {
-				return nil, ErrTimeout
+			if pingResult.err == ErrTimeout {
+				break Break
 			}
-
+			if pingResult.err != nil {
+				return pingResult.err
+			}
+			if cfg.isLate(pingResult.result.Duration) {
+				stats.Late++
+				continue
+			}
+			stats.Replies++
+			stats.firstReply(start, pingResult.receiveTime)
+			durations = append(durations, pingResult.result.Duration)
+			if !onReply(pingResult.result) {
+				break Break
+			}
+			if cfg.quietPeriod > 0 {
+				quiet = time.After(cfg.quietPeriod)
+			}
+		case <-quiet:
+			verboseLog.Printf("no further reply within the quiet period of %s\n", cfg.quietPeriod)
 			break Break
+		case <-ctx.Done():
+			break Break
+		}
+	}
+
+	if ctx.Err() == context.Canceled {
+		return ctx.Err()
+	}
+
+	if stats.Replies == 0 {
+		return ErrTimeout
+	}
+
+	return nil
+}
+
+// pingWithSourceIPFallback pings 'dstIP' from the source ip candidates of 'iface' - until one gets replied
+func pingWithSourceIPFallback(ctx context.Context, dstIP net.IP, iface net.Interface, onReply func(Result) bool,
+	opts []Option) error {
+	cfg := newConfig(opts)
+
+	var candidates []net.IP
+	err := inNetNS(cfg.netns, func() (err error) {
+		candidates, err = sourceIPCandidates(dstIP, iface)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, srcIP := range candidates {
+		err := PingOverIfaceFuncContext(ctx, dstIP, iface, onReply, appendOptions(opts, WithSourceIP(srcIP))...)
+		if err != ErrTimeout || ctx.Err() != nil {
+			return err
+		}
+		verboseLog.Printf("no reply to '%s' from address: '%s' - try the next one\n", dstIP, srcIP)
+	}
+	return ErrTimeout
+}
+
+// PingSync sends an arp ping over interface 'iface' to 'dstIP' - completely in the calling goroutine.
+//
+// In contrast to 'PingOverIface' it spawns no goroutines, which suits constrained environments,
+// and leaves nothing running after the return. The tradeoff: the blocking receive loop can't be cancelled
+// - the probe timeout bounds it, see 'WithProbeTimeout' and 'WithQuietPeriod' - and replies arriving
+// after the return, such as late duplicates, are never seen. Returns 'ErrTimeout' if no reply was received.
+func PingSync(dstIP net.IP, iface net.Interface, opts ...Option) ([]Result, error) {
+	start := time.Now()
+	if err := validateIP(dstIP); err != nil {
+		return nil, err
+	}
+	cfg := newConfig(opts)
+	deadline := cfg.probeDeadline()
+
+	srcIP, sock, err := openPingSocket(iface, dstIP, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer sock.deinitialize()
+
+	srcMac := cfg.srcMac(iface)
+	request := cfg.newArpRequest(srcMac, srcIP, cfg.dstMac(), dstIP)
+
+	var stats Stats
+	var durations []time.Duration
+	defer func() {
+		stats.Socket = socketStatsOf(sock)
+		stats.Jitter = jitter(durations)
+		cfg.logFrameSummary(stats)
+		cfg.reportStats(stats)
+	}()
+
+	verboseLog.Printf("arping '%s' over interface: %s with address: '%s'\n", dstIP, ifaceFingerprint(iface, srcMac), srcIP)
+	sendTime, err := sock.send(request)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, 0)
+	receiveDeadline := deadline
+	for {
+		response, receiveTime, err := sock.receive(receiveDeadline)
+		if err == ErrTimeout {
+			break
+		}
+		if err != nil {
+			return nil, err
 		}
+		if !cfg.isResponse(response, request) {
+			stats.Ignored++
+			cfg.logIgnored(response)
+			continue
+		}
+
+		verboseLog.Printf("process received arp: srcIP: '%s', srcMac: '%s'\n", response.SenderIP(), response.SenderMac())
+		duration := receiveTime.Sub(sendTime)
+		if cfg.isLate(duration) {
+			stats.Late++
+			continue
+		}
+		stats.Replies++
+		stats.firstReply(start, receiveTime)
+		durations = append(durations, duration)
+		if cfg.storeResult(len(results)) {
+			results = append(results, newResult(response, request, duration, iface))
+		}
+		if cfg.quietPeriod > 0 {
+			if quiet := receiveTime.Add(cfg.quietPeriod); quiet.Before(deadline) {
+				receiveDeadline = quiet
+			}
+		}
+	}
+
+	if stats.Replies == 0 {
+		return nil, ErrTimeout
 	}
+	return results, nil
+}
 
-	running = false
+// PingUnicast sends an arp ping over interface 'iface' to 'dstIP' - addressed to 'dstMac' instead of broadcasting it
+func PingUnicast(dstIP net.IP, dstMac net.HardwareAddr, iface net.Interface, opts ...Option) ([]Result, error) {
+	return PingUnicastContext(context.Background(), dstIP, dstMac, iface, opts...)
+}
 
+// PingUnicastContext sends an arp ping over interface 'iface' to 'dstIP' - addressed to 'dstMac'
+// - see 'PingOverIfaceContext' for the context handling.
+//
+// Every reply must come from 'dstMac': a reply from another hardware address fails the ping
+// with an error wrapping 'ErrMacMismatch' - as it's a spoofed reply or another host with the same ip.
+func PingUnicastContext(ctx context.Context, dstIP net.IP, dstMac net.HardwareAddr, iface net.Interface, opts ...Option) ([]Result, error) {
+	results, err := PingOverIfaceContext(ctx, dstIP, iface, appendOptions(opts, withUnicast(dstMac))...)
+	if err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		if !bytes.Equal(result.HwAddr, dstMac) {
+			return nil, fmt.Errorf("%w: '%s' replied from '%s' - expected '%s'", ErrMacMismatch, dstIP, result.HwAddr, dstMac)
+		}
+	}
 	return results, nil
 }
 
+// PingAnyInterface sends an arp ping to 'dstIP' over every interface, which is up and broadcast capable,
+// until one gets a reply. 'Result.Iface' reports the interface which got the reply.
+//
+// Useful when the auto-detect per 'Ping' picks the wrong interface - such as a disconnected NIC.
+func PingAnyInterface(dstIP net.IP, opts ...Option) ([]Result, error) {
+	if err := validateIP(dstIP); err != nil {
+		return nil, err
+	}
+
+	ifaces, err := findBroadcastInterfaces(newConfig(opts))
+	if err != nil {
+		return nil, err
+	}
+	return pingAnyInterface(dstIP, ifaces, opts)
+}
+
+func pingAnyInterface(dstIP net.IP, ifaces []net.Interface, opts []Option) ([]Result, error) {
+	lastErr := errors.New("no usable interface found")
+	for _, iface := range ifaces {
+		results, err := PingOverIface(dstIP, iface, opts...)
+		if err == nil {
+			return results, nil
+		}
+		verboseLog.Printf("arping '%s' over interface: '%s' failed: %s\n", dstIP, iface.Name, err)
+
+		// a timeout is more meaningful than an unreachable network from a later interface
+		if lastErr != ErrTimeout {
+			lastErr = err
+		}
+	}
+	return nil, lastErr
+}
+
+// openPingSocket finds the source ip and opens the socket to ping 'dstIP' over interface 'iface'
+func openPingSocket(iface net.Interface, dstIP net.IP, cfg *config) (srcIP net.IP, sock socket, err error) {
+	if err := cfg.checkMTU(iface); err != nil {
+		return nil, nil, err
+	}
+	err = inNetNS(cfg.netns, func() error {
+		if srcIP, err = cfg.srcIP(dstIP, iface); err != nil {
+			return err
+		}
+		sock, err = openSocket(iface, cfg)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cfg.targetFilter && !cfg.acceptAnyFromTarget && !cfg.matchByMACOnly {
+		if err := sock.setSenderFilter(dstIP); err != nil {
+			sock.deinitialize()
+			return nil, nil, err
+		}
+	}
+	cfg.emit(Event{Type: EventSourceIPSelected, Time: time.Now(), SourceIP: srcIP})
+	return srcIP, sock, nil
+}
+
 // GratuitousArp sends an gratuitous arp from 'srcIP'
-func GratuitousArp(srcIP net.IP) error {
+func GratuitousArp(srcIP net.IP, opts ...Option) error {
 	if err := validateIP(srcIP); err != nil {
 		return err
 	}
 
-	iface, err := findUsableInterfaceForNetwork(srcIP)
+	iface, err := findUsableInterfaceForNetwork(srcIP, newConfig(opts))
 	if err != nil {
 		return err
 	}
-	return GratuitousArpOverIface(srcIP, *iface)
+	return GratuitousArpOverIface(srcIP, *iface, opts...)
 }
 
 // GratuitousArpOverIfaceByName sends an gratuitous arp over interface name 'ifaceName' from 'srcIP'
-func GratuitousArpOverIfaceByName(srcIP net.IP, ifaceName string) error {
+func GratuitousArpOverIfaceByName(srcIP net.IP, ifaceName string, opts ...Option) error {
 	if err := validateIP(srcIP); err != nil {
 		return err
 	}
 
-	iface, err := net.InterfaceByName(ifaceName)
+	iface, err := findInterfaceByName(ifaceName, newConfig(opts))
 	if err != nil {
 		return err
 	}
-	return GratuitousArpOverIface(srcIP, *iface)
+	return GratuitousArpOverIface(srcIP, *iface, opts...)
 }
 
 // GratuitousArpOverIface sends an gratuitous arp over interface 'iface' from 'srcIP'
-func GratuitousArpOverIface(srcIP net.IP, iface net.Interface) error {
-	if err := validateIP(srcIP); err != nil {
+func GratuitousArpOverIface(srcIP net.IP, iface net.Interface, opts ...Option) error {
+	_, err := GratuitousArpNOverIfaceContext(context.Background(), srcIP, iface, 1, 0, opts...)
+	return err
+}
+
+// GratuitousArpAllAddresses sends a gratuitous arp over interface 'iface' from every v4 address of it
+// - such as from all VIPs on a failover.
+//
+// A failed announcement doesn't stop the others. The returned error joins the errors per failed address.
+func GratuitousArpAllAddresses(iface net.Interface, opts ...Option) error {
+	cfg := newConfig(opts)
+
+	var ips []net.IP
+	err := inNetNS(cfg.netns, func() (err error) {
+		ips, _, err = LocalAddresses(iface)
+		return err
+	})
+	if err != nil {
 		return err
 	}
+	if len(ips) == 0 {
+		return fmt.Errorf("interface '%s' has no v4 address", iface.Name)
+	}
 
-	srcMac := iface.HardwareAddr
-	broadcastMac := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
-	request := newArpRequest(srcMac, srcIP, broadcastMac, srcIP)
+	var errs []error
+	for _, ip := range ips {
+		if err := GratuitousArpOverIface(ip, iface, opts...); err != nil {
+			errs = append(errs, fmt.Errorf("ip: '%s': %w", ip, err))
+		}
+	}
+	return errors.Join(errs...)
+}
 
-	sock, err := initialize(iface)
+// GratuitousArpN sends 'count' gratuitous arps from 'srcIP' - with 'interval' between them.
+// Returns the number of sent arps.
+func GratuitousArpN(srcIP net.IP, count int, interval time.Duration, opts ...Option) (int, error) {
+	return GratuitousArpNContext(context.Background(), srcIP, count, interval, opts...)
+}
+
+// GratuitousArpNContext sends 'count' gratuitous arps from 'srcIP' - with 'interval' between them.
+// Returns the number of sent arps - if 'ctx' gets cancelled, the number sent until then and the error from 'ctx'.
+func GratuitousArpNContext(ctx context.Context, srcIP net.IP, count int, interval time.Duration, opts ...Option) (int, error) {
+	if err := validateIP(srcIP); err != nil {
+		return 0, err
+	}
+
+	iface, err := findUsableInterfaceForNetwork(srcIP, newConfig(opts))
 	if err != nil {
+		return 0, err
+	}
+	return GratuitousArpNOverIfaceContext(ctx, srcIP, *iface, count, interval, opts...)
+}
+
+// GratuitousArpNOverIfaceContext sends 'count' gratuitous arps over interface 'iface' from 'srcIP'
+// - see 'GratuitousArpNContext'
+func GratuitousArpNOverIfaceContext(ctx context.Context, srcIP net.IP, iface net.Interface, count int,
+	interval time.Duration, opts ...Option) (int, error) {
+	if err := validateIP(srcIP); err != nil {
+		return 0, err
+	}
+	cfg := newConfig(opts)
+
+	ctx, cancel := cfg.withOverallDeadline(ctx)
+	defer cancel()
+
+	if err := cfg.checkMTU(iface); err != nil {
+		return 0, err
+	}
+	srcMac := cfg.srcMac(iface)
+	request := cfg.newArpRequest(srcMac, srcIP, BroadcastMAC(), srcIP)
+
+	var sock socket
+	err := inNetNS(cfg.netns, func() (err error) {
+		sock, err = openSocket(iface, cfg)
 		return err
+	})
+	if err != nil {
+		return 0, err
 	}
 	defer sock.deinitialize()
-	verboseLog.Printf("gratuitous arp over interface: '%s' with address: '%s'\n", iface.Name, srcIP)
-	_, err = sock.send(request)
-	return err
+
+	if cfg.confirmations != nil {
+		stop := make(chan struct{})
+		done := make(chan []net.HardwareAddr)
+		go func() {
+			done <- receiveConfirmations(sock, srcIP, srcMac, stop)
+		}()
+		defer func() {
+			close(stop)
+			*cfg.confirmations = <-done
+		}()
+	}
+
+	sent := 0
+	for sent < count {
+		if sent > 0 {
+			select {
+			case <-time.After(interval):
+			case <-ctx.Done():
+				return sent, ctx.Err()
+			}
+		} else if err := ctx.Err(); err != nil {
+			return sent, err
+		}
+
+		verboseLog.Printf("gratuitous arp over interface: %s with address: '%s'\n", ifaceFingerprint(iface, srcMac), srcIP)
+		if _, err := sock.send(request); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+
+	if cfg.confirmations != nil {
+		select {
+		case <-time.After(cfg.confirmationWindow):
+		case <-ctx.Done():
+		}
+	}
+	return sent, nil
+}
+
+// receiveConfirmations returns the hardware addresses of the hosts, which sent an arp request for 'srcIP'
+// - until 'stop' gets closed. Our own requests from 'srcMac' are skipped.
+func receiveConfirmations(sock socket, srcIP net.IP, srcMac net.HardwareAddr, stop <-chan struct{}) []net.HardwareAddr {
+	var macs []net.HardwareAddr
+	seen := make(map[string]bool)
+	for {
+		select {
+		case <-stop:
+			return macs
+		default:
+		}
+
+		request, _, err := sock.receive(time.Now().Add(pollInterval))
+		if err != nil {
+			if err != ErrTimeout {
+				verboseLog.Printf("unable to receive the confirmations: %s\n", err)
+			}
+			continue
+		}
+		if request.oper != requestOper || !request.TargetIP().Equal(srcIP) || request.SenderIP().Equal(srcIP) ||
+			bytes.Equal(request.sha, srcMac) || seen[request.SenderMac().String()] {
+			continue
+		}
+		verboseLog.Printf("announcement confirmed per request from: '%s' (%s)\n", request.SenderIP(), request.SenderMac())
+		seen[request.SenderMac().String()] = true
+		macs = append(macs, request.SenderMac())
+	}
 }
 
 // EnableVerboseLog enables verbose logging on stdout
 func EnableVerboseLog() {
-	verboseLog = log.New(os.Stdout, "", 0)
+	SetVerboseOutput(os.Stdout)
+}
+
+// SetVerboseOutput enables verbose logging on 'w' - 'nil' disables verbose logging
+func SetVerboseOutput(w io.Writer) {
+	if w == nil {
+		w = io.Discard
+	}
+	verboseLog.SetOutput(w)
 }
 
 // SetTimeout sets ping timeout
@@ -191,6 +708,9 @@ func SetTimeout(t time.Duration) {
 
 func validateIP(ip net.IP) error {
 	// ip must be a valid V4 address
+	if ip.To4() == nil && len(ip) == net.IPv6len {
+		return fmt.Errorf("not a valid v4 Address: %s: %w", ip, ErrIPv6NotSupported)
+	}
 	if len(ip.To4()) != net.IPv4len {
 		return fmt.Errorf("not a valid v4 Address: %s", ip)
 	}
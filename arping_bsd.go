@@ -1,8 +1,10 @@
+//go:build darwin || freebsd || openbsd
 // +build darwin freebsd openbsd
 
 package arping
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"net"
@@ -13,73 +15,129 @@ import (
 )
 
 type BsdSocket struct {
-	bpf    *os.File
-	bpfFd  int
-	buflen int
+	bpf      *os.File
+	bpfFd    int
+	buflen   int
+	external bool
+	// drops is the drop counter of the last 'kernelDrops' call
+	drops uint32
 }
 
-var bpfArpFilter = []syscall.BpfInsn{
-	// make sure this is an arp packet
-	*syscall.BpfStmt(syscall.BPF_LD+syscall.BPF_H+syscall.BPF_ABS, 12),
-	*syscall.BpfJump(syscall.BPF_JMP+syscall.BPF_JEQ+syscall.BPF_K, 0x0806, 0, 1),
-	// if we passed all the tests, ask for the whole packet.
-	*syscall.BpfStmt(syscall.BPF_RET+syscall.BPF_K, -1),
-	// otherwise, drop it.
-	*syscall.BpfStmt(syscall.BPF_RET+syscall.BPF_K, 0),
+// bpfProtoFilter returns the filter for the frames of ether type 'ethProto' - all frames for 'EthPAll'
+func bpfProtoFilter(ethProto uint16) []syscall.BpfInsn {
+	if ethProto == EthPAll {
+		return []syscall.BpfInsn{*syscall.BpfStmt(syscall.BPF_RET+syscall.BPF_K, -1)}
+	}
+	return []syscall.BpfInsn{
+		// make sure this is a packet of 'ethProto' - arp per default
+		*syscall.BpfStmt(syscall.BPF_LD+syscall.BPF_H+syscall.BPF_ABS, 12),
+		*syscall.BpfJump(syscall.BPF_JMP+syscall.BPF_JEQ+syscall.BPF_K, int(ethProto), 0, 1),
+		// if we passed all the tests, ask for the whole packet.
+		*syscall.BpfStmt(syscall.BPF_RET+syscall.BPF_K, -1),
+		// otherwise, drop it.
+		*syscall.BpfStmt(syscall.BPF_RET+syscall.BPF_K, 0),
+	}
 }
 
-func initialize(iface net.Interface) (s *BsdSocket, err error) {
+func initialize(iface net.Interface, cfg *config) (s *BsdSocket, err error) {
 	s = &BsdSocket{}
-	verboseLog.Println("search available /dev/bpfX")
-	for i := 0; i <= 10; i++ {
-		bpfPath := fmt.Sprintf("/dev/bpf%d", i)
-		s.bpf, err = os.OpenFile(bpfPath, os.O_RDWR, 0666)
-		if err != nil {
-			verboseLog.Printf("  open failed: %s - %s\n", bpfPath, err.Error())
-		} else {
-			verboseLog.Printf("  open success: %s\n", bpfPath)
-			break
+	if cfg.socketFD >= 0 {
+		s.bpfFd = cfg.socketFD
+		s.external = true
+	} else {
+		verboseLog.Println("search available /dev/bpfX")
+		var openErr error
+		for i := 0; i <= 10; i++ {
+			bpfPath := fmt.Sprintf("/dev/bpf%d", i)
+			s.bpf, err = os.OpenFile(bpfPath, os.O_RDWR, 0666)
+			if err != nil {
+				verboseLog.Printf("  open failed: %s - %s\n", bpfPath, err.Error())
+				if openErr == nil || errors.Is(err, os.ErrPermission) {
+					// the permission error tells the most - the others are busy devices
+					openErr = err
+				}
+			} else {
+				verboseLog.Printf("  open success: %s\n", bpfPath)
+				break
+			}
+		}
+		s.bpfFd = int(s.bpf.Fd())
+		if s.bpfFd == -1 {
+			return s, fmt.Errorf("unable to open /dev/bpfX: %w", openErr)
 		}
 	}
-	s.bpfFd = int(s.bpf.Fd())
-	if s.bpfFd == -1 {
-		return s, errors.New("unable to open /dev/bpfX")
+
+	if !s.external {
+		// an external device is configured by the caller
+		if err := configureBpf(s.bpfFd, iface, cfg); err != nil {
+			return s, err
+		}
 	}
 
-	if err := syscall.SetBpfInterface(s.bpfFd, iface.Name); err != nil {
+	s.buflen, err = syscall.BpfBuflen(s.bpfFd)
+	if err != nil {
 		return s, err
 	}
 
-	if err := syscall.SetBpfImmediate(s.bpfFd, 1); err != nil {
-		return s, err
+	// count the drops from now on - an external device may have dropped already
+	if st, err := syscall.BpfStats(s.bpfFd); err == nil {
+		s.drops = st.Drop
 	}
 
-	s.buflen, err = syscall.BpfBuflen(s.bpfFd)
-	if err != nil {
-		return s, err
+	return s, nil
+}
+
+// configureBpf binds the device 'fd' to 'iface' and filters the frames of the configured protocol
+func configureBpf(fd int, iface net.Interface, cfg *config) error {
+	if err := syscall.SetBpfInterface(fd, iface.Name); err != nil {
+		return err
 	}
 
-	if err := syscall.SetBpf(s.bpfFd, bpfArpFilter); err != nil {
-		return s, err
+	if err := syscall.SetBpfImmediate(fd, 1); err != nil {
+		return err
 	}
 
-	if err := syscall.FlushBpf(s.bpfFd); err != nil {
-		return s, err
+	if cfg.excludeOutgoing {
+		if err := excludeSentFrames(fd); err != nil {
+			return fmt.Errorf("unable to exclude the outgoing frames: %w", err)
+		}
 	}
 
-	return s, nil
+	if err := syscall.SetBpf(fd, bpfProtoFilter(cfg.socketProto())); err != nil {
+		return err
+	}
+
+	// drop packets which are already buffered
+	return syscall.FlushBpf(fd)
 }
 
-func (s *BsdSocket) send(request arpDatagram) (time.Time, error) {
-	_, err := syscall.Write(s.bpfFd, request.MarshalWithEthernetHeader())
+func (s *BsdSocket) sendFrame(frame []byte) (time.Time, error) {
+	_, err := syscall.Write(s.bpfFd, frame)
 	return time.Now(), err
 }
 
-func (s *BsdSocket) receive() (arpDatagram, time.Time, error) {
+func (s *BsdSocket) receiveFrame(deadline time.Time) ([]byte, time.Time, error) {
+	bpfTimeout := time.Until(deadline)
+	if bpfTimeout <= 0 {
+		return nil, time.Now(), ErrTimeout
+	}
+	t := syscall.NsecToTimeval(bpfTimeout.Nanoseconds())
+	if t.Sec == 0 && t.Usec == 0 {
+		// a zero timeval disables the timeout
+		t.Usec = 1
+	}
+	if err := syscall.SetBpfTimeout(s.bpfFd, &t); err != nil {
+		return nil, time.Now(), err
+	}
+
 	buffer := make([]byte, s.buflen)
 	n, err := syscall.Read(s.bpfFd, buffer)
+	if err == syscall.EAGAIN || (err == nil && n == 0) {
+		// read timeout expired
+		return nil, time.Now(), ErrTimeout
+	}
 	if err != nil {
-		return arpDatagram{}, time.Now(), err
+		return nil, time.Now(), err
 	}
 
 	//
@@ -93,17 +151,51 @@ func (s *BsdSocket) receive() (arpDatagram, time.Time, error) {
 		bpfHdrLength = 18
 	}
 
-	// skip bpf header + 14 bytes ethernet header
-	var hdrLength = bpfHdrLength + 14
+	if n <= bpfHdrLength {
+		// amount of bytes read by socket is less than the bpf header. clearly not what we look for
+		return nil, time.Now(), fmt.Errorf("%w: buffer with invalid length", ErrInvalidArp)
 
-	if n <= hdrLength || len(buffer) <= hdrLength {
-		// amount of bytes read by socket is less than an ethernet header. clearly not what we look for
-		return arpDatagram{}, time.Now(), fmt.Errorf("buffer with invalid length")
+	}
+	// skip bpf header
+	return buffer[bpfHdrLength:n], time.Now(), nil
+}
+
+func (s *BsdSocket) setSenderFilter(ip net.IP) error {
+	filter := []syscall.BpfInsn{
+		// make sure this is an arp packet
+		*syscall.BpfStmt(syscall.BPF_LD+syscall.BPF_H+syscall.BPF_ABS, 12),
+		*syscall.BpfJump(syscall.BPF_JMP+syscall.BPF_JEQ+syscall.BPF_K, 0x0806, 0, 5),
+		// make sure this is an arp reply
+		*syscall.BpfStmt(syscall.BPF_LD+syscall.BPF_H+syscall.BPF_ABS, 20),
+		*syscall.BpfJump(syscall.BPF_JMP+syscall.BPF_JEQ+syscall.BPF_K, responseOper, 0, 3),
+		// make sure the reply comes from 'ip'
+		*syscall.BpfStmt(syscall.BPF_LD+syscall.BPF_W+syscall.BPF_ABS, 28),
+		*syscall.BpfJump(syscall.BPF_JMP+syscall.BPF_JEQ+syscall.BPF_K, int(binary.BigEndian.Uint32(ip.To4())), 0, 1),
+		// if we passed all the tests, ask for the whole packet.
+		*syscall.BpfStmt(syscall.BPF_RET+syscall.BPF_K, -1),
+		// otherwise, drop it.
+		*syscall.BpfStmt(syscall.BPF_RET+syscall.BPF_K, 0),
+	}
+	if err := syscall.SetBpf(s.bpfFd, filter); err != nil {
+		return err
+	}
+	// drop packets which are already buffered
+	return syscall.FlushBpf(s.bpfFd)
+}
 
+func (s *BsdSocket) kernelDrops() (int, error) {
+	st, err := syscall.BpfStats(s.bpfFd)
+	if err != nil {
+		return 0, err
 	}
-	return parseArpDatagram(buffer[hdrLength:n]), time.Now(), nil
+	drops := st.Drop - s.drops
+	s.drops = st.Drop
+	return int(drops), nil
 }
 
 func (s *BsdSocket) deinitialize() error {
+	if s.external {
+		return nil
+	}
 	return s.bpf.Close()
 }
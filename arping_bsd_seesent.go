@@ -0,0 +1,18 @@
+//go:build darwin || freebsd
+
+package arping
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// excludeSentFrames stops the bpf device 'fd' from seeing the frames sent by this host - see 'WithExcludeOutgoing'
+func excludeSentFrames(fd int) error {
+	seesent := uint32(0)
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.BIOCSSEESENT, uintptr(unsafe.Pointer(&seesent)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
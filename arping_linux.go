@@ -1,6 +1,7 @@
 package arping
 
 import (
+	"encoding/binary"
 	"fmt"
 	"net"
 	"syscall"
@@ -10,43 +11,131 @@ import (
 type LinuxSocket struct {
 	sock       int
 	toSockaddr syscall.SockaddrLinklayer
+	external   bool
+	// excludeOutgoing drops the frames sent by this host - see 'WithExcludeOutgoing'
+	excludeOutgoing bool
+	// sendTimeout is the timeout per 'WithTimeout' - a send blocks at most that long
+	sendTimeout time.Duration
 }
 
-func initialize(iface net.Interface) (s *LinuxSocket, err error) {
-	s = &LinuxSocket{}
+func initialize(iface net.Interface, cfg *config) (s *LinuxSocket, err error) {
+	s = &LinuxSocket{excludeOutgoing: cfg.excludeOutgoing, sendTimeout: cfg.timeout}
 	s.toSockaddr = syscall.SockaddrLinklayer{Ifindex: iface.Index}
 
-	// 1544 = htons(ETH_P_ARP)
-	const proto = 1544
+	if cfg.socketFD >= 0 {
+		s.sock = cfg.socketFD
+		s.external = true
+		return s, nil
+	}
+
+	// per default: 1544 = htons(ETH_P_ARP)
+	proto := int(htons(cfg.socketProto()))
 	s.sock, err = syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, proto)
-	return s, err
+	if err != nil {
+		return s, err
+	}
+
+	// receive only frames from 'iface': for a packet socket, bind() to the ifindex makes the kernel deliver only
+	// the frames of that device - the same effect as 'SO_BINDTODEVICE', but resolved per index like the sends,
+	// and it sets the protocol as well. Until the bind, the socket receives from all devices - the frames queued
+	// meanwhile get drained below.
+	if err := syscall.Bind(s.sock, &syscall.SockaddrLinklayer{Protocol: uint16(proto), Ifindex: iface.Index}); err != nil {
+		syscall.Close(s.sock)
+		return s, fmt.Errorf("unable to bind socket to interface '%s': %w", iface.Name, err)
+	}
+	if err := s.drain(); err != nil {
+		syscall.Close(s.sock)
+		return s, err
+	}
+	return s, nil
+}
+
+// drain drops the frames queued before the bind - they may come from any interface
+func (s *LinuxSocket) drain() error {
+	buffer := make([]byte, maxEthernetFrameSize)
+	for {
+		_, _, err := syscall.Recvfrom(s.sock, buffer, syscall.MSG_DONTWAIT)
+		if err == syscall.EAGAIN || err == syscall.EWOULDBLOCK {
+			return nil
+		}
+		if err != nil && err != syscall.EINTR {
+			return fmt.Errorf("unable to drain socket: %w", err)
+		}
+	}
 }
 
-func (s *LinuxSocket) send(request arpDatagram) (time.Time, error) {
-	socketTimeout := timeout.Nanoseconds()
-	t := syscall.NsecToTimeval(socketTimeout)
+func (s *LinuxSocket) sendFrame(frame []byte) (time.Time, error) {
+	t := syscall.NsecToTimeval(s.sendTimeout.Nanoseconds())
 	syscall.SetsockoptTimeval(s.sock, syscall.SOL_SOCKET, syscall.SO_SNDTIMEO, &t)
-	return time.Now(), syscall.Sendto(s.sock, request.MarshalWithEthernetHeader(), 0, &s.toSockaddr)
+	return time.Now(), syscall.Sendto(s.sock, frame, 0, &s.toSockaddr)
 }
 
-func (s *LinuxSocket) receive() (arpDatagram, time.Time, error) {
-	buffer := make([]byte, 128)
-	socketTimeout := timeout.Nanoseconds()
-	t := syscall.NsecToTimeval(socketTimeout)
-	syscall.SetsockoptTimeval(s.sock, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &t)
-	n, _, err := syscall.Recvfrom(s.sock, buffer, 0)
-	if err != nil {
-		return arpDatagram{}, time.Now(), err
+func (s *LinuxSocket) receiveFrame(deadline time.Time) ([]byte, time.Time, error) {
+	buffer := make([]byte, maxEthernetFrameSize)
+	for {
+		socketTimeout := time.Until(deadline)
+		if socketTimeout <= 0 {
+			return nil, time.Now(), ErrTimeout
+		}
+		t := syscall.NsecToTimeval(socketTimeout.Nanoseconds())
+		if t.Sec == 0 && t.Usec == 0 {
+			// a zero timeval disables the timeout
+			t.Usec = 1
+		}
+		syscall.SetsockoptTimeval(s.sock, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &t)
+		n, from, err := syscall.Recvfrom(s.sock, buffer, 0)
+		if err == syscall.EAGAIN {
+			return nil, time.Now(), ErrTimeout
+		}
+		if err != nil {
+			return nil, time.Now(), err
+		}
+		if sa, ok := from.(*syscall.SockaddrLinklayer); ok && s.excludeOutgoing && sa.Pkttype == syscall.PACKET_OUTGOING {
+			continue
+		}
+		return buffer[:n], time.Now(), nil
 	}
-	if n <= 14 {
-		// amount of bytes read by socket is less than an ethernet header. clearly not what we look for
-		return arpDatagram{}, time.Now(), fmt.Errorf("buffer with invalid length")
+}
+
+func (s *LinuxSocket) setSenderFilter(ip net.IP) error {
+	// offsets are relative to the ethernet frame start
+	return syscall.AttachLsf(s.sock, []syscall.SockFilter{
+		// make sure this is an arp packet
+		*syscall.LsfStmt(syscall.BPF_LD+syscall.BPF_H+syscall.BPF_ABS, 12),
+		*syscall.LsfJump(syscall.BPF_JMP+syscall.BPF_JEQ+syscall.BPF_K, 0x0806, 0, 5),
+		// make sure this is an arp reply
+		*syscall.LsfStmt(syscall.BPF_LD+syscall.BPF_H+syscall.BPF_ABS, 20),
+		*syscall.LsfJump(syscall.BPF_JMP+syscall.BPF_JEQ+syscall.BPF_K, responseOper, 0, 3),
+		// make sure the reply comes from 'ip'
+		*syscall.LsfStmt(syscall.BPF_LD+syscall.BPF_W+syscall.BPF_ABS, 28),
+		*syscall.LsfJump(syscall.BPF_JMP+syscall.BPF_JEQ+syscall.BPF_K, int(binary.BigEndian.Uint32(ip.To4())), 0, 1),
+		// if we passed all the tests, ask for the whole packet.
+		*syscall.LsfStmt(syscall.BPF_RET+syscall.BPF_K, -1),
+		// otherwise, drop it.
+		*syscall.LsfStmt(syscall.BPF_RET+syscall.BPF_K, 0),
+	})
+}
 
+func (s *LinuxSocket) kernelDrops() (int, error) {
+	// struct tpacket_stats { tp_packets, tp_drops uint32 } - the syscall package has no getter for it,
+	// but 'GetsockoptIPMreq' reads the same 8 bytes. The kernel resets the counters per read.
+	st, err := syscall.GetsockoptIPMreq(s.sock, syscall.SOL_PACKET, syscall.PACKET_STATISTICS)
+	if err != nil {
+		return 0, err
 	}
-	// skip 14 bytes ethernet header
-	return parseArpDatagram(buffer[14:n]), time.Now(), nil
+	return int(nativeEndian.Uint32(st.Interface[:])), nil
 }
 
 func (s *LinuxSocket) deinitialize() error {
+	if s.external {
+		return nil
+	}
 	return syscall.Close(s.sock)
 }
+
+// htons converts 'v' to network byte order
+func htons(v uint16) uint16 {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], v)
+	return nativeEndian.Uint16(b[:])
+}
@@ -0,0 +1,40 @@
+package arping
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestInitializeBindsToInterface(t *testing.T) {
+	lo := loopbackInterface(t)
+	sock, err := openFrameSocket(lo, newConfig(nil))
+	if errors.Is(err, ErrInsufficientPrivilege) {
+		t.Skip("the raw socket requires the privilege")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sock.deinitialize()
+
+	sa, err := syscall.Getsockname(sock.(*LinuxSocket).sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bound, ok := sa.(*syscall.SockaddrLinklayer)
+	if !ok || bound.Ifindex != lo.Index || bound.Protocol != htons(EthPArp) {
+		t.Errorf("socket bound to index %d for arp expected, but got: %+v", lo.Index, sa)
+	}
+}
+
+func TestSendTimeoutPerCall(t *testing.T) {
+	// an external socket needs no privilege - the timeout is taken from the config all the same
+	s, err := initialize(loopbackInterface(t), newConfig([]Option{WithSocketFD(0), WithTimeout(250 * time.Millisecond)}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.sendTimeout != 250*time.Millisecond {
+		t.Errorf("send timeout per 'WithTimeout' expected, but got: %s", s.sendTimeout)
+	}
+}
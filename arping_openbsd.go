@@ -0,0 +1,16 @@
+package arping
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// excludeSentFrames filters the frames sent by this host on the bpf device 'fd' - see 'WithExcludeOutgoing'
+func excludeSentFrames(fd int) error {
+	direction := uint32(syscall.BPF_DIRECTION_OUT)
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.BIOCSDIRFILT, uintptr(unsafe.Pointer(&direction)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -1,9 +1,14 @@
 package arping
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"net"
 	"runtime"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -30,6 +35,25 @@ func TestPingWithV6IP(t *testing.T) {
 	validateInvalidV4AddrErr(t, err)
 }
 
+func TestValidateIPWithV6Literals(t *testing.T) {
+	for _, literal := range []string{"fe80::e2cb:4eff:fed5:ca4e", "::1", "2001:db8::1"} {
+		err := validateIP(net.ParseIP(literal))
+		if !errors.Is(err, ErrIPv6NotSupported) {
+			t.Errorf("'%s': ErrIPv6NotSupported expected, but received: %v", literal, err)
+		}
+	}
+
+	// v4-mapped v6 addresses are v4 addresses
+	if err := validateIP(net.ParseIP("::ffff:192.168.1.1")); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	// invalid addresses are no v6 addresses
+	if err := validateIP(net.ParseIP("invalid")); errors.Is(err, ErrIPv6NotSupported) {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
 func TestGratuitousArpWithInvalidIP(t *testing.T) {
 	ip := net.ParseIP("invalid")
 
@@ -84,8 +108,933 @@ func TestGoroutinesDoesNotLeak(t *testing.T) {
 	}
 }
 
+func TestPingContextDeadlineEarlierThanTimeout(t *testing.T) {
+	useFakeSocket(t, newFakeSocket(nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := PingOverIfaceContext(ctx, net.ParseIP("127.0.0.2"), loopbackInterface(t), WithTimeout(10*time.Second))
+	if err != ErrTimeout {
+		t.Fatalf("timeout error expected, but received: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("context deadline not honored - ping took: %s", elapsed)
+	}
+}
+
+func TestPingTimeoutEarlierThanContextDeadline(t *testing.T) {
+	useFakeSocket(t, newFakeSocket(nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	_, err := PingOverIfaceContext(ctx, net.ParseIP("127.0.0.2"), loopbackInterface(t), WithTimeout(50*time.Millisecond))
+	if err != ErrTimeout {
+		t.Fatalf("timeout error expected, but received: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("timeout option not honored - ping took: %s", elapsed)
+	}
+}
+
+func TestPingContextCancel(t *testing.T) {
+	useFakeSocket(t, newFakeSocket(nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	_, err := PingOverIfaceContext(ctx, net.ParseIP("127.0.0.2"), loopbackInterface(t), WithTimeout(10*time.Second))
+	if err != context.Canceled {
+		t.Fatalf("context canceled error expected, but received: %v", err)
+	}
+}
+
+func TestPingCollectsReplies(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	useFakeSocket(t, newFakeSocket(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{newArpReply(request, mac)}
+	}))
+
+	results, err := PingOverIface(net.ParseIP("127.0.0.2"), loopbackInterface(t), WithTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].HwAddr.String() != mac.String() {
+		t.Errorf("unexpected results: %v", results)
+	}
+	if !results[0].TargetIP.Equal(net.ParseIP("127.0.0.1")) {
+		t.Errorf("target ip '127.0.0.1' expected, but got: '%s'", results[0].TargetIP)
+	}
+}
+
+func TestPingWithTargetFilter(t *testing.T) {
+	sock := newFakeSocket(nil)
+	useFakeSocket(t, sock)
+
+	dstIP := net.ParseIP("127.0.0.2")
+	PingOverIface(dstIP, loopbackInterface(t), WithTimeout(10*time.Millisecond), WithTargetFilter())
+	if !sock.senderFilter.Equal(dstIP) {
+		t.Errorf("sender filter for '%s' expected, but got: '%s'", dstIP, sock.senderFilter)
+	}
+}
+
+func TestPingWithAcceptedLocalIPs(t *testing.T) {
+	vip := net.ParseIP("127.0.0.3")
+	useFakeSocket(t, newFakeSocket(func(request arpDatagram) []arpDatagram {
+		reply := newArpReply(request, net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01})
+		reply.tpa = vip.To4()
+		return []arpDatagram{reply}
+	}))
+
+	dstIP := net.ParseIP("127.0.0.2")
+	if _, err := PingOverIface(dstIP, loopbackInterface(t), WithTimeout(50*time.Millisecond)); err != ErrTimeout {
+		t.Fatalf("reply to '%s' should be ignored - received err: %v", vip, err)
+	}
+
+	results, err := PingOverIface(dstIP, loopbackInterface(t), WithTimeout(50*time.Millisecond),
+		WithAcceptedLocalIPs([]net.IP{vip}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Errorf("one result expected, but got: %v", results)
+	}
+	if !results[0].TargetIP.Equal(vip) {
+		t.Errorf("target ip '%s' expected, but got: '%s'", vip, results[0].TargetIP)
+	}
+}
+
+func TestLocalAddresses(t *testing.T) {
+	ips, _, err := LocalAddresses(loopbackInterface(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ip := range ips {
+		if ip.Equal(net.ParseIP("127.0.0.1")) {
+			return
+		}
+	}
+	t.Errorf("'127.0.0.1' expected in: %v", ips)
+}
+
+// syncBuffer is a buffer, which can be read while the receivers of earlier calls still log into it
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestSetVerboseOutput(t *testing.T) {
+	useFakeSocket(t, newFakeSocket(nil))
+
+	var buf syncBuffer
+	SetVerboseOutput(&buf)
+	defer SetVerboseOutput(nil)
+
+	srcMac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x0a}
+	lo := loopbackInterface(t)
+	PingOverIface(net.ParseIP("127.0.0.2"), lo, WithTimeout(10*time.Millisecond), WithSourceMAC(srcMac))
+	if !strings.Contains(buf.String(), "arping '127.0.0.2'") {
+		t.Errorf("verbose output expected, but got: '%s'", buf.String())
+	}
+	fingerprint := fmt.Sprintf("'%s' (index: %d, mac: %s)", lo.Name, lo.Index, srcMac)
+	if !strings.Contains(buf.String(), fingerprint) {
+		t.Errorf("interface fingerprint %s expected, but got: '%s'", fingerprint, buf.String())
+	}
+}
+
+func TestIgnoredFrameLog(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	useFakeSocket(t, newFakeSocket(func(request arpDatagram) []arpDatagram {
+		unrelated := newArpRequest(mac, net.ParseIP("127.0.0.9"), BroadcastMAC(), net.ParseIP("127.0.0.8"))
+		return []arpDatagram{newArpReply(request, mac), unrelated}
+	}))
+	defer SetVerboseOutput(nil)
+
+	lo := loopbackInterface(t)
+	dstIP := net.ParseIP("127.0.0.2")
+	var buf syncBuffer
+	SetVerboseOutput(&buf)
+	if _, err := PingOverIface(dstIP, lo, WithTimeout(20*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "ignore received arp"); n != 1 {
+		t.Errorf("only the unrelated frame expected to be logged as ignored, but got: '%s'", buf.String())
+	}
+
+	var quiet syncBuffer
+	SetVerboseOutput(&quiet)
+	if _, err := PingSync(dstIP, lo, WithTimeout(20*time.Millisecond), WithIgnoredFrameLog(false)); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(quiet.String(), "ignore received arp") || !strings.Contains(quiet.String(), "process received arp") {
+		t.Errorf("only the reply expected to be logged, but got: '%s'", quiet.String())
+	}
+}
+
+func TestFrameSummaryLog(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	sock := newFakeSocket(func(request arpDatagram) []arpDatagram {
+		unrelated := newArpRequest(mac, net.ParseIP("127.0.0.9"), BroadcastMAC(), net.ParseIP("127.0.0.8"))
+		return []arpDatagram{unrelated, newArpReply(request, mac), unrelated}
+	})
+	orig := openSocket
+	openSocket = func(iface net.Interface, cfg *config) (socket, error) {
+		return retryingSocket{&countingSocket{socket: sock}}, nil
+	}
+	t.Cleanup(func() {
+		openSocket = orig
+	})
+	defer SetVerboseOutput(nil)
+
+	lo := loopbackInterface(t)
+	dstIP := net.ParseIP("127.0.0.2")
+	for name, ping := range map[string]func(opts ...Option) error{
+		"PingOverIface": func(opts ...Option) error { _, err := PingOverIface(dstIP, lo, opts...); return err },
+		"PingSync":      func(opts ...Option) error { _, err := PingSync(dstIP, lo, opts...); return err },
+		"PingN": func(opts ...Option) error {
+			_, err := PingNOverIfaceContext(context.Background(), dstIP, lo, 1, 0, opts...)
+			return err
+		},
+	} {
+		var buf syncBuffer
+		SetVerboseOutput(&buf)
+		var stats Stats
+		if err := ping(WithTimeout(20*time.Millisecond), WithIgnoredFrameLog(false), WithStats(&stats)); err != nil {
+			t.Fatal(err)
+		}
+		if stats.Ignored != 2 {
+			t.Errorf("%s: 2 ignored frames expected, but got: %d", name, stats.Ignored)
+		}
+		if !strings.Contains(buf.String(), "received 3 arp frames, 1 matched, 2 ignored") {
+			t.Errorf("%s: summary of the received frames expected, but got: '%s'", name, buf.String())
+		}
+	}
+}
+
+func TestPingAnyInterface(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	useFakeSocket(t, newFakeSocket(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{newArpReply(request, mac)}
+	}))
+
+	lo := loopbackInterface(t)
+	other := net.Interface{Index: 1 << 20, Name: "other", Flags: net.FlagUp | net.FlagBroadcast}
+	results, err := pingAnyInterface(net.ParseIP("127.0.0.2"), []net.Interface{other, lo},
+		[]Option{WithTimeout(10 * time.Millisecond)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Iface != lo.Name {
+		t.Errorf("one result over '%s' expected, but got: %v", lo.Name, results)
+	}
+}
+
+func TestPingAnyInterfaceTimeout(t *testing.T) {
+	useFakeSocket(t, newFakeSocket(nil))
+
+	_, err := pingAnyInterface(net.ParseIP("127.0.0.2"), []net.Interface{loopbackInterface(t)},
+		[]Option{WithTimeout(10 * time.Millisecond)})
+	if err != ErrTimeout {
+		t.Errorf("timeout error expected, but received: %v", err)
+	}
+}
+
+func TestGratuitousArpNContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sock := newFakeSocket(nil)
+	sock.respond = func(request arpDatagram) []arpDatagram {
+		if len(sock.sentDatagrams()) == 2 {
+			cancel()
+		}
+		return nil
+	}
+	useFakeSocket(t, sock)
+
+	sent, err := GratuitousArpNOverIfaceContext(ctx, net.ParseIP("127.0.0.1"), loopbackInterface(t), 10, 100*time.Millisecond)
+	if err != context.Canceled {
+		t.Errorf("context canceled error expected, but received: %v", err)
+	}
+	if sent != 2 {
+		t.Errorf("2 sent gratuitous arps expected, but sent: %d", sent)
+	}
+}
+
+func TestGratuitousArpN(t *testing.T) {
+	sock := newFakeSocket(nil)
+	useFakeSocket(t, sock)
+
+	srcIP := net.ParseIP("127.0.0.1")
+	sent, err := GratuitousArpNOverIfaceContext(context.Background(), srcIP, loopbackInterface(t), 3, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent != 3 || len(sock.sentDatagrams()) != 3 {
+		t.Errorf("3 sent gratuitous arps expected, but sent: %d", sent)
+	}
+	for _, datagram := range sock.sentDatagrams() {
+		if !datagram.SenderIP().Equal(srcIP) || !datagram.TargetIP().Equal(srcIP) {
+			t.Errorf("gratuitous arp from / to '%s' expected", srcIP)
+		}
+	}
+}
+
+func TestGratuitousArpWithAnnounceConfirmation(t *testing.T) {
+	srcIP := net.ParseIP("127.0.0.1")
+	neighbor := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+	prober := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x03}
+	other := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x04}
+	sock := newFakeSocket(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{
+			request,
+			newArpRequest(neighbor, net.ParseIP("127.0.0.2"), BroadcastMAC(), srcIP),
+			newArpRequest(neighbor, net.ParseIP("127.0.0.2"), BroadcastMAC(), srcIP),
+			newArpRequest(other, net.ParseIP("127.0.0.4"), BroadcastMAC(), net.ParseIP("127.0.0.5")),
+			newArpRequest(prober, net.IPv4zero, BroadcastMAC(), srcIP),
+		}
+	})
+	useFakeSocket(t, sock)
+
+	var neighbors []net.HardwareAddr
+	if err := GratuitousArpOverIface(srcIP, loopbackInterface(t), WithAnnounceConfirmation(20*time.Millisecond, &neighbors)); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(neighbors) != fmt.Sprint([]net.HardwareAddr{neighbor, prober}) {
+		t.Errorf("neighbors %s and %s expected, but got: %v", neighbor, prober, neighbors)
+	}
+	if !sock.closed {
+		t.Error("socket expected to be closed")
+	}
+}
+
+func TestPingIgnoresSelfReply(t *testing.T) {
+	self := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	useFakeSocket(t, newFakeSocket(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{newArpReply(request, self)}
+	}))
+
+	iface := loopbackInterface(t)
+	iface.HardwareAddr = self
+
+	dstIP := net.ParseIP("127.0.0.2")
+	if _, err := PingOverIface(dstIP, iface, WithTimeout(10*time.Millisecond)); err != ErrTimeout {
+		t.Errorf("reply from self should be ignored - received err: %v", err)
+	}
+
+	results, err := PingOverIface(dstIP, iface, WithTimeout(10*time.Millisecond), WithAllowSelf())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Errorf("one result expected, but got: %v", results)
+	}
+}
+
+func TestPingUnicast(t *testing.T) {
+	dstMac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	sock := newFakeSocket(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{newArpReply(request, dstMac)}
+	})
+	useFakeSocket(t, sock)
+
+	if _, err := PingUnicast(net.ParseIP("127.0.0.2"), dstMac, loopbackInterface(t), WithTimeout(10*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if sent := sock.sentDatagrams(); len(sent) != 1 || !bytes.Equal(sent[0].tha, dstMac) {
+		t.Errorf("one request to '%s' expected, but sent: %v", dstMac, sent)
+	}
+}
+
+func TestPingUnicastMacMismatch(t *testing.T) {
+	dstMac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	spoofed := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x66}
+	useFakeSocket(t, newFakeSocket(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{newArpReply(request, dstMac), newArpReply(request, spoofed)}
+	}))
+
+	_, err := PingUnicast(net.ParseIP("127.0.0.2"), dstMac, loopbackInterface(t), WithTimeout(10*time.Millisecond))
+	if !errors.Is(err, ErrMacMismatch) || !strings.Contains(err.Error(), spoofed.String()) {
+		t.Errorf("mac mismatch with '%s' expected, but got: %v", spoofed, err)
+	}
+}
+
+func TestPingOverIfaceFuncStopsEarly(t *testing.T) {
+	useFakeSocket(t, newFakeSocket(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{
+			newArpReply(request, net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}),
+			newArpReply(request, net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}),
+		}
+	}))
+
+	var replies []Result
+	start := time.Now()
+	err := PingOverIfaceFunc(net.ParseIP("127.0.0.2"), loopbackInterface(t), func(result Result) bool {
+		replies = append(replies, result)
+		return false
+	}, WithTimeout(10*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) != 1 {
+		t.Errorf("one reply expected, but got: %v", replies)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("callback returning false should stop the ping - took: %s", elapsed)
+	}
+}
+
+func TestPingWithSourceIPAndMAC(t *testing.T) {
+	srcIP := net.ParseIP("10.0.0.1")
+	srcMac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x0a}
+	sock := newFakeSocket(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{newArpReply(request, net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01})}
+	})
+	useFakeSocket(t, sock)
+
+	if _, err := PingOverIface(net.ParseIP("127.0.0.2"), loopbackInterface(t), WithTimeout(10*time.Millisecond),
+		WithSourceIP(srcIP), WithSourceMAC(srcMac)); err != nil {
+		t.Fatal(err)
+	}
+	sent := sock.sentDatagrams()
+	if len(sent) != 1 {
+		t.Fatalf("one request expected, but sent: %v", sent)
+	}
+	if !sent[0].SenderIP().Equal(srcIP) || !bytes.Equal(sent[0].sha, srcMac) {
+		t.Errorf("request from '%s' / '%s' expected, but sent from: '%s' / '%s'",
+			srcIP, srcMac, sent[0].SenderIP(), sent[0].SenderMac())
+	}
+}
+
+func TestPingWithQuietPeriodAndBurstyReplies(t *testing.T) {
+	useFakeSocket(t, newFakeSocket(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{
+			newArpReply(request, net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}),
+			newArpReply(request, net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}),
+			newArpReply(request, net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x03}),
+		}
+	}))
+
+	start := time.Now()
+	results, err := PingOverIface(net.ParseIP("127.0.0.2"), loopbackInterface(t), WithTimeout(10*time.Second),
+		WithQuietPeriod(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Errorf("3 results expected, but got: %v", results)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("quiet period not honored - ping took: %s", elapsed)
+	}
+}
+
+func TestPingWithQuietPeriodAndSpacedReplies(t *testing.T) {
+	// replies immediately and a second time after 300ms
+	useSpacedRepliesSocket := func() {
+		sock := newFakeSocket(nil)
+		sock.respond = func(request arpDatagram) []arpDatagram {
+			spaced := newArpReply(request, net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02})
+			time.AfterFunc(300*time.Millisecond, func() {
+				sock.inject(spaced)
+			})
+			return []arpDatagram{newArpReply(request, net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01})}
+		}
+		useFakeSocket(t, sock)
+	}
+	dstIP := net.ParseIP("127.0.0.2")
+
+	useSpacedRepliesSocket()
+	results, err := PingOverIface(dstIP, loopbackInterface(t), WithTimeout(time.Second), WithQuietPeriod(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Errorf("only the reply within the quiet period expected, but got: %v", results)
+	}
+
+	// default: wait the full timeout
+	useSpacedRepliesSocket()
+	results, err = PingOverIface(dstIP, loopbackInterface(t), WithTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Errorf("both replies expected, but got: %v", results)
+	}
+}
+
 func validateInvalidV4AddrErr(t *testing.T, err error) {
 	if !strings.Contains(err.Error(), "not a valid v4 Address") {
 		t.Errorf("unexpected error: %s", err)
 	}
 }
+
+func TestPingSync(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	useFakeSocket(t, newFakeSocket(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{newArpReply(request, mac), newArpReply(request, mac)}
+	}))
+
+	goroutines := runtime.NumGoroutine()
+	var stats Stats
+	results, err := PingSync(net.ParseIP("127.0.0.2"), loopbackInterface(t), WithTimeout(20*time.Millisecond),
+		WithStats(&stats))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || stats.Replies != 2 {
+		t.Errorf("both replies expected, but got: %v", results)
+	}
+	if n := runtime.NumGoroutine(); n > goroutines {
+		t.Errorf("no goroutines expected, but got: %d more", n-goroutines)
+	}
+
+	useFakeSocket(t, newFakeSocket(nil))
+	if _, err := PingSync(net.ParseIP("127.0.0.2"), loopbackInterface(t), WithTimeout(10*time.Millisecond)); err != ErrTimeout {
+		t.Errorf("timeout error expected, but received: %v", err)
+	}
+}
+
+func TestFirstReplyLatency(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	sock := newFakeSocket(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{newArpReply(request, mac)}
+	})
+	const setup = 20 * time.Millisecond
+	orig := openSocket
+	openSocket = func(iface net.Interface, cfg *config) (socket, error) {
+		// a slow socket setup
+		time.Sleep(setup)
+		return sock, nil
+	}
+	t.Cleanup(func() {
+		openSocket = orig
+	})
+
+	var stats Stats
+	results, err := PingOverIface(net.ParseIP("127.0.0.2"), loopbackInterface(t), WithTimeout(50*time.Millisecond),
+		WithStats(&stats))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.FirstReplyLatency < setup || results[0].Duration >= setup {
+		t.Errorf("first reply latency including the setup of %s expected, but got: %s - round trip time: %s",
+			setup, stats.FirstReplyLatency, results[0].Duration)
+	}
+}
+
+func TestFirstReplyLatencyAtReceiveTime(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	useFakeSocket(t, newFakeSocket(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{newArpReply(request, mac)}
+	}))
+
+	// a slow event consumer delays the processing of the reply - after it was received
+	const delay = 30 * time.Millisecond
+	slowConsumer := withEvents(func(event Event) {
+		if event.Type == EventReplyReceived {
+			time.Sleep(delay)
+		}
+	})
+
+	var stats Stats
+	start := time.Now()
+	_, err := PingOverIface(net.ParseIP("127.0.0.2"), loopbackInterface(t), WithTimeout(100*time.Millisecond),
+		WithStats(&stats), slowConsumer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.FirstReplyLatency <= 0 || stats.FirstReplyLatency >= delay {
+		t.Errorf("first reply latency below the processing delay of %s expected, but got: %s",
+			delay, stats.FirstReplyLatency)
+	}
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Errorf("the reply should be processed after the delay, but the ping took: %s", elapsed)
+	}
+}
+
+func TestPingWithMaxReplyAge(t *testing.T) {
+	sock := newFakeSocket(nil)
+	sock.respond = func(request arpDatagram) []arpDatagram {
+		go func() {
+			// delayed by a busy switch
+			time.Sleep(20 * time.Millisecond)
+			sock.inject(newArpReply(request, net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}))
+		}()
+		return nil
+	}
+	useFakeSocket(t, sock)
+
+	var stats Stats
+	_, err := PingOverIface(net.ParseIP("127.0.0.2"), loopbackInterface(t), WithTimeout(50*time.Millisecond),
+		WithMaxReplyAge(5*time.Millisecond), WithStats(&stats))
+	if err != ErrTimeout || stats.Late != 1 || stats.Replies != 0 {
+		t.Errorf("timeout with one late reply expected, but got: %v / %+v", err, stats)
+	}
+
+	if _, err := PingOverIface(net.ParseIP("127.0.0.2"), loopbackInterface(t), WithTimeout(50*time.Millisecond)); err != nil {
+		t.Errorf("late reply expected to be accepted per default, but got: %v", err)
+	}
+}
+
+func TestPingFirstReturnsFirstReply(t *testing.T) {
+	first := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	second := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+	useFakeSocket(t, newFakeSocket(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{newArpReply(request, first), newArpReply(request, second)}
+	}))
+
+	start := time.Now()
+	result, err := PingFirstOverIface(net.ParseIP("127.0.0.2"), loopbackInterface(t), WithTimeout(10*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.HwAddr.String() != first.String() {
+		t.Errorf("first reply from '%s' expected, but got: '%s'", first, result.HwAddr)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("no wait for the timeout expected - ping took: %s", elapsed)
+	}
+}
+
+func TestPingFirstTimeout(t *testing.T) {
+	useFakeSocket(t, newFakeSocket(nil))
+
+	_, err := PingFirstOverIface(net.ParseIP("127.0.0.2"), loopbackInterface(t), WithTimeout(10*time.Millisecond))
+	if err != ErrTimeout {
+		t.Fatalf("timeout error expected, but received: %v", err)
+	}
+}
+
+func BenchmarkPingOverIface(b *testing.B) {
+	benchmarkPing(b, func(dstIP net.IP, iface net.Interface) error {
+		_, err := PingOverIface(dstIP, iface, WithTimeout(time.Millisecond))
+		return err
+	})
+}
+
+func BenchmarkPingSync(b *testing.B) {
+	benchmarkPing(b, func(dstIP net.IP, iface net.Interface) error {
+		_, err := PingSync(dstIP, iface, WithTimeout(time.Millisecond))
+		return err
+	})
+}
+
+func BenchmarkPingFirstOverIface(b *testing.B) {
+	benchmarkPing(b, func(dstIP net.IP, iface net.Interface) error {
+		_, err := PingFirstOverIface(dstIP, iface, WithTimeout(time.Millisecond))
+		return err
+	})
+}
+
+func BenchmarkPingRTT(b *testing.B) {
+	benchmarkPing(b, func(dstIP net.IP, iface net.Interface) error {
+		_, _, err := PingRTT(dstIP, iface, WithTimeout(time.Millisecond))
+		return err
+	})
+}
+
+func benchmarkPing(b *testing.B, ping func(dstIP net.IP, iface net.Interface) error) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	useFakeSocket(b, newFakeSocket(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{newArpReply(request, mac)}
+	}))
+	dstIP := net.ParseIP("127.0.0.2")
+	iface := loopbackInterface(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := ping(dstIP, iface); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestPingWithCustomInterfaceSelector(t *testing.T) {
+	lo := loopbackInterface(t)
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	useFakeSocket(t, newFakeSocket(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{newArpReply(request, mac)}
+	}))
+
+	var candidates []net.Interface
+	SetInterfaceSelector(func(c []net.Interface, dstIP net.IP) (net.Interface, error) {
+		candidates = c
+		return lo, nil
+	})
+	defer SetInterfaceSelector(nil)
+
+	results, err := Ping(net.ParseIP("127.0.0.2"), WithTimeout(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Errorf("one result expected, but got: %v", results)
+	}
+	if len(candidates) == 0 {
+		t.Error("selector called without candidates")
+	}
+}
+
+func TestPingWithFailingInterfaceSelector(t *testing.T) {
+	selectorErr := errors.New("no interface for you")
+	SetInterfaceSelector(func([]net.Interface, net.IP) (net.Interface, error) {
+		return net.Interface{}, selectorErr
+	})
+	defer SetInterfaceSelector(nil)
+
+	if _, err := Ping(net.ParseIP("127.0.0.2")); err != selectorErr {
+		t.Errorf("selector error expected, but received: %v", err)
+	}
+}
+
+func TestPingWithMaxResults(t *testing.T) {
+	const floodSize = 5000
+	useFakeSocket(t, newFakeSocket(func(request arpDatagram) []arpDatagram {
+		replies := make([]arpDatagram, floodSize)
+		for i := range replies {
+			replies[i] = newArpReply(request, net.HardwareAddr{0x02, 0x00, 0x00, 0x00, byte(i >> 8), byte(i)})
+		}
+		return replies
+	}))
+
+	var stats Stats
+	results, err := PingOverIface(net.ParseIP("127.0.0.2"), loopbackInterface(t), WithTimeout(500*time.Millisecond),
+		WithMaxResults(10), WithStats(&stats))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 10 || cap(results) > 2*10 {
+		t.Errorf("10 stored results expected, but got len: %d, cap: %d", len(results), cap(results))
+	}
+	if stats.Replies != floodSize {
+		t.Errorf("%d replies expected, but counted: %d", floodSize, stats.Replies)
+	}
+}
+
+func TestPingWithSourceIPFallback(t *testing.T) {
+	second := net.ParseIP("10.0.0.1")
+	origAddrs := interfaceAddrs
+	interfaceAddrs = func(iface net.Interface) ([]net.Addr, error) {
+		return []net.Addr{
+			&net.IPNet{IP: net.ParseIP("127.0.0.1").To4(), Mask: net.CIDRMask(8, 32)},
+			&net.IPNet{IP: second.To4(), Mask: net.CIDRMask(24, 32)},
+		}, nil
+	}
+	t.Cleanup(func() {
+		interfaceAddrs = origAddrs
+	})
+
+	sock := newFakeSocket(func(request arpDatagram) []arpDatagram {
+		// replies only to the second candidate
+		if !request.SenderIP().Equal(second) {
+			return nil
+		}
+		return []arpDatagram{newArpReply(request, net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01})}
+	})
+	useFakeSocket(t, sock)
+
+	results, err := PingOverIface(net.ParseIP("127.0.0.2"), loopbackInterface(t), WithTimeout(20*time.Millisecond),
+		WithSourceIPFallback())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !results[0].SourceIP.Equal(second) {
+		t.Errorf("one result from source '%s' expected, but got: %v", second, results)
+	}
+	if sent := sock.sentDatagrams(); len(sent) != 2 {
+		t.Errorf("2 requests expected, but sent: %d", len(sent))
+	}
+}
+
+func TestPingWithZeroSource(t *testing.T) {
+	origAddrs := interfaceAddrs
+	interfaceAddrs = func(iface net.Interface) ([]net.Addr, error) {
+		// an interface only used on layer 2
+		return nil, nil
+	}
+	t.Cleanup(func() {
+		interfaceAddrs = origAddrs
+	})
+
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	sock := newFakeSocket(func(request arpDatagram) []arpDatagram {
+		// replies to the probe with its own address as target - as some stacks do
+		reply := newArpReply(request, mac)
+		reply.tpa = request.tpa
+		return []arpDatagram{reply}
+	})
+	useFakeSocket(t, sock)
+
+	lo := loopbackInterface(t)
+	dstIP := net.ParseIP("127.0.0.2")
+	if _, err := PingOverIface(dstIP, lo, WithTimeout(20*time.Millisecond)); err == nil {
+		t.Error("ping over an interface without address should fail without 'WithZeroSource'")
+	}
+
+	results, err := PingOverIface(dstIP, lo, WithTimeout(20*time.Millisecond), WithZeroSource())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].HwAddr.String() != mac.String() {
+		t.Errorf("one result from '%s' expected, but got: %v", mac, results)
+	}
+	if sent := sock.sentDatagrams(); len(sent) != 1 || !sent[0].SenderIP().Equal(net.IPv4zero) {
+		t.Errorf("one request from 0.0.0.0 expected, but sent: %v", sent)
+	}
+
+	dstIPs := []net.IP{dstIP, net.ParseIP("127.0.0.3")}
+	scanned, err := PingManyOverIfaceContext(context.Background(), dstIPs, lo, WithTimeout(20*time.Millisecond),
+		WithZeroSource())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scanned) != 2 {
+		t.Errorf("2 results expected from the scan, but got: %v", scanned)
+	}
+}
+
+func TestPingWithHardwareType(t *testing.T) {
+	sock := newFakeSocket(func(request arpDatagram) []arpDatagram {
+		// replies always as ethernet
+		reply := newArpReply(request, net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01})
+		reply.htype = 1
+		return []arpDatagram{reply}
+	})
+	useFakeSocket(t, sock)
+
+	lo := loopbackInterface(t)
+	if _, err := PingOverIface(net.ParseIP("127.0.0.2"), lo, WithTimeout(20*time.Millisecond),
+		WithHardwareType(6)); err != ErrTimeout {
+		t.Errorf("reply with a different hardware type should be ignored - received err: %v", err)
+	}
+	if sent := sock.sentDatagrams(); len(sent) != 1 || sent[0].HardwareType() != 6 {
+		t.Errorf("one request with hardware type 6 expected, but sent: %v", sent)
+	}
+
+	if _, err := PingOverIface(net.ParseIP("127.0.0.2"), lo, WithTimeout(20*time.Millisecond),
+		WithHardwareType(6), WithLenient()); err != nil {
+		t.Errorf("reply should be accepted per 'WithLenient' - received err: %v", err)
+	}
+}
+
+func TestPingWithAcceptAnyFromTarget(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	dstIP := net.ParseIP("127.0.0.2")
+	useFakeSocket(t, newFakeSocket(func(request arpDatagram) []arpDatagram {
+		// the target doesn't reply, but asks for someone else
+		return []arpDatagram{newArpRequest(mac, dstIP, BroadcastMAC(), net.ParseIP("127.0.0.9"))}
+	}))
+
+	lo := loopbackInterface(t)
+	if _, err := PingOverIface(dstIP, lo, WithTimeout(20*time.Millisecond)); err != ErrTimeout {
+		t.Errorf("request from the target should be ignored - received err: %v", err)
+	}
+
+	results, err := PingOverIface(dstIP, lo, WithTimeout(20*time.Millisecond), WithAcceptAnyFromTarget())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !bytes.Equal(results[0].HwAddr, mac) {
+		t.Errorf("one result from '%s' expected, but got: %v", mac, results)
+	}
+	if len(results) == 1 && results[0].Solicited {
+		t.Error("the observed request should be reported as unsolicited")
+	}
+}
+
+func TestPingWithMatchByMACOnly(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	primary := net.ParseIP("127.0.0.3")
+	sock := newFakeSocket(func(request arpDatagram) []arpDatagram {
+		// the host answers the request for its secondary address from its primary one
+		reply := newArpReply(request, mac)
+		reply.spa = primary.To4()
+		return []arpDatagram{reply}
+	})
+	useFakeSocket(t, sock)
+
+	lo := loopbackInterface(t)
+	secondary := net.ParseIP("127.0.0.2")
+	if _, err := PingOverIface(secondary, lo, WithTimeout(20*time.Millisecond)); err != ErrTimeout {
+		t.Errorf("reply from another ip should be ignored per default - received err: %v", err)
+	}
+
+	results, err := PingOverIface(secondary, lo, WithTimeout(20*time.Millisecond), WithMatchByMACOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !results[0].IP.Equal(primary) {
+		t.Errorf("one result from '%s' expected, but got: %v", primary, results)
+	}
+}
+
+func TestPingDeadlineEarlierThanProbeTimeout(t *testing.T) {
+	useFakeSocket(t, newFakeSocket(nil))
+
+	start := time.Now()
+	_, err := PingOverIface(net.ParseIP("127.0.0.2"), loopbackInterface(t), WithProbeTimeout(10*time.Second),
+		WithDeadline(time.Now().Add(50*time.Millisecond)))
+	if err != ErrTimeout {
+		t.Fatalf("timeout error expected, but received: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("deadline not honored - ping took: %s", elapsed)
+	}
+}
+
+func TestGratuitousArpAllAddresses(t *testing.T) {
+	origAddrs := interfaceAddrs
+	interfaceAddrs = func(iface net.Interface) ([]net.Addr, error) {
+		return []net.Addr{
+			&net.IPNet{IP: net.IPv4(10, 0, 0, 1).To4(), Mask: net.CIDRMask(24, 32)},
+			&net.IPNet{IP: net.ParseIP("fe80::1"), Mask: net.CIDRMask(64, 128)},
+			&net.IPNet{IP: net.IPv4(10, 0, 0, 2).To4(), Mask: net.CIDRMask(24, 32)},
+			&net.IPNet{IP: net.IPv4(10, 0, 0, 3).To4(), Mask: net.CIDRMask(24, 32)},
+		}, nil
+	}
+	defer func() {
+		interfaceAddrs = origAddrs
+	}()
+
+	sock := newFakeSocket(nil)
+	sendErr := errors.New("send failed")
+	// the second announcement fails
+	sock.respond = func(request arpDatagram) []arpDatagram {
+		if request.SenderIP().Equal(net.ParseIP("10.0.0.1")) {
+			sock.sendErrs = []error{sendErr}
+		}
+		return nil
+	}
+	useFakeSocket(t, sock)
+
+	err := GratuitousArpAllAddresses(loopbackInterface(t))
+	if !errors.Is(err, sendErr) || !strings.Contains(err.Error(), "10.0.0.2") {
+		t.Errorf("send error of '10.0.0.2' expected, but got: %v", err)
+	}
+	var announced []string
+	for _, datagram := range sock.sentDatagrams() {
+		announced = append(announced, datagram.SenderIP().String())
+	}
+	if len(announced) != 2 || announced[0] != "10.0.0.1" || announced[1] != "10.0.0.3" {
+		t.Errorf("announcements of [10.0.0.1 10.0.0.3] expected, but got: %v", announced)
+	}
+}
@@ -0,0 +1,27 @@
+package arping
+
+import (
+	"net"
+)
+
+// readBridgePorts returns the names of the ports, which learned the hardware addresses - per mac as string,
+// for the bridge with 'bridgeIndex'. Replaced in tests.
+var readBridgePorts = bridgePorts
+
+// annotateBridgePorts sets the bridge port of 'results' per 'WithBridgePortReporting'
+// - a no-op if 'iface' isn't a bridge or the forwarding database isn't readable
+func annotateBridgePorts(results []Result, iface net.Interface, cfg *config) {
+	var ports map[string]string
+	err := inNetNS(cfg.netns, func() (err error) {
+		ports, err = readBridgePorts(iface.Index)
+		return err
+	})
+	if err != nil {
+		verboseLog.Printf("can't read the bridge ports of interface: '%s': %s\n", iface.Name, err)
+		return
+	}
+
+	for i := range results {
+		results[i].BridgePort = ports[results[i].HwAddr.String()]
+	}
+}
@@ -0,0 +1,9 @@
+//go:build darwin || freebsd || openbsd
+// +build darwin freebsd openbsd
+
+package arping
+
+// bridgePorts isn't supported under BSD - the replies don't get annotated
+func bridgePorts(bridgeIndex int) (map[string]string, error) {
+	return nil, nil
+}
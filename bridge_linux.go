@@ -0,0 +1,46 @@
+package arping
+
+import (
+	"net"
+	"syscall"
+)
+
+// ndaMaster is the neighbor message attribute of the bridge index - from 'linux/neighbour.h'
+const ndaMaster = 9
+
+// bridgePorts reads the forwarding database of the bridge with 'bridgeIndex' per netlink
+// - empty if the interface isn't a bridge
+func bridgePorts(bridgeIndex int) (map[string]string, error) {
+	rib, err := syscall.NetlinkRIB(syscall.RTM_GETNEIGH, syscall.AF_BRIDGE)
+	if err != nil {
+		return nil, err
+	}
+
+	msgs, err := syscall.ParseNetlinkMessage(rib)
+	if err != nil {
+		return nil, err
+	}
+
+	ifaceNames := interfaceNames()
+
+	ports := make(map[string]string)
+	for _, msg := range msgs {
+		if msg.Header.Type != syscall.RTM_NEWNEIGH || len(msg.Data) < sizeofNdmsg {
+			continue
+		}
+
+		// struct ndmsg: family, pad1, pad2, ifindex, state, flags, type
+		ifindex := int(int32(nativeEndian.Uint32(msg.Data[4:8])))
+		attrs := parseNetlinkAttrs(msg.Data[sizeofNdmsg:])
+
+		master := attrs[ndaMaster]
+		if len(master) < 4 || int(nativeEndian.Uint32(master)) != bridgeIndex || ifindex == bridgeIndex {
+			// not a port of the bridge
+			continue
+		}
+		if mac := net.HardwareAddr(attrs[ndaLladdr]); len(mac) > 0 {
+			ports[mac.String()] = ifaceNames[ifindex]
+		}
+	}
+	return ports, nil
+}
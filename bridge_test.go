@@ -0,0 +1,45 @@
+package arping
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPingWithBridgePortReporting(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	useFakeSocket(t, newFakeSocket(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{newArpReply(request, mac)}
+	}))
+
+	lo := loopbackInterface(t)
+	origPorts := readBridgePorts
+	readBridgePorts = func(bridgeIndex int) (map[string]string, error) {
+		if bridgeIndex != lo.Index {
+			t.Errorf("bridge index %d expected, but got: %d", lo.Index, bridgeIndex)
+		}
+		return map[string]string{mac.String(): "veth0"}, nil
+	}
+	t.Cleanup(func() {
+		readBridgePorts = origPorts
+	})
+
+	results, err := PingOverIface(net.ParseIP("127.0.0.2"), lo, WithTimeout(10*time.Millisecond),
+		WithBridgePortReporting())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].BridgePort != "veth0" {
+		t.Errorf("one result over bridge port 'veth0' expected, but got: %v", results)
+	}
+}
+
+func TestBridgePortsOfNonBridge(t *testing.T) {
+	ports, err := bridgePorts(loopbackInterface(t).Index)
+	if err != nil {
+		t.Skipf("forwarding database not readable: %s", err)
+	}
+	if len(ports) != 0 {
+		t.Errorf("no ports of the loopback interface expected, but got: %v", ports)
+	}
+}
@@ -12,20 +12,50 @@
 //	-U: unsolicited/gratuitous ARP mode
 //	-i: interface name to use
 //	-t: timeout - duration with unit - such as 100ms, 500ms, 1s ...
+//	-c: number of probes to send, one per second - 0 pings until interrupted - with '-U': number of announcements, one per second
+//	-w: total deadline - duration with unit - stops after it regardless of the remaining probes
+//	-D: duplicate address detection - prints all replying hosts, exits with 1 if more than one host replies
+//	-s: source IP - the sender protocol address of the requests
+//	-S: source MAC - the sender hardware address of the requests and announcements
+//	-m: monitor mode - ping every second until interrupted, and print a timestamped line per transition between up and down
+//	-r: raw output - print only the MAC addresses, one per line - nothing on timeout
+//	-f: read the targets from a file, or '-' for stdin - one IP or CIDR - at least a /16 - per line, '#' starts a comment
+//	-jsonl: print every reply as json line with ip, mac, rtt_us and iface, the moment it's received
+//	        accepts a CIDR as parameter, or the targets per '-f' - the exit code is the same as with '-f'
+//	-csv: print the replies as csv with the columns ip, mac, rtt_us, iface and vendor - in ping mode and with '-f'
+//	-progress: print the progress of '-f' and '-jsonl' to stderr, such as '128/254 probed, 37 up'
+//	           only on a terminal - use '-progress=force' otherwise
+//
+// on SIGINT / SIGTERM the running probes are stopped and the sockets closed. in ping mode the replies so far
+// get printed per '-csv' - and a summary with the number of sent probes and replies, unless '-r' or '-csv'.
+//
+// environment - used if the corresponding flag is omitted:
+//
+//	ARPING_TIMEOUT: timeout per '-t'
+//	ARPING_IFACE: interface name per '-i'
 //
 // exit code:
 //
-//	0: target online
-//	1: target offline
+//	0: target online - with '-f': all targets online - with '-D': exactly one host replied
+//	   - interrupted per SIGINT / SIGTERM in ping mode, with '-m', '-U' and '-jsonl'
+//	1: target offline - with '-f': at least one target offline - with '-D': duplicate address detected
 //	2: error occurred - see command output
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/BirknerAlex/arping-go"
+	"io"
 	"net"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 )
 
@@ -35,8 +65,67 @@ var (
 	gratuitousFlag = flag.Bool("U", false, "unsolicited/gratuitous ARP mode")
 	ifaceNameFlag  = flag.String("i", "", "interface name to use - autodetected if omitted")
 	timeoutFlag    = flag.Duration("t", 500*time.Millisecond, "timeout - such as 100ms, 500ms, 1s ...")
+	fileFlag       = flag.String("f", "", "read the targets from a file, or '-' for stdin - one IP or CIDR - at least a /16 - per line")
+	countFlag      = flag.Int("c", 1, "number of probes to send, one per second - 0 pings until interrupted")
+	deadlineFlag   = flag.Duration("w", 0, "total deadline - stops after it regardless of the remaining probes")
+	duplicateFlag  = flag.Bool("D", false, "duplicate address detection - exits with 1 if more than one host replies")
+	srcIPFlag      = flag.String("s", "", "source IP - the sender protocol address of the requests")
+	srcMacFlag     = flag.String("S", "", "source MAC - the sender hardware address of the requests and announcements")
+	rawFlag        = flag.Bool("r", false, "raw output - print only the MAC addresses, one per line")
+	jsonlFlag      = flag.Bool("jsonl", false, "print every reply as json line with ip, mac, rtt_us and iface, the moment it's received - accepts a <CIDR>")
+	csvFlag        = flag.Bool("csv", false, "print the replies as csv with ip, mac, rtt_us, iface and vendor - in ping mode and with '-f'")
+	monitorFlag    = flag.Bool("m", false, "monitor mode - ping every second and print the transitions between up and down")
+	progressFlag   = progressMode("false")
 )
 
+func init() {
+	flag.Var(&progressFlag, "progress", "print the progress of '-f' and '-jsonl' to stderr - only on a terminal, unless '-progress=force'")
+}
+
+// progressMode is the value of '-progress': 'false', 'true' - only on a terminal - or 'force'
+type progressMode string
+
+func (m *progressMode) String() string {
+	return string(*m)
+}
+
+func (m *progressMode) Set(v string) error {
+	switch v {
+	case "false", "true", "force":
+		*m = progressMode(v)
+		return nil
+	}
+	return fmt.Errorf("one of 'true', 'false' or 'force' expected")
+}
+
+func (m *progressMode) IsBoolFlag() bool {
+	return true
+}
+
+// enabled returns true if the progress gets printed
+func (m progressMode) enabled() bool {
+	switch m {
+	case "force":
+		return true
+	case "true":
+		fi, err := os.Stderr.Stat()
+		return err == nil && fi.Mode()&os.ModeCharDevice != 0
+	}
+	return false
+}
+
+// options are the library options per the command line flags
+var options []arping.Option
+
+// gratuitousInterval is the interval between gratuitous arp announcements per '-c'
+const gratuitousInterval = time.Second
+
+// monitorInterval is the interval between the probes per '-m'
+const monitorInterval = time.Second
+
+// probeInterval is the interval between the probes per '-c' - like Linux arping
+const probeInterval = time.Second
+
 func main() {
 	flag.Parse()
 
@@ -46,56 +135,559 @@ func main() {
 	if *verboseFlag {
 		arping.EnableVerboseLog()
 	}
+	if err := parseEnv(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 	arping.SetTimeout(*timeoutFlag)
 
+	if err := parseOptions(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if *jsonlFlag {
+		streamAndExit()
+	}
+	if len(*fileFlag) > 0 {
+		batchAndExit()
+	}
+
 	if len(flag.Args()) != 1 {
-		fmt.Println("Parameter <IP> missing!")
+		fmt.Fprintln(os.Stderr, "Parameter <IP> missing!")
 		printHelpAndExit()
 	}
 	dstIP := net.ParseIP(flag.Arg(0))
 
-	var results []arping.Result
-	var err error
+	if *countFlag < 0 || (*countFlag == 0 && (*gratuitousFlag || *duplicateFlag || *monitorFlag)) {
+		fmt.Fprintln(os.Stderr, "count must be at least 1 - 0 is only supported in ping mode")
+		os.Exit(2)
+	}
+
+	ctx, cancel := deadlineContext()
+	defer cancel()
+
 	if *gratuitousFlag {
+		var err error
 		if len(*ifaceNameFlag) > 0 {
-			err = arping.GratuitousArpOverIfaceByName(dstIP, *ifaceNameFlag)
+			var iface *net.Interface
+			if iface, err = net.InterfaceByName(*ifaceNameFlag); err == nil {
+				_, err = arping.GratuitousArpNOverIfaceContext(ctx, dstIP, *iface, *countFlag, gratuitousInterval, options...)
+			}
 		} else {
-			err = arping.GratuitousArp(dstIP)
+			_, err = arping.GratuitousArpNContext(ctx, dstIP, *countFlag, gratuitousInterval, options...)
 		}
-	} else {
+		// the total deadline per '-w' or an interrupt stops the announcements - that's not an error
+		if err != nil && err != context.DeadlineExceeded && err != context.Canceled {
+			printError(os.Stderr, err)
+			os.Exit(2)
+		}
+		os.Exit(0)
+	}
+
+	if *duplicateFlag {
+		duplicateAndExit(ctx, dstIP)
+	}
+	if *monitorFlag {
+		monitorAndExit(ctx, dstIP)
+	}
+
+	ping := func(ctx context.Context) ([]arping.Result, error) {
 		if len(*ifaceNameFlag) > 0 {
-			results, err = arping.PingOverIfaceByName(dstIP, *ifaceNameFlag)
+			return arping.PingOverIfaceByNameContext(ctx, dstIP, *ifaceNameFlag, options...)
+		}
+		return arping.PingContext(ctx, dstIP, options...)
+	}
+	replies, sent, err := probe(ctx, *countFlag, probeInterval, ping, func(results []arping.Result) {
+		if !*csvFlag {
+			for _, result := range results {
+				printResult("", dstIP, result)
+			}
+		}
+	})
+	// ping failed
+	if err != nil {
+		printError(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if *csvFlag {
+		writeCSV(replies)
+	}
+	if interrupted(ctx) || *countFlag == 0 {
+		if !*rawFlag && !*csvFlag {
+			fmt.Printf("%d probes sent, %d replies received\n", sent, len(replies))
+		}
+		if interrupted(ctx) {
+			os.Exit(0)
+		}
+	}
+	if len(replies) == 0 {
+		if !*csvFlag {
+			printTimeout("")
+		}
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// probe sends 'count' probes per 'ping' - endless for 'count' 0 - one per 'interval', until 'ctx' is done.
+// 'onResults' gets the replies of every probe, the moment it returns. Returns all replies, the number of
+// completed probes and the first error other than a timeout - the total deadline per '-w' or an interrupt
+// stop the probes without an error.
+func probe(ctx context.Context, count int, interval time.Duration, ping func(ctx context.Context) ([]arping.Result, error),
+	onResults func(results []arping.Result)) (replies []arping.Result, sent int, err error) {
+	var next time.Time
+	for ; (count == 0 || sent < count) && ctx.Err() == nil; sent++ {
+		if sent > 0 {
+			// the interval starts with the previous probe - which waits for replies until its timeout
+			select {
+			case <-time.After(time.Until(next)):
+			case <-ctx.Done():
+				return replies, sent, nil
+			}
+		}
+
+		next = time.Now().Add(interval)
+		results, err := ping(ctx)
+
+		// ping timeout - try the next probe
+		if err == arping.ErrTimeout {
+			continue
+		}
+
+		// interrupted or the total deadline per '-w' passed within the probe
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return replies, sent, nil
+		}
+
+		if err != nil {
+			return replies, sent, err
+		}
+
+		onResults(results)
+		replies = append(replies, results...)
+	}
+	return replies, sent, nil
+}
+
+// monitorAndExit pings 'dstIP' every 'monitorInterval' and prints the transitions between up and down
+// - until interrupted
+func monitorAndExit(ctx context.Context, dstIP net.IP) {
+	var up, known bool
+	onProbe := func(result arping.Result, reply bool) {
+		if known && reply == up {
+			return
+		}
+		up, known = reply, true
+
+		timestamp := time.Now().Format(time.RFC3339)
+		if up {
+			fmt.Printf("%s %s up (%s) %s\n", timestamp, dstIP, result.HwAddr, result.Duration)
 		} else {
-			results, err = arping.Ping(dstIP)
+			fmt.Printf("%s %s down\n", timestamp, dstIP)
 		}
 	}
 
-	// ping timeout
+	var err error
+	if len(*ifaceNameFlag) > 0 {
+		var iface *net.Interface
+		if iface, err = net.InterfaceByName(*ifaceNameFlag); err == nil {
+			err = arping.PingLoopOverIface(ctx, dstIP, *iface, monitorInterval, onProbe, options...)
+		}
+	} else {
+		err = arping.PingLoop(ctx, dstIP, monitorInterval, onProbe, options...)
+	}
+	// interrupted or the total deadline per '-w' passed - that's not an error
+	if err != nil && err != context.Canceled && err != context.DeadlineExceeded {
+		printError(os.Stderr, err)
+		os.Exit(2)
+	}
+	os.Exit(0)
+}
+
+// duplicateAndExit runs the duplicate address detection for 'dstIP'
+func duplicateAndExit(ctx context.Context, dstIP net.IP) {
+	var results []arping.Result
+	var err error
+	if len(*ifaceNameFlag) > 0 {
+		var iface *net.Interface
+		if iface, err = net.InterfaceByName(*ifaceNameFlag); err == nil {
+			results, err = arping.DetectDuplicateIPOverIfaceContext(ctx, dstIP, *iface, options...)
+		}
+	} else {
+		results, err = arping.DetectDuplicateIPContext(ctx, dstIP, options...)
+	}
+
 	if err == arping.ErrTimeout {
-		fmt.Println(err)
+		printTimeout("")
 		os.Exit(1)
 	}
-
-	// ping failed
 	if err != nil {
-		fmt.Println(err)
+		printError(os.Stderr, err)
 		os.Exit(2)
 	}
 
+	for _, result := range results {
+		printResult("", dstIP, result)
+	}
+	if len(results) > 1 {
+		if !*rawFlag {
+			fmt.Printf("duplicate address detected: %d hosts replied\n", len(results))
+		}
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// printError prints 'err' to 'w' - with the command to grant the raw socket access, if it's missing
+func printError(w io.Writer, err error) {
+	fmt.Fprintln(w, err)
+	if errors.Is(err, arping.ErrInsufficientPrivilege) {
+		fmt.Fprintf(w, "grant the raw socket access under linux per: sudo setcap cap_net_raw+ep %s\n", os.Args[0])
+	}
+}
+
+// printResult prints 'result' of the ping to 'ip' - only the MAC per '-r'
+func printResult(indent string, ip net.IP, result arping.Result) {
+	if *rawFlag {
+		fmt.Println(result.HwAddr)
+		return
+	}
+	fmt.Printf("%s%s (%s) %s usec\n", indent, ip, result.HwAddr, result.Duration.String())
+}
+
+// writeCSV prints 'results' as csv per '-csv'
+func writeCSV(results []arping.Result) {
+	if err := arping.WriteCSV(os.Stdout, results); err != nil {
+		printError(os.Stderr, err)
+		os.Exit(2)
+	}
+}
+
+// printTimeout prints the timeout - nothing per '-r'
+func printTimeout(indent string) {
+	if !*rawFlag {
+		fmt.Printf("%s%s\n", indent, arping.ErrTimeout)
+	}
+}
+
+// parseEnv sets the timeout and interface from the environment - if not given per '-t' or '-i'
+func parseEnv() error {
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	if v, ok := os.LookupEnv("ARPING_TIMEOUT"); ok && !given["t"] {
+		t, err := time.ParseDuration(v)
+		if err != nil || t <= 0 {
+			return fmt.Errorf("invalid ARPING_TIMEOUT: '%s' - a positive duration, such as 500ms expected", v)
+		}
+		*timeoutFlag = t
+	}
+	if v, ok := os.LookupEnv("ARPING_IFACE"); ok && !given["i"] {
+		if _, err := net.InterfaceByName(v); err != nil {
+			return fmt.Errorf("invalid ARPING_IFACE: '%s': %w", v, err)
+		}
+		*ifaceNameFlag = v
+	}
+	return nil
+}
+
+// parseOptions sets the library options per the '-s' and '-S' flags
+func parseOptions() error {
+	if len(*srcIPFlag) > 0 {
+		if *gratuitousFlag {
+			return fmt.Errorf("source IP not supported with '-U' - the announced <IP> is the source")
+		}
+		ip := net.ParseIP(*srcIPFlag)
+		if ip == nil || ip.To4() == nil {
+			return fmt.Errorf("invalid source IP: '%s' - a v4 address, such as 192.168.1.10 expected", *srcIPFlag)
+		}
+		options = append(options, arping.WithSourceIP(ip))
+	}
+	if len(*srcMacFlag) > 0 {
+		mac, err := net.ParseMAC(*srcMacFlag)
+		if err != nil || len(mac) != 6 {
+			return fmt.Errorf("invalid source MAC: '%s' - an ethernet address, such as 02:00:00:00:00:01 expected", *srcMacFlag)
+		}
+		options = append(options, arping.WithSourceMAC(mac))
+	}
+	if progressFlag.enabled() {
+		options = append(options, arping.WithProgress(printProgress))
+	}
+	return nil
+}
+
+// printProgress overwrites the progress line on stderr
+func printProgress(p arping.Progress) {
+	fmt.Fprintf(os.Stderr, "\r%d/%d probed, %d up", p.Probed, p.Total, p.Up)
+}
+
+// finishProgress terminates the progress line
+func finishProgress() {
+	if progressFlag.enabled() {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+// deadlineContext returns a context which is done at the total deadline per '-w' - or cancelled per SIGINT / SIGTERM
+func deadlineContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if *deadlineFlag > 0 {
+		ctx, cancel = context.WithTimeout(ctx, *deadlineFlag)
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// interrupted returns true if 'ctx' per 'deadlineContext' got cancelled per SIGINT / SIGTERM
+func interrupted(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.Canceled)
+}
+
+// target is a single line from the targets file - with the ips it expands to
+type target struct {
+	line string
+	ips  []net.IP
+}
+
+// batchAndExit pings all targets from the file per '-f' concurrently
+func batchAndExit() {
 	if *gratuitousFlag {
+		fmt.Fprintln(os.Stderr, "gratuitous ARP mode is not supported with '-f'")
+		os.Exit(2)
+	}
+	if len(flag.Args()) != 0 {
+		fmt.Fprintln(os.Stderr, "Parameter <IP> not allowed with '-f'!")
+		printHelpAndExit()
+	}
+
+	targets, err := readTargets(*fileFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	var dstIPs []net.IP
+	for _, t := range targets {
+		dstIPs = append(dstIPs, t.ips...)
+	}
+
+	ctx, cancel := deadlineContext()
+	defer cancel()
+
+	var results map[string]arping.Result
+	if len(*ifaceNameFlag) > 0 {
+		var iface *net.Interface
+		if iface, err = net.InterfaceByName(*ifaceNameFlag); err == nil {
+			results, err = arping.PingManyOverIfaceContext(ctx, dstIPs, *iface, options...)
+		}
+	} else {
+		results, err = arping.PingManyContext(ctx, dstIPs, options...)
+	}
+	finishProgress()
+	if err != nil {
+		printError(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	exitCode := 0
+	if *csvFlag {
+		var replies []arping.Result
+		for _, t := range targets {
+			online := false
+			for _, ip := range t.ips {
+				if result, ok := results[ip.String()]; ok {
+					replies = append(replies, result)
+					online = true
+				}
+			}
+			if !online {
+				exitCode = 1
+			}
+		}
+		writeCSV(replies)
+		os.Exit(exitCode)
+	}
+	for _, t := range targets {
+		if !*rawFlag {
+			fmt.Printf("%s:\n", t.line)
+		}
+		online := false
+		for _, ip := range t.ips {
+			if result, ok := results[ip.String()]; ok {
+				printResult("  ", result.IP, result)
+				online = true
+			}
+		}
+		if !online {
+			printTimeout("  ")
+			exitCode = 1
+		}
+	}
+	os.Exit(exitCode)
+}
+
+// readTargets reads the targets from 'path' - or from stdin if 'path' is '-'
+func readTargets(path string) ([]target, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var targets []target
+	scanner := bufio.NewScanner(r)
+	for lineNr := 1; scanner.Scan(); lineNr++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		t, err := parseTarget(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNr, err)
+		}
+		targets = append(targets, t)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("%s: no targets found", path)
+	}
+	return targets, nil
+}
+
+// parseTarget parses a single IP or CIDR
+func parseTarget(line string) (target, error) {
+	t := target{line: line}
+	if strings.Contains(line, "/") {
+		ips, err := arping.CIDRHosts(line)
+		if err != nil {
+			return t, err
+		}
+		t.ips = ips
+	} else if ip := net.ParseIP(line); ip != nil {
+		t.ips = []net.IP{ip}
+	} else {
+		return t, fmt.Errorf("not a valid IP or CIDR: '%s'", line)
+	}
+	return t, nil
+}
+
+// jsonResult is a single line per '-jsonl'
+type jsonResult struct {
+	IP    string `json:"ip"`
+	MAC   string `json:"mac"`
+	RTT   int64  `json:"rtt_us"`
+	Iface string `json:"iface"`
+}
+
+// streamAndExit pings the targets per '-f', or the <IP> / <CIDR> parameter, and prints the replies
+// as json lines, the moment they are received
+func streamAndExit() {
+	var targets []target
+	var err error
+	if len(*fileFlag) > 0 {
+		if len(flag.Args()) != 0 {
+			fmt.Fprintln(os.Stderr, "Parameter <IP> not allowed with '-f'!")
+			printHelpAndExit()
+		}
+		targets, err = readTargets(*fileFlag)
+	} else {
+		if len(flag.Args()) != 1 {
+			fmt.Fprintln(os.Stderr, "Parameter <IP> or <CIDR> missing!")
+			printHelpAndExit()
+		}
+		var t target
+		t, err = parseTarget(flag.Arg(0))
+		targets = []target{t}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	var dstIPs []net.IP
+	for _, t := range targets {
+		dstIPs = append(dstIPs, t.ips...)
+	}
+
+	ctx, cancel := deadlineContext()
+	defer cancel()
+
+	online := make(map[string]bool)
+	encoder := json.NewEncoder(os.Stdout)
+	onResult := func(result arping.Result) {
+		online[result.IP.String()] = true
+		encoder.Encode(jsonResult{
+			IP:    result.IP.String(),
+			MAC:   result.HwAddr.String(),
+			RTT:   result.Duration.Microseconds(),
+			Iface: result.Iface,
+		})
+	}
+	if len(*ifaceNameFlag) > 0 {
+		var iface *net.Interface
+		if iface, err = net.InterfaceByName(*ifaceNameFlag); err == nil {
+			err = arping.PingManyOverIfaceStream(ctx, dstIPs, *iface, onResult, options...)
+		}
+	} else {
+		err = arping.PingManyStream(ctx, dstIPs, onResult, options...)
+	}
+	finishProgress()
+	// the replies until the interrupt are printed already
+	if interrupted(ctx) {
 		os.Exit(0)
 	}
+	if err != nil {
+		printError(os.Stderr, err)
+		os.Exit(2)
+	}
 
-	for _, result := range results {
-		fmt.Printf("%s (%s) %s usec\n", dstIP, result.HwAddr, result.Duration.String())
+	exitCode := 0
+	for _, t := range targets {
+		if !anyOnline(t, online) {
+			exitCode = 1
+		}
 	}
+	os.Exit(exitCode)
+}
 
-	os.Exit(0)
+// anyOnline returns true if at least one ip of 't' is online
+func anyOnline(t target, online map[string]bool) bool {
+	for _, ip := range t.ips {
+		if online[ip.String()] {
+			return true
+		}
+	}
+	return false
 }
 
+// printHelpAndExit prints the usage to stderr - like the flag defaults, away from the output per '-r'
 func printHelpAndExit() {
-	fmt.Printf("Usage: %s <FLAGS> <IP>\n\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage: %s <FLAGS> <IP>\n       %s <FLAGS> -f <FILE>\n       %s <FLAGS> -jsonl <IP|CIDR>\n\n",
+		os.Args[0], os.Args[0], os.Args[0])
 	flag.PrintDefaults()
-	fmt.Printf("\nExit code:\n  0: target online\n  1: target offline\n  2: error occurred\n")
+	fmt.Fprintf(os.Stderr, "\nEnvironment - used if the flag is omitted:\n  ARPING_TIMEOUT: timeout per '-t'\n"+
+		"  ARPING_IFACE: interface name per '-i'\n")
+	fmt.Fprintf(os.Stderr, "\nExit code:\n  0: target online - with '-f': all targets online - with '-D': exactly one host replied"+
+		" - interrupted per SIGINT / SIGTERM in ping mode, with '-m', '-U' and '-jsonl'\n"+
+		"  1: target offline - with '-f': at least one target offline - with '-D': duplicate address detected\n"+
+		"  2: error occurred\n")
 	os.Exit(2)
 }
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/BirknerAlex/arping-go"
+)
+
+// TestMain runs the cli itself, if the test binary is started per 'runCLI'
+func TestMain(m *testing.M) {
+	if os.Getenv("ARPING_TEST_CLI") == "1" {
+		os.Args = append([]string{"arping"}, os.Args[1:]...)
+		main()
+	}
+	os.Exit(m.Run())
+}
+
+// runCLI runs the cli with 'args' and returns its stdout, stderr and exit code
+func runCLI(t *testing.T, args ...string) (string, string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "ARPING_TEST_CLI=1")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	exitCode := 0
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			t.Fatal(err)
+		}
+		exitCode = exitErr.ExitCode()
+	}
+	return stdout.String(), stderr.String(), exitCode
+}
+
+func TestErrorsLeaveStdoutEmptyWithRaw(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"missing ip", []string{"-r"}},
+		{"invalid count", []string{"-r", "-c", "-1", "192.0.2.1"}},
+		{"gratuitous with file", []string{"-r", "-U", "-f", "-"}},
+		{"ip with file", []string{"-r", "-f", "-", "192.0.2.1"}},
+		{"invalid source ip", []string{"-r", "-s", "invalid", "192.0.2.1"}},
+		{"unknown interface", []string{"-r", "-i", "does-not-exist", "192.0.2.1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, exitCode := runCLI(t, tt.args...)
+			if exitCode != 2 {
+				t.Errorf("exit code 2 expected, but got: %d", exitCode)
+			}
+			if stdout != "" {
+				t.Errorf("empty stdout expected, but got: %q", stdout)
+			}
+			if stderr == "" {
+				t.Errorf("the error on stderr expected")
+			}
+		})
+	}
+}
+
+func TestProbeSpacesTheProbes(t *testing.T) {
+	var sendTimes []time.Time
+	ping := func(ctx context.Context) ([]arping.Result, error) {
+		sendTimes = append(sendTimes, time.Now())
+		// the ping waits for further replies - a part of the interval
+		time.Sleep(10 * time.Millisecond)
+		return []arping.Result{{}}, nil
+	}
+
+	replies, sent, err := probe(context.Background(), 3, 20*time.Millisecond, ping, func([]arping.Result) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent != 3 || len(replies) != 3 {
+		t.Fatalf("3 probes and replies expected, but got: %d / %d", sent, len(replies))
+	}
+	for i := 1; i < len(sendTimes); i++ {
+		if gap := sendTimes[i].Sub(sendTimes[i-1]); gap < 20*time.Millisecond || gap >= 40*time.Millisecond {
+			t.Errorf("probe %d sent %s after the previous one - the interval expected", i, gap)
+		}
+	}
+}
+
+func TestProbeStopsAtDeadline(t *testing.T) {
+	ping := func(ctx context.Context) ([]arping.Result, error) {
+		return nil, arping.ErrTimeout
+	}
+
+	// per '-c 10 -w 120ms' - the deadline passes long before the last probe
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	replies, sent, err := probe(ctx, 10, 50*time.Millisecond, ping, func([]arping.Result) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the deadline should cut the probes short, but they took: %s", elapsed)
+	}
+	if sent == 0 || sent >= 10 || len(replies) != 0 {
+		t.Errorf("a part of the probes without replies expected, but sent: %d, got: %d", sent, len(replies))
+	}
+}
@@ -0,0 +1,44 @@
+package arping
+
+import (
+	"fmt"
+	"net"
+)
+
+// CraftAndSend sends a single arp datagram over interface 'iface' - built exactly from the given fields.
+//
+// 'srcMac' and 'srcIP' are the sender addresses, 'dstMac' and 'dstIP' the target addresses, 'op' the operation
+// such as 1 for a request and 2 for a reply. The ethernet frame goes from 'srcMac' to 'dstMac'.
+// Nothing is taken from the interface - spoofed senders are sent as given.
+//
+// This is intended for authorized security testing only. Spoofed arps can redirect or interrupt the traffic
+// of other hosts - the caller is responsible for holding the permission of the network owner
+// and for complying with the law. Requires the privileges of 'SendRaw'.
+func CraftAndSend(iface net.Interface, srcMac net.HardwareAddr, srcIP net.IP, dstMac net.HardwareAddr, dstIP net.IP,
+	op uint16) error {
+	if err := validateIP(srcIP); err != nil {
+		return err
+	}
+	if err := validateIP(dstIP); err != nil {
+		return err
+	}
+	for _, mac := range []net.HardwareAddr{srcMac, dstMac} {
+		if len(mac) != 6 {
+			return fmt.Errorf("not a valid ethernet address: '%s'", mac)
+		}
+	}
+
+	datagram := newArpRequest(srcMac, srcIP, dstMac, dstIP)
+	datagram.oper = op
+
+	sock, err := openSocket(iface, newConfig(nil))
+	if err != nil {
+		return err
+	}
+	defer sock.deinitialize()
+
+	verboseLog.Printf("crafted arp over interface: %s - op: %d, sender: '%s' / '%s', target: '%s' / '%s'\n",
+		iface.Name, op, srcMac, srcIP, dstMac, dstIP)
+	_, err = sock.send(datagram)
+	return err
+}
@@ -0,0 +1,39 @@
+package arping
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestCraftAndSend(t *testing.T) {
+	sock := newFakeSocket(nil)
+	useFakeSocket(t, sock)
+
+	srcMac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	dstMac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+	srcIP, dstIP := net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")
+	if err := CraftAndSend(loopbackInterface(t), srcMac, srcIP, dstMac, dstIP, responseOper); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := sock.sentDatagrams()
+	if len(sent) != 1 {
+		t.Fatalf("one datagram expected, but sent: %d", len(sent))
+	}
+	d := sent[0]
+	if d.oper != responseOper || !bytes.Equal(d.sha, srcMac) || !d.SenderIP().Equal(srcIP) ||
+		!bytes.Equal(d.tha, dstMac) || !d.TargetIP().Equal(dstIP) {
+		t.Errorf("datagram with the given fields expected, but sent: %+v", d)
+	}
+	if frame := d.MarshalWithEthernetHeader(); !bytes.Equal(frame[:6], dstMac) || !bytes.Equal(frame[6:12], srcMac) {
+		t.Errorf("ethernet frame from '%s' to '%s' expected, but got: % x", srcMac, dstMac, frame[:12])
+	}
+	if !sock.closed {
+		t.Error("socket expected to be closed")
+	}
+
+	if err := CraftAndSend(loopbackInterface(t), srcMac[:3], srcIP, dstMac, dstIP, requestOper); err == nil {
+		t.Error("invalid sender hardware address should be rejected")
+	}
+}
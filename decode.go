@@ -0,0 +1,100 @@
+package arping
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+const (
+	etherTypeArp  = 0x0806
+	etherTypeVlan = 0x8100
+
+	// ethernetHeaderLen is the length of the ethernet header - without 802.1Q tag
+	ethernetHeaderLen = 14
+	// maxEthernetFrameSize is the maximum size of an ethernet frame with 802.1Q tag - without the frame check sequence
+	maxEthernetFrameSize = 1518
+)
+
+// ARPPacket is an arp packet decoded per 'DecodeARP'
+type ARPPacket struct {
+	// EthernetDst and EthernetSrc are the addresses of the ethernet header
+	EthernetDst net.HardwareAddr
+	EthernetSrc net.HardwareAddr
+
+	HardwareType uint16
+	ProtocolType uint16
+	// Oper is the arp operation - 1 for requests, 2 for replies
+	Oper      uint16
+	SenderMac net.HardwareAddr
+	SenderIP  net.IP
+	TargetMac net.HardwareAddr
+	TargetIP  net.IP
+}
+
+// DecodeARP decodes the arp packet in the ethernet frame 'frame' - without the frame check sequence.
+//
+// Truncated frames, and frames larger than the ethernet maximum are always rejected.
+// Strict decoding accepts ethernet / ipv4 packets only: hardware type 1 with 6 byte addresses,
+// protocol type 0x0800 with 4 byte addresses, and the operations request or reply.
+// Lenient decoding accepts any types and address lengths - and frames with 802.1Q tag.
+// The returned errors wrap 'ErrInvalidArp'. The addresses of the packet refer to 'frame'.
+func DecodeARP(frame []byte, lenient bool) (*ARPPacket, error) {
+	if len(frame) > maxEthernetFrameSize {
+		return nil, fmt.Errorf("%w: %d bytes - larger than an ethernet frame", ErrInvalidArp, len(frame))
+	}
+	if len(frame) < ethernetHeaderLen {
+		return nil, fmt.Errorf("%w: %d bytes - shorter than the ethernet header", ErrInvalidArp, len(frame))
+	}
+
+	headerLen := ethernetHeaderLen
+	etherType := binary.BigEndian.Uint16(frame[12:14])
+	if lenient && etherType == etherTypeVlan {
+		if len(frame) < ethernetHeaderLen+4 {
+			return nil, fmt.Errorf("%w: %d bytes - shorter than the tagged ethernet header", ErrInvalidArp, len(frame))
+		}
+		headerLen += 4
+		etherType = binary.BigEndian.Uint16(frame[16:18])
+	}
+	if etherType != etherTypeArp {
+		return nil, fmt.Errorf("%w: ether type %#04x", ErrInvalidArp, etherType)
+	}
+
+	datagram, err := parseArpDatagram(frame[headerLen:])
+	if err != nil {
+		return nil, err
+	}
+	if !lenient {
+		if err := datagram.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &ARPPacket{
+		EthernetDst:  net.HardwareAddr(frame[0:6:6]),
+		EthernetSrc:  net.HardwareAddr(frame[6:12:12]),
+		HardwareType: datagram.htype,
+		ProtocolType: datagram.ptype,
+		Oper:         datagram.oper,
+		SenderMac:    datagram.SenderMac(),
+		SenderIP:     datagram.SenderIP(),
+		TargetMac:    net.HardwareAddr(datagram.tha),
+		TargetIP:     datagram.TargetIP(),
+	}, nil
+}
+
+// validate returns an error wrapping 'ErrInvalidArp', if 'datagram' isn't an ethernet / ipv4 request or reply
+func (datagram arpDatagram) validate() error {
+	if datagram.htype != 1 || datagram.hlen != 6 {
+		return fmt.Errorf("%w: hardware type %d with %d byte addresses - ethernet expected",
+			ErrInvalidArp, datagram.htype, datagram.hlen)
+	}
+	if datagram.ptype != 0x0800 || datagram.plen != 4 {
+		return fmt.Errorf("%w: protocol type %#04x with %d byte addresses - ipv4 expected",
+			ErrInvalidArp, datagram.ptype, datagram.plen)
+	}
+	if datagram.oper != requestOper && datagram.oper != responseOper {
+		return fmt.Errorf("%w: operation %d - request or reply expected", ErrInvalidArp, datagram.oper)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package arping
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+// validArpFrame returns a padded ethernet frame with an arp request from 192.168.1.1 to 192.168.1.2
+func validArpFrame() []byte {
+	return newArpRequest(net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}, net.ParseIP("192.168.1.1"),
+		BroadcastMAC(), net.ParseIP("192.168.1.2")).MarshalWithEthernetHeader()
+}
+
+// vlanTagged inserts an 802.1Q tag into 'frame'
+func vlanTagged(frame []byte) []byte {
+	tagged := append([]byte(nil), frame[:12]...)
+	tagged = append(tagged, 0x81, 0x00, 0x00, 0x2a)
+	return append(tagged, frame[12:]...)
+}
+
+func TestDecodeARP(t *testing.T) {
+	packet, err := DecodeARP(validArpFrame(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packet.Oper != requestOper || packet.SenderMac.String() != "02:00:00:00:00:01" ||
+		!packet.SenderIP.Equal(net.ParseIP("192.168.1.1")) || !packet.TargetIP.Equal(net.ParseIP("192.168.1.2")) ||
+		packet.EthernetDst.String() != BroadcastMAC().String() {
+		t.Errorf("unexpected packet: %+v", packet)
+	}
+
+	badType := validArpFrame()
+	badType[14+1] = 6 // hardware type: ieee 802
+	badOper := validArpFrame()
+	badOper[14+7] = 9
+
+	tests := []struct {
+		name    string
+		frame   []byte
+		lenient bool
+		valid   bool
+	}{
+		{"truncated header", validArpFrame()[:10], true, false},
+		{"truncated addresses", validArpFrame()[:30], true, false},
+		{"oversized", append(validArpFrame(), make([]byte, maxEthernetFrameSize)...), true, false},
+		{"no arp", append(append([]byte(nil), validArpFrame()[:12]...), 0x08, 0x00), true, false},
+		{"hardware type strict", badType, false, false},
+		{"hardware type lenient", badType, true, true},
+		{"operation strict", badOper, false, false},
+		{"operation lenient", badOper, true, true},
+		{"vlan strict", vlanTagged(validArpFrame()), false, false},
+		{"vlan lenient", vlanTagged(validArpFrame()), true, true},
+	}
+	for _, test := range tests {
+		_, err := DecodeARP(test.frame, test.lenient)
+		if test.valid && err != nil {
+			t.Errorf("%s: decoded expected, but got: %v", test.name, err)
+		}
+		if !test.valid && !errors.Is(err, ErrInvalidArp) {
+			t.Errorf("%s: ErrInvalidArp expected, but got: %v", test.name, err)
+		}
+	}
+}
+
+func FuzzDecodeARP(f *testing.F) {
+	valid := validArpFrame()
+	f.Add(valid, false)
+	f.Add(valid, true)
+	f.Add(vlanTagged(valid), true)
+	f.Add(valid[:10], false)
+	f.Add(valid[:30], true)
+	f.Add(append(valid[:18:18], 0xff, 0xff), true)
+	f.Add(make([]byte, maxEthernetFrameSize+1), true)
+	f.Fuzz(func(t *testing.T, frame []byte, lenient bool) {
+		packet, err := DecodeARP(frame, lenient)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidArp) {
+				t.Errorf("ErrInvalidArp expected, but got: %v", err)
+			}
+			return
+		}
+		if len(frame) > maxEthernetFrameSize {
+			t.Errorf("oversized frame of %d bytes decoded", len(frame))
+		}
+		if !lenient && (len(packet.SenderMac) != 6 || len(packet.SenderIP) != 4) {
+			t.Errorf("strict decoding accepted: %+v", packet)
+		}
+	})
+}
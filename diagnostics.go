@@ -0,0 +1,217 @@
+package arping
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// MACLearningTime measures the time from a gratuitous arp until a unicast arp ping to 'dstMac' / 'dstIP'
+// gets replied - a diagnostic tool for the mac table learning latency of switches.
+//
+// The gratuitous arp is sent from our address in the network of 'dstIP'.
+// The unicast pings are sent right after it, each waiting up to 'interval' for a reply - regardless of the probe
+// timeout per 'WithTimeout' or 'WithProbeTimeout', so learning times beyond it get measured as well.
+// The pings are repeated until 'ctx' is done or the deadline per 'WithDeadline' passed - without both of them,
+// until a ping got replied. Returns 'ErrTimeout' if no ping got replied until the deadline.
+func MACLearningTime(ctx context.Context, dstIP net.IP, dstMac net.HardwareAddr, iface net.Interface,
+	interval time.Duration, opts ...Option) (time.Duration, error) {
+	if err := validateIP(dstIP); err != nil {
+		return 0, err
+	}
+	cfg := newConfig(opts)
+
+	ctx, cancel := cfg.withOverallDeadline(ctx)
+	defer cancel()
+	deadline, hasDeadline := ctx.Deadline()
+
+	var srcIP net.IP
+	err := inNetNS(cfg.netns, func() (err error) {
+		srcIP, err = cfg.srcIP(dstIP, iface)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := GratuitousArpOverIface(srcIP, iface, opts...); err != nil {
+		return 0, err
+	}
+	start := time.Now()
+
+	for ctx.Err() == nil {
+		probeTimeout := interval
+		if remaining := time.Until(deadline); hasDeadline && remaining < probeTimeout {
+			probeTimeout = remaining
+		}
+
+		_, err := PingFirstOverIface(dstIP, iface, appendOptions(opts, WithTimeout(probeTimeout),
+			WithProbeTimeout(probeTimeout), withUnicast(dstMac))...)
+		if err == nil {
+			learningTime := time.Since(start)
+			verboseLog.Printf("mac learning time for '%s' (%s): %s\n", dstIP, dstMac, learningTime)
+			return learningTime, nil
+		}
+		if err != ErrTimeout {
+			return 0, err
+		}
+	}
+
+	if ctx.Err() == context.Canceled {
+		return 0, ctx.Err()
+	}
+	return 0, ErrTimeout
+}
+
+// VerifyNeighborLearned checks if the neighbor 'neighborMac' resolves 'ip' to 'expectedMac'
+// - such as after announcing a VIP per 'GratuitousArp'.
+//
+// It sends a unicast arp request for 'ip' to 'neighborMac' over interface 'iface'
+// and returns true if a reply points to 'expectedMac'. Returns 'ErrTimeout' if no reply was received.
+//
+// Limits: only the single neighbor 'neighborMac' is checked, and only neighbors which answer requests
+// for foreign addresses reveal their cache this way - such as routers with proxy arp or switches
+// with arp suppression. Other hosts ignore the request, or the current owner of 'ip' answers itself.
+func VerifyNeighborLearned(ip net.IP, expectedMac net.HardwareAddr, neighborMac net.HardwareAddr, iface net.Interface,
+	opts ...Option) (bool, error) {
+	// the replies point to other hardware addresses than 'neighborMac' by design - no 'PingUnicast'
+	results, err := PingOverIfaceContext(context.Background(), ip, iface, appendOptions(opts, withUnicast(neighborMac))...)
+	if err != nil {
+		return false, err
+	}
+	for _, result := range results {
+		if bytes.Equal(result.HwAddr, expectedMac) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// DetectDuplicateIP pings 'dstIP' and returns one result per distinct hardware address which replied
+// - more than one result means 'dstIP' is in use by multiple hosts.
+//
+// All replies until the timeout are collected - don't combine it with 'WithQuietPeriod' or 'WithMaxResults',
+// as they would hide late duplicates. Returns 'ErrTimeout' if nobody replied.
+func DetectDuplicateIP(dstIP net.IP, opts ...Option) ([]Result, error) {
+	return DetectDuplicateIPContext(context.Background(), dstIP, opts...)
+}
+
+// DetectDuplicateIPContext is like 'DetectDuplicateIP' - with the deadline from 'ctx', see 'PingOverIfaceContext'
+func DetectDuplicateIPContext(ctx context.Context, dstIP net.IP, opts ...Option) ([]Result, error) {
+	results, err := PingContext(ctx, dstIP, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return distinctHwAddrs(results), nil
+}
+
+// DetectDuplicateIPOverIfaceContext is like 'DetectDuplicateIPContext' - over interface 'iface'
+func DetectDuplicateIPOverIfaceContext(ctx context.Context, dstIP net.IP, iface net.Interface, opts ...Option) ([]Result, error) {
+	results, err := PingOverIfaceContext(ctx, dstIP, iface, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return distinctHwAddrs(results), nil
+}
+
+// distinctHwAddrs returns the first result per hardware address
+func distinctHwAddrs(results []Result) []Result {
+	seen := make(map[string]bool)
+	var distinct []Result
+	for _, result := range results {
+		if key := result.Key(); !seen[key] {
+			seen[key] = true
+			distinct = append(distinct, result)
+		}
+	}
+	return distinct
+}
+
+// DetectFlux pings 'dstIP' over interface 'iface' 'samples' times - with 'interval' between them - and returns
+// the distinct hardware addresses which replied, in the order they were first seen. More than one means arp flux,
+// such as on bonded or multipath hosts answering from a different interface over time.
+//
+// Unlike 'DetectDuplicateIP' it samples over time: every sample collects the replies until the timeout.
+// Returns 'ErrTimeout' if no sample got replied - or the error from 'ctx' with the addresses seen until then.
+func DetectFlux(ctx context.Context, dstIP net.IP, iface net.Interface, samples int, interval time.Duration,
+	opts ...Option) ([]net.HardwareAddr, error) {
+	if samples < 1 {
+		return nil, fmt.Errorf("invalid samples: %d - at least one expected", samples)
+	}
+
+	seen := make(map[string]bool)
+	var macs []net.HardwareAddr
+	for i := 0; i < samples; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(interval):
+			case <-ctx.Done():
+				return macs, ctx.Err()
+			}
+		}
+
+		results, err := PingOverIfaceContext(ctx, dstIP, iface, opts...)
+		if ctx.Err() != nil {
+			return macs, ctx.Err()
+		}
+		if err != nil && err != ErrTimeout {
+			return macs, err
+		}
+		for _, result := range results {
+			if key := result.HwAddr.String(); !seen[key] {
+				seen[key] = true
+				macs = append(macs, result.HwAddr)
+			}
+		}
+	}
+	if len(macs) == 0 {
+		return nil, ErrTimeout
+	}
+	return macs, nil
+}
+
+// CheckInterface checks that arp works over interface 'iface' - a preflight to fail fast on misconfigured interfaces.
+//
+// The interface must be up with a link, and an ethernet interface. Then the socket gets opened and an arp probe
+// sent from 0.0.0.0 for the first v4 address of 'iface' (RFC 5227) - so it emits one frame, which updates no arp
+// cache. No probe is sent without a v4 address, and no reply is awaited. The socket is closed on return.
+// Returns 'ErrInterfaceDown', 'ErrUnsupportedInterface' or 'ErrInsufficientPrivilege' - wrapped with the details.
+func CheckInterface(iface net.Interface, opts ...Option) error {
+	if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagRunning == 0 {
+		return fmt.Errorf("%w: '%s' (%s)", ErrInterfaceDown, iface.Name, iface.Flags)
+	}
+	cfg := newConfig(opts)
+	srcMac := cfg.srcMac(iface)
+	if len(srcMac) != 6 || iface.Flags&(net.FlagLoopback|net.FlagPointToPoint) != 0 {
+		return fmt.Errorf("%w: '%s' (%s)", ErrUnsupportedInterface, iface.Name, iface.Flags)
+	}
+	if err := cfg.checkMTU(iface); err != nil {
+		return err
+	}
+
+	var ips []net.IP
+	var sock socket
+	err := inNetNS(cfg.netns, func() (err error) {
+		if ips, _, err = LocalAddresses(iface); err != nil {
+			return err
+		}
+		sock, err = openSocket(iface, cfg)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("interface '%s': %w", iface.Name, err)
+	}
+	defer sock.deinitialize()
+
+	if len(ips) == 0 {
+		verboseLog.Printf("interface '%s' has no v4 address - no probe sent\n", iface.Name)
+		return nil
+	}
+	probe := cfg.newArpRequest(srcMac, net.IPv4zero, cfg.dstMac(), ips[0])
+	if _, err := sock.send(probe); err != nil {
+		return fmt.Errorf("unable to send over interface '%s': %w", iface.Name, privilegeError(err))
+	}
+	return nil
+}
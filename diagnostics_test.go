@@ -0,0 +1,217 @@
+package arping
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestMACLearningTime(t *testing.T) {
+	dstMac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	unicastPings := 0
+	sock := newFakeSocket(func(request arpDatagram) []arpDatagram {
+		if !bytes.Equal(request.tha, dstMac) {
+			// the gratuitous arp
+			return nil
+		}
+		// learned after the third ping
+		if unicastPings++; unicastPings < 3 {
+			return nil
+		}
+		return []arpDatagram{newArpReply(request, dstMac)}
+	})
+	useFakeSocket(t, sock)
+
+	learningTime, err := MACLearningTime(context.Background(), net.ParseIP("127.0.0.2"), dstMac,
+		loopbackInterface(t), 20*time.Millisecond, WithTimeout(5*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if learningTime < 40*time.Millisecond {
+		t.Errorf("learning time of at least two unanswered intervals expected, but got: %s", learningTime)
+	}
+
+	sent := sock.sentDatagrams()
+	if len(sent) != 4 {
+		t.Fatalf("one gratuitous arp and three unicast pings expected, but sent: %d", len(sent))
+	}
+	if !sent[0].SenderIP().Equal(sent[0].TargetIP()) {
+		t.Errorf("first datagram should be the gratuitous arp")
+	}
+}
+
+func TestMACLearningTimeTimeout(t *testing.T) {
+	useFakeSocket(t, newFakeSocket(nil))
+
+	_, err := MACLearningTime(context.Background(), net.ParseIP("127.0.0.2"), net.HardwareAddr{0x02, 0, 0, 0, 0, 1},
+		loopbackInterface(t), 10*time.Millisecond, WithDeadline(time.Now().Add(50*time.Millisecond)))
+	if err != ErrTimeout {
+		t.Errorf("timeout error expected, but received: %v", err)
+	}
+}
+
+func TestMACLearningTimeBeyondProbeTimeout(t *testing.T) {
+	dstMac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	unicastPings := 0
+	useFakeSocket(t, newFakeSocket(func(request arpDatagram) []arpDatagram {
+		if !bytes.Equal(request.tha, dstMac) {
+			// the gratuitous arp
+			return nil
+		}
+		// learned after the sixth ping - long after the probe timeout
+		if unicastPings++; unicastPings < 6 {
+			return nil
+		}
+		return []arpDatagram{newArpReply(request, dstMac)}
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	learningTime, err := MACLearningTime(ctx, net.ParseIP("127.0.0.2"), dstMac, loopbackInterface(t),
+		10*time.Millisecond, WithTimeout(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if learningTime < 50*time.Millisecond {
+		t.Errorf("learning time of at least five unanswered intervals expected, but got: %s", learningTime)
+	}
+}
+
+func TestMACLearningTimeCapsProbeTimeout(t *testing.T) {
+	sock := newFakeSocket(nil)
+	useFakeSocket(t, sock)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// the probe timeout of the caller mustn't stretch a probe beyond the interval
+	_, err := MACLearningTime(ctx, net.ParseIP("127.0.0.2"), net.HardwareAddr{0x02, 0, 0, 0, 0, 1},
+		loopbackInterface(t), 10*time.Millisecond, WithProbeTimeout(time.Second))
+	if err != ErrTimeout {
+		t.Errorf("timeout error expected, but received: %v", err)
+	}
+	if sent := sock.sentDatagrams(); len(sent) < 5 {
+		t.Errorf("a unicast ping per interval expected, but sent: %d", len(sent))
+	}
+}
+
+func TestDetectDuplicateIP(t *testing.T) {
+	macA := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x0a}
+	macB := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x0b}
+	useFakeSocket(t, newFakeSocket(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{
+			newArpReply(request, macA),
+			newArpReply(request, macB),
+			newArpReply(request, macA),
+		}
+	}))
+
+	results, err := DetectDuplicateIPOverIfaceContext(context.Background(), net.ParseIP("127.0.0.2"),
+		loopbackInterface(t), WithTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("2 distinct results expected, but got: %v", results)
+	}
+	if results[0].HwAddr.String() != macA.String() || results[1].HwAddr.String() != macB.String() {
+		t.Errorf("unexpected results: %v", results)
+	}
+}
+
+func TestDetectFlux(t *testing.T) {
+	macs := []net.HardwareAddr{
+		{0x02, 0x00, 0x00, 0x00, 0x00, 0x0a},
+		{0x02, 0x00, 0x00, 0x00, 0x00, 0x0b},
+		{0x02, 0x00, 0x00, 0x00, 0x00, 0x0a},
+	}
+	sample := 0
+	useFakeSocket(t, newFakeSocket(func(request arpDatagram) []arpDatagram {
+		// the target answers from another interface over time
+		mac := macs[sample%len(macs)]
+		sample++
+		return []arpDatagram{newArpReply(request, mac)}
+	}))
+
+	seen, err := DetectFlux(context.Background(), net.ParseIP("127.0.0.2"), loopbackInterface(t), 3,
+		time.Millisecond, WithTimeout(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 2 || seen[0].String() != macs[0].String() || seen[1].String() != macs[1].String() {
+		t.Errorf("2 distinct hardware addresses expected, but got: %v", seen)
+	}
+	if sample != 3 {
+		t.Errorf("3 samples expected, but got: %d", sample)
+	}
+}
+
+func TestVerifyNeighborLearned(t *testing.T) {
+	neighborMac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	newMac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x0a}
+	oldMac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x0b}
+	learned := newMac
+	sock := newFakeSocket(func(request arpDatagram) []arpDatagram {
+		if !bytes.Equal(request.tha, neighborMac) {
+			return nil
+		}
+		// the neighbor answers with its cached entry
+		return []arpDatagram{newArpReply(request, learned)}
+	})
+	useFakeSocket(t, sock)
+
+	vip := net.ParseIP("127.0.0.10")
+	ok, err := VerifyNeighborLearned(vip, newMac, neighborMac, loopbackInterface(t), WithTimeout(20*time.Millisecond))
+	if err != nil || !ok {
+		t.Errorf("learned expected, but got: %t, %v", ok, err)
+	}
+
+	learned = oldMac
+	ok, err = VerifyNeighborLearned(vip, newMac, neighborMac, loopbackInterface(t), WithTimeout(20*time.Millisecond))
+	if err != nil || ok {
+		t.Errorf("not learned expected, but got: %t, %v", ok, err)
+	}
+}
+
+func TestCheckInterface(t *testing.T) {
+	sock := newFakeSocket(nil)
+	useFakeSocket(t, sock)
+	origAddrs := interfaceAddrs
+	interfaceAddrs = func(iface net.Interface) ([]net.Addr, error) {
+		return []net.Addr{&net.IPNet{IP: net.ParseIP("10.0.0.1"), Mask: net.CIDRMask(24, 32)}}, nil
+	}
+	t.Cleanup(func() {
+		interfaceAddrs = origAddrs
+	})
+
+	iface := net.Interface{Index: 99, Name: "eth9", HardwareAddr: net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01},
+		Flags: net.FlagUp | net.FlagRunning | net.FlagBroadcast}
+	if err := CheckInterface(iface); err != nil {
+		t.Fatal(err)
+	}
+	sent := sock.sentDatagrams()
+	if len(sent) != 1 || !sent[0].SenderIP().Equal(net.IPv4zero) || !sent[0].TargetIP().Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("one probe from 0.0.0.0 for 10.0.0.1 expected, but sent: %v", sent)
+	}
+	if !sock.closed {
+		t.Error("socket expected to be closed")
+	}
+
+	sock.sendErrs = []error{syscall.EPERM}
+	if err := CheckInterface(iface); !errors.Is(err, ErrInsufficientPrivilege) {
+		t.Errorf("'ErrInsufficientPrivilege' expected, but got: %v", err)
+	}
+
+	noLink := iface
+	noLink.Flags &^= net.FlagRunning
+	if err := CheckInterface(noLink); !errors.Is(err, ErrInterfaceDown) {
+		t.Errorf("'ErrInterfaceDown' expected without link, but got: %v", err)
+	}
+	if err := CheckInterface(loopbackInterface(t)); !errors.Is(err, ErrUnsupportedInterface) {
+		t.Errorf("'ErrUnsupportedInterface' expected for the loopback interface, but got: %v", err)
+	}
+}
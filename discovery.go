@@ -0,0 +1,369 @@
+package arping
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrDiscoveryClosed is returned by the methods of a closed 'Discovery'
+var ErrDiscoveryClosed = errors.New("discovery closed")
+
+// Discovery keeps a single socket over one interface open - for repeated pings, scans and gratuitous arps.
+//
+// All methods are safe for concurrent use by multiple goroutines: the sends are serialized on the shared socket,
+// and a background receiver dispatches every reply to all pending pings and scans it matches - so concurrent calls
+// to the same target get the replies each. A call which doesn't keep up with a flood of replies misses some of them,
+// see 'Stats'. 'Close' releases the socket: pending calls return 'ErrDiscoveryClosed', as do all later ones.
+type Discovery struct {
+	cfg   *config
+	iface net.Interface
+	sock  socket
+
+	// mu guards the waiters, the counters and the sends - the receiver can't see a waiter before its send time is set
+	mu sync.Mutex
+	// waiters are keyed by the target ip of their request - the sender ip of the replies
+	waiters map[string]map[*discoveryWaiter]struct{}
+	stats   Stats
+	err     error
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// discoveryWaiter is a ping waiting for replies
+type discoveryWaiter struct {
+	request  arpDatagram
+	sendTime time.Time
+	replies  chan Result
+	// release frees the in-flight slot of a scan request on the first reply - nil for pings
+	release func()
+}
+
+// NewDiscovery opens the socket over interface 'iface' and starts the background receiver.
+//
+// 'opts' apply to all calls - such as the timeout per ping.
+// 'WithTargetFilter' is ignored, as the socket is shared by all targets.
+func NewDiscovery(iface net.Interface, opts ...Option) (*Discovery, error) {
+	cfg := newConfig(opts)
+	if err := cfg.checkMTU(iface); err != nil {
+		return nil, err
+	}
+
+	var sock socket
+	err := inNetNS(cfg.netns, func() (err error) {
+		sock, err = openSocket(iface, cfg)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Discovery{
+		cfg:     cfg,
+		iface:   iface,
+		sock:    sock,
+		waiters: make(map[string]map[*discoveryWaiter]struct{}),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go d.receive()
+	return d, nil
+}
+
+// Ping sends an arp ping to 'dstIP' and collects the replies - see 'PingOverIfaceContext'
+func (d *Discovery) Ping(ctx context.Context, dstIP net.IP) ([]Result, error) {
+	if err := validateIP(dstIP); err != nil {
+		return nil, err
+	}
+	cfg := d.cfg
+
+	ctx, cancel := cfg.withDeadline(ctx)
+	defer cancel()
+
+	srcIP, err := cfg.srcIP(dstIP, d.iface)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &discoveryWaiter{
+		request: cfg.newArpRequest(cfg.srcMac(d.iface), srcIP, cfg.dstMac(), dstIP),
+		replies: make(chan Result, 64),
+	}
+	if err := d.register(w); err != nil {
+		return nil, err
+	}
+	defer d.unregister(w)
+
+	verboseLog.Printf("arping '%s' over interface: %s with address: '%s'\n",
+		dstIP, ifaceFingerprint(d.iface, w.request.SenderMac()), srcIP)
+	if err := d.send(w); err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, 0)
+Break:
+	for {
+		select {
+		case result := <-w.replies:
+			if cfg.storeResult(len(results)) {
+				results = append(results, result)
+			}
+		case <-d.stopped:
+			return nil, d.closeErr()
+		case <-ctx.Done():
+			break Break
+		}
+	}
+
+	if ctx.Err() == context.Canceled {
+		return nil, ctx.Err()
+	}
+	if len(results) == 0 {
+		return nil, ErrTimeout
+	}
+	return results, nil
+}
+
+// Scan sends an arp ping to every host address in 'cidr' and collects the first reply per host
+// - like 'ScanCIDROverIfaceContext': until the probe timeout after the last request, paced per 'WithRate'
+// and 'WithMaxInFlight'. Returns the results keyed by ip, empty if no host replied.
+func (d *Discovery) Scan(ctx context.Context, cidr string) (map[string]Result, error) {
+	dstIPs, err := CIDRHosts(cidr)
+	if err != nil {
+		return nil, err
+	}
+	cfg := d.cfg
+
+	ctx, cancel := cfg.withOverallDeadline(ctx)
+	defer cancel()
+
+	srcIPs, err := scanSourceIPs(dstIPs, d.iface, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// a single channel for all targets - the receiver drops the replies, which don't fit
+	replies := make(chan Result, 256)
+	srcMac := cfg.srcMac(d.iface)
+	waiters := make([]*discoveryWaiter, len(dstIPs))
+	for i, dstIP := range dstIPs {
+		waiters[i] = &discoveryWaiter{request: cfg.newArpRequest(srcMac, srcIPs[i], cfg.dstMac(), dstIP), replies: replies}
+	}
+	if err := d.register(waiters...); err != nil {
+		return nil, err
+	}
+	defer d.unregister(waiters...)
+
+	verboseLog.Printf("scan '%s' over interface: %s\n", cidr, ifaceFingerprint(d.iface, srcMac))
+	limiter := newScanLimiter(cfg)
+	sendErr := make(chan error, 1)
+	go func() {
+		for _, w := range waiters {
+			if err := limiter.acquire(ctx); err != nil {
+				break
+			}
+			w.release = limiter.sent()
+			if err := d.send(w); err != nil {
+				w.release()
+				sendErr <- err
+				return
+			}
+		}
+		sendErr <- nil
+	}()
+
+	results := make(map[string]Result)
+	sending := true
+	// fires at the probe timeout after the last request
+	var wait <-chan time.Time
+	for {
+		select {
+		case result := <-replies:
+			if _, seen := results[result.IP.String()]; !seen {
+				results[result.IP.String()] = result
+			}
+		case err := <-sendErr:
+			sending = false
+			if err != nil {
+				return nil, err
+			}
+			timer := time.NewTimer(cfg.effectiveProbeTimeout())
+			defer timer.Stop()
+			wait = timer.C
+		case <-wait:
+			return results, nil
+		case <-d.stopped:
+			cancel()
+			if sending {
+				<-sendErr
+			}
+			return nil, d.closeErr()
+		case <-ctx.Done():
+			if sending {
+				<-sendErr
+			}
+			if ctx.Err() == context.Canceled {
+				return nil, ctx.Err()
+			}
+			return results, nil
+		}
+	}
+}
+
+// GratuitousArp sends a gratuitous arp from 'srcIP'
+func (d *Discovery) GratuitousArp(srcIP net.IP) error {
+	if err := validateIP(srcIP); err != nil {
+		return err
+	}
+
+	request := d.cfg.newArpRequest(d.cfg.srcMac(d.iface), srcIP, BroadcastMAC(), srcIP)
+	verboseLog.Printf("gratuitous arp over interface: %s with address: '%s'\n",
+		ifaceFingerprint(d.iface, request.SenderMac()), srcIP)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// checked under the lock - 'Close' mustn't release the socket during the send
+	if d.err != nil {
+		return d.err
+	}
+	_, err := d.sock.send(request)
+	return err
+}
+
+// Stats returns the statistics since 'NewDiscovery' - also after 'Close'. 'Stats.Replies' counts the replies
+// dispatched to the pings and scans, 'Stats.Dropped' the ones dropped as a call didn't keep up with them.
+func (d *Discovery) Stats() Stats {
+	d.mu.Lock()
+	stats := d.stats
+	d.mu.Unlock()
+
+	stats.Socket = d.SocketStats()
+	return stats
+}
+
+// SocketStats returns the frame counters of the socket since 'NewDiscovery' - also after 'Close'
+func (d *Discovery) SocketStats() SocketStats {
+	return socketStatsOf(d.sock)
+}
+
+// Close stops the background receiver and closes the socket
+func (d *Discovery) Close() error {
+	d.mu.Lock()
+	if d.err == ErrDiscoveryClosed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.err = ErrDiscoveryClosed
+	d.mu.Unlock()
+
+	close(d.done)
+	<-d.stopped
+	return d.sock.deinitialize()
+}
+
+func (d *Discovery) register(waiters ...*discoveryWaiter) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return d.err
+	}
+	for _, w := range waiters {
+		key := string(w.request.tpa)
+		if d.waiters[key] == nil {
+			d.waiters[key] = make(map[*discoveryWaiter]struct{})
+		}
+		d.waiters[key][w] = struct{}{}
+	}
+	return nil
+}
+
+func (d *Discovery) unregister(waiters ...*discoveryWaiter) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, w := range waiters {
+		key := string(w.request.tpa)
+		delete(d.waiters[key], w)
+		if len(d.waiters[key]) == 0 {
+			delete(d.waiters, key)
+		}
+	}
+}
+
+func (d *Discovery) send(w *discoveryWaiter) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return d.err
+	}
+	sendTime, err := d.sock.send(w.request)
+	w.sendTime = sendTime
+	return err
+}
+
+// closeErr returns the error, which stopped the discovery - nil while it's running
+func (d *Discovery) closeErr() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.err
+}
+
+// receive dispatches the received replies to the waiting pings - until 'Close' or a receive error
+func (d *Discovery) receive() {
+	defer close(d.stopped)
+
+	for {
+		select {
+		case <-d.done:
+			return
+		default:
+		}
+
+		response, receiveTime, err := d.sock.receive(time.Now().Add(pollInterval))
+		if err == ErrTimeout {
+			continue
+		}
+		if err != nil {
+			d.mu.Lock()
+			if d.err == nil {
+				d.err = err
+			}
+			d.mu.Unlock()
+			return
+		}
+
+		d.mu.Lock()
+		if d.cfg.matchByMACOnly {
+			// the replies may come from any sender ip
+			for _, waiters := range d.waiters {
+				d.dispatch(response, receiveTime, waiters)
+			}
+		} else {
+			d.dispatch(response, receiveTime, d.waiters[string(response.spa)])
+		}
+		d.mu.Unlock()
+	}
+}
+
+// dispatch passes 'response' to the matching ones of 'waiters' - with 'mu' held
+func (d *Discovery) dispatch(response arpDatagram, receiveTime time.Time, waiters map[*discoveryWaiter]struct{}) {
+	for w := range waiters {
+		if w.sendTime.IsZero() || !d.cfg.isResponse(response, w.request) {
+			continue
+		}
+		verboseLog.Printf("process received arp: srcIP: '%s', srcMac: '%s'\n",
+			response.SenderIP(), response.SenderMac())
+		if w.release != nil {
+			w.release()
+		}
+		select {
+		case w.replies <- newResult(response, w.request, receiveTime.Sub(w.sendTime), d.iface):
+			d.stats.Replies++
+		default:
+			// the call doesn't keep up with a flood of replies
+			d.stats.Dropped++
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package arping
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDiscoveryInterleavesPingAndGratuitousArp(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	sock := newFakeSocket(func(request arpDatagram) []arpDatagram {
+		if request.SenderIP().Equal(request.TargetIP()) {
+			// the gratuitous arp
+			return nil
+		}
+		return []arpDatagram{newArpReply(request, mac)}
+	})
+	useFakeSocket(t, sock)
+
+	d, err := NewDiscovery(loopbackInterface(t), WithTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vip := net.ParseIP("127.0.0.10")
+	for i := 0; i < 2; i++ {
+		if err := d.GratuitousArp(vip); err != nil {
+			t.Fatal(err)
+		}
+		results, err := d.Ping(context.Background(), net.ParseIP("127.0.0.2"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || !bytes.Equal(results[0].HwAddr, mac) {
+			t.Errorf("one result from '%s' expected, but got: %v", mac, results)
+		}
+	}
+
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !sock.closed {
+		t.Error("socket not closed")
+	}
+	if sent := sock.sentDatagrams(); len(sent) != 4 {
+		t.Errorf("4 sent datagrams over the single socket expected, but got: %d", len(sent))
+	}
+	if _, err := d.Ping(context.Background(), net.ParseIP("127.0.0.2")); err != ErrDiscoveryClosed {
+		t.Errorf("'ErrDiscoveryClosed' expected, but got: %v", err)
+	}
+}
+
+func TestDiscoveryConcurrentUse(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	useFakeSocket(t, newFakeSocket(func(request arpDatagram) []arpDatagram {
+		if request.SenderIP().Equal(request.TargetIP()) {
+			return nil
+		}
+		return []arpDatagram{newArpReply(request, mac)}
+	}))
+
+	d, err := NewDiscovery(loopbackInterface(t), WithTimeout(30*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 64)
+	for i := 0; i < 8; i++ {
+		wg.Add(3)
+		dstIP := net.IPv4(127, 0, 0, byte(2+i))
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 3; j++ {
+				results, err := d.Ping(context.Background(), dstIP)
+				if err != nil {
+					errs <- err
+					return
+				}
+				for _, result := range results {
+					if !result.IP.Equal(dstIP) {
+						errs <- errors.New("reply of another target: " + result.IP.String())
+						return
+					}
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			results, err := d.Scan(context.Background(), "127.0.0.16/29")
+			if err != nil {
+				errs <- err
+				return
+			}
+			if len(results) != 6 {
+				errs <- errors.New("6 scan results expected, but got: " + strconv.Itoa(len(results)))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 3; j++ {
+				if err := d.GratuitousArp(net.ParseIP("127.0.0.10")); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// calls racing with the close end with 'ErrDiscoveryClosed'
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := d.Ping(context.Background(), net.ParseIP("127.0.0.2")); err != nil && err != ErrDiscoveryClosed {
+				t.Errorf("'ErrDiscoveryClosed' expected, but got: %v", err)
+			}
+		}()
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	if _, err := d.Scan(context.Background(), "127.0.0.16/29"); err != ErrDiscoveryClosed {
+		t.Errorf("'ErrDiscoveryClosed' expected, but got: %v", err)
+	}
+	if err := d.GratuitousArp(net.ParseIP("127.0.0.10")); err != ErrDiscoveryClosed {
+		t.Errorf("'ErrDiscoveryClosed' expected, but got: %v", err)
+	}
+}
+
+func TestDiscoveryScanWaitsProbeTimeoutAfterLastRequest(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	sock := newFakeSocket(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{newArpReply(request, mac)}
+	})
+	useFakeSocket(t, sock)
+
+	// the requests take 50ms - longer than the probe timeout
+	d, err := NewDiscovery(loopbackInterface(t), WithTimeout(20*time.Millisecond), WithRate(100), WithMaxInFlight(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	start := time.Now()
+	results, err := d.Scan(context.Background(), "127.0.0.16/29")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 6 {
+		t.Errorf("6 results expected, but got: %d", len(results))
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("requests paced per 'WithRate' expected, but the scan took: %s", elapsed)
+	}
+	if stats := d.Stats(); stats.Replies != 6 || stats.Dropped != 0 {
+		t.Errorf("6 dispatched replies expected, but got: %+v", stats)
+	}
+}
+
+func TestDiscoveryCountsDroppedReplies(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	d := &Discovery{cfg: newConfig(nil), waiters: make(map[string]map[*discoveryWaiter]struct{})}
+	request := newArpRequest(mac, net.ParseIP("127.0.0.1"), BroadcastMAC(), net.ParseIP("127.0.0.2"))
+	w := &discoveryWaiter{request: request, sendTime: time.Now(), replies: make(chan Result, 1)}
+	other := &discoveryWaiter{request: newArpRequest(mac, net.ParseIP("127.0.0.1"), BroadcastMAC(), net.ParseIP("127.0.0.3")),
+		sendTime: time.Now(), replies: make(chan Result, 1)}
+	if err := d.register(w, other); err != nil {
+		t.Fatal(err)
+	}
+
+	reply := newArpReply(request, net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02})
+	for i := 0; i < 3; i++ {
+		d.dispatch(reply, time.Now(), d.waiters[string(reply.spa)])
+	}
+	if d.stats.Replies != 1 || d.stats.Dropped != 2 {
+		t.Errorf("1 dispatched and 2 dropped replies expected, but got: %+v", d.stats)
+	}
+	if len(other.replies) != 0 {
+		t.Error("no reply expected for the waiter of another target")
+	}
+}
@@ -0,0 +1,113 @@
+package arping
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// EventType of an 'Event'
+type EventType int
+
+const (
+	// EventInterfaceSelected - the interface to ping over is selected, see 'Event.Interface'
+	EventInterfaceSelected EventType = iota
+	// EventSourceIPSelected - the source ip of the request is selected, see 'Event.SourceIP'
+	EventSourceIPSelected
+	// EventRequestSent - the arp request is sent
+	EventRequestSent
+	// EventReplyReceived - an arp datagram is received, see 'Event.Result' and 'Event.Matched'
+	EventReplyReceived
+	// EventTimeout - no reply was received until the timeout
+	EventTimeout
+	// EventError - the ping failed, see 'Event.Err'
+	EventError
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventInterfaceSelected:
+		return "interface-selected"
+	case EventSourceIPSelected:
+		return "source-ip-selected"
+	case EventRequestSent:
+		return "request-sent"
+	case EventReplyReceived:
+		return "reply-received"
+	case EventTimeout:
+		return "timeout"
+	case EventError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// Event of the ping lifecycle - see 'PingWithEvents'
+type Event struct {
+	Type EventType
+	Time time.Time
+	// Interface is set for 'EventInterfaceSelected'
+	Interface *net.Interface
+	// SourceIP is set for 'EventSourceIPSelected' and 'EventRequestSent'
+	SourceIP net.IP
+	// Result is set for 'EventReplyReceived' - the duration is the time since the request was sent
+	Result *Result
+	// Matched is true if the received datagram is a reply to the request - false for an ignored datagram
+	Matched bool
+	// Err is set for 'EventError'
+	Err error
+}
+
+// PingWithEvents sends an arp ping over interface 'iface' to 'dstIP' - see 'PingWithEventsContext'
+func PingWithEvents(dstIP net.IP, iface net.Interface, events chan<- Event, opts ...Option) ([]Result, error) {
+	return PingWithEventsContext(context.Background(), dstIP, iface, events, opts...)
+}
+
+// PingWithEventsContext sends an arp ping over interface 'iface' to 'dstIP', like 'PingOverIfaceContext',
+// and sends the events of its lifecycle to 'events' - closed when the call returns.
+//
+// The events are ordered: 'EventInterfaceSelected', 'EventSourceIPSelected' and 'EventRequestSent' - per sent
+// request, then an 'EventReplyReceived' per received datagram. The last event is an 'EventTimeout' when no reply
+// was received, or an 'EventError' when the ping failed. Datagrams received after that are dropped.
+//
+// The events are sent blocking, so a slow consumer delays the ping and its replies - use a buffered channel.
+func PingWithEventsContext(ctx context.Context, dstIP net.IP, iface net.Interface, events chan<- Event,
+	opts ...Option) ([]Result, error) {
+	emitter := &eventEmitter{events: events}
+	defer emitter.close()
+
+	emitter.emit(Event{Type: EventInterfaceSelected, Time: time.Now(), Interface: &iface})
+	results, err := PingOverIfaceContext(ctx, dstIP, iface, appendOptions(opts, withEvents(emitter.emit))...)
+	switch {
+	case err == ErrTimeout:
+		emitter.emit(Event{Type: EventTimeout, Time: time.Now()})
+	case err != nil:
+		emitter.emit(Event{Type: EventError, Time: time.Now(), Err: err})
+	}
+	return results, err
+}
+
+// eventEmitter sends the events to the channel until it's closed - the receiver goroutine of a ping may emit
+// further events after the ping returned
+type eventEmitter struct {
+	mu     sync.Mutex
+	events chan<- Event
+	closed bool
+}
+
+func (e *eventEmitter) emit(event Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.closed {
+		e.events <- event
+	}
+}
+
+func (e *eventEmitter) close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.closed = true
+	close(e.events)
+}
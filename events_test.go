@@ -0,0 +1,62 @@
+package arping
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPingWithEvents(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	useFakeSocket(t, newFakeSocket(func(request arpDatagram) []arpDatagram {
+		other := newArpReply(request, mac)
+		other.spa = net.ParseIP("127.0.0.9").To4()
+		return []arpDatagram{other, newArpReply(request, mac)}
+	}))
+	iface := loopbackInterface(t)
+
+	events := make(chan Event, 16)
+	results, err := PingWithEvents(net.ParseIP("127.0.0.2"), iface, events, WithTimeout(20*time.Millisecond),
+		WithSourceIP(net.ParseIP("127.0.0.1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("one result expected, but got: %v", results)
+	}
+
+	var types []EventType
+	var matched []bool
+	for event := range events {
+		types = append(types, event.Type)
+		if event.Type == EventReplyReceived {
+			matched = append(matched, event.Matched)
+		}
+		if event.Type == EventSourceIPSelected && !event.SourceIP.Equal(net.ParseIP("127.0.0.1")) {
+			t.Errorf("source ip 127.0.0.1 expected, but got: %s", event.SourceIP)
+		}
+	}
+	want := []EventType{EventInterfaceSelected, EventSourceIPSelected, EventRequestSent, EventReplyReceived,
+		EventReplyReceived}
+	if !reflect.DeepEqual(types, want) {
+		t.Errorf("events %v expected, but got: %v", want, types)
+	}
+	if !reflect.DeepEqual(matched, []bool{false, true}) {
+		t.Errorf("unmatched and matched reply expected, but got: %v", matched)
+	}
+
+	useFakeSocket(t, newFakeSocket(nil))
+	events = make(chan Event, 16)
+	if _, err := PingWithEvents(net.ParseIP("127.0.0.2"), iface, events, WithTimeout(20*time.Millisecond),
+		WithSourceIP(net.ParseIP("127.0.0.1"))); err != ErrTimeout {
+		t.Fatalf("ErrTimeout expected, but got: %v", err)
+	}
+	var last Event
+	for event := range events {
+		last = event
+	}
+	if last.Type != EventTimeout {
+		t.Errorf("timeout expected as last event, but got: %s", last.Type)
+	}
+}
@@ -0,0 +1,107 @@
+package arping
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// ErrNoDefaultRoute is returned by 'PingGateway', if no v4 default route exists
+var ErrNoDefaultRoute = errors.New("no default route found")
+
+// ErrNoRoute is returned by 'PingNextHop', if no v4 route to the destination exists
+var ErrNoRoute = errors.New("no route found")
+
+// ErrOnLink is returned by 'PingNextHop', if the destination is on-link - it has no next-hop, use 'Ping'
+var ErrOnLink = errors.New("destination is on-link - use 'Ping' instead")
+
+// readDefaultRoute returns the gateway and the interface index of the v4 default route - replaced in tests
+var readDefaultRoute = defaultRoute
+
+// readRoute returns the gateway and the interface index of the v4 route to an ip - replaced in tests
+var readRoute = routeTo
+
+// DefaultGateway returns the gateway and the egress interface of the v4 default route
+// - from the routing table per netlink under linux, per routing socket under BSD.
+// Returns 'ErrNoDefaultRoute' if none exists.
+func DefaultGateway(opts ...Option) (net.IP, *net.Interface, error) {
+	cfg := newConfig(opts)
+
+	var gateway net.IP
+	var iface *net.Interface
+	err := inNetNS(cfg.netns, func() error {
+		var ifindex int
+		var err error
+		if gateway, ifindex, err = readDefaultRoute(); err != nil {
+			return err
+		}
+		iface, err = net.InterfaceByIndex(ifindex)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return gateway, iface, nil
+}
+
+// PingGateway sends an arp ping to the gateway of the v4 default route - see 'PingGatewayContext'
+func PingGateway(opts ...Option) ([]Result, error) {
+	return PingGatewayContext(context.Background(), opts...)
+}
+
+// PingGatewayContext sends an arp ping to the gateway of the v4 default route, over its egress interface
+// - to check if the gateway is reachable at L2. See 'DefaultGateway' and 'PingOverIfaceContext'.
+func PingGatewayContext(ctx context.Context, opts ...Option) ([]Result, error) {
+	gateway, iface, err := DefaultGateway(opts...)
+	if err != nil {
+		return nil, err
+	}
+	verboseLog.Printf("default gateway: '%s' over interface: '%s'\n", gateway, iface.Name)
+	return PingOverIfaceContext(ctx, gateway, *iface, opts...)
+}
+
+// NextHop returns the gateway and the egress interface of the v4 route to 'remoteIP'
+// - the longest prefix match of the routing table, as the kernel forwards it.
+// Returns 'ErrOnLink' if 'remoteIP' is reachable without a gateway, 'ErrNoRoute' if it's unroutable.
+func NextHop(remoteIP net.IP, opts ...Option) (net.IP, *net.Interface, error) {
+	if err := validateIP(remoteIP); err != nil {
+		return nil, nil, err
+	}
+	cfg := newConfig(opts)
+
+	var gateway net.IP
+	var iface *net.Interface
+	err := inNetNS(cfg.netns, func() error {
+		var ifindex int
+		var err error
+		if gateway, ifindex, err = readRoute(remoteIP.To4()); err != nil {
+			return err
+		}
+		if gateway == nil {
+			return fmt.Errorf("%w: '%s'", ErrOnLink, remoteIP)
+		}
+		iface, err = net.InterfaceByIndex(ifindex)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return gateway, iface, nil
+}
+
+// PingNextHop sends an arp ping to the next-hop of the remote ip 'remoteIP' - see 'PingNextHopContext'
+func PingNextHop(remoteIP net.IP, opts ...Option) ([]Result, error) {
+	return PingNextHopContext(context.Background(), remoteIP, opts...)
+}
+
+// PingNextHopContext sends an arp ping to the next-hop of the remote ip 'remoteIP', over its egress interface
+// - the l2 target a packet to 'remoteIP' gets forwarded to. See 'NextHop' and 'PingOverIfaceContext'.
+func PingNextHopContext(ctx context.Context, remoteIP net.IP, opts ...Option) ([]Result, error) {
+	gateway, iface, err := NextHop(remoteIP, opts...)
+	if err != nil {
+		return nil, err
+	}
+	verboseLog.Printf("next-hop of '%s': '%s' over interface: '%s'\n", remoteIP, gateway, iface.Name)
+	return PingOverIfaceContext(ctx, gateway, *iface, opts...)
+}
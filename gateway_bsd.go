@@ -0,0 +1,101 @@
+//go:build darwin || freebsd || openbsd
+// +build darwin freebsd openbsd
+
+package arping
+
+import (
+	"net"
+	"syscall"
+)
+
+// defaultRoute reads the v4 default route per routing socket
+func defaultRoute() (net.IP, int, error) {
+	rib, err := syscall.RouteRIB(syscall.NET_RT_DUMP, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	msgs, err := syscall.ParseRoutingMessage(rib)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for _, msg := range msgs {
+		rtm, ok := msg.(*syscall.RouteMessage)
+		if !ok || rtm.Header.Flags&syscall.RTF_GATEWAY == 0 {
+			continue
+		}
+
+		sas, err := syscall.ParseRoutingSockaddr(rtm)
+		if err != nil || len(sas) <= syscall.RTAX_GATEWAY {
+			continue
+		}
+		dst, ok := sas[syscall.RTAX_DST].(*syscall.SockaddrInet4)
+		if !ok || dst.Addr != [4]byte{} {
+			continue
+		}
+		gw, ok := sas[syscall.RTAX_GATEWAY].(*syscall.SockaddrInet4)
+		if !ok {
+			continue
+		}
+		return net.IPv4(gw.Addr[0], gw.Addr[1], gw.Addr[2], gw.Addr[3]).To4(), int(rtm.Header.Index), nil
+	}
+	return nil, 0, ErrNoDefaultRoute
+}
+
+// routeTo reads the v4 route to 'dstIP' per routing socket - the longest prefix match.
+// The gateway is nil for an on-link route.
+func routeTo(dstIP net.IP) (net.IP, int, error) {
+	rib, err := syscall.RouteRIB(syscall.NET_RT_DUMP, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	msgs, err := syscall.ParseRoutingMessage(rib)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var gateway net.IP
+	var ifindex int
+	bestLen := -1
+	for _, msg := range msgs {
+		rtm, ok := msg.(*syscall.RouteMessage)
+		if !ok || rtm.Header.Flags&syscall.RTF_UP == 0 {
+			continue
+		}
+
+		sas, err := syscall.ParseRoutingSockaddr(rtm)
+		if err != nil || len(sas) <= syscall.RTAX_NETMASK {
+			continue
+		}
+		dst, ok := sas[syscall.RTAX_DST].(*syscall.SockaddrInet4)
+		if !ok {
+			continue
+		}
+		// host routes come without a netmask
+		prefixLen := 8 * net.IPv4len
+		if mask, ok := sas[syscall.RTAX_NETMASK].(*syscall.SockaddrInet4); ok && rtm.Header.Flags&syscall.RTF_HOST == 0 {
+			prefixLen, _ = net.IPMask(mask.Addr[:]).Size()
+		}
+		network := net.IPNet{IP: net.IP(dst.Addr[:]), Mask: net.CIDRMask(prefixLen, 8*net.IPv4len)}
+		if prefixLen <= bestLen || !network.Contains(dstIP) {
+			continue
+		}
+
+		var gw net.IP
+		if rtm.Header.Flags&syscall.RTF_GATEWAY != 0 {
+			sa, ok := sas[syscall.RTAX_GATEWAY].(*syscall.SockaddrInet4)
+			if !ok {
+				continue
+			}
+			gw = net.IPv4(sa.Addr[0], sa.Addr[1], sa.Addr[2], sa.Addr[3]).To4()
+		}
+		gateway, ifindex, bestLen = gw, int(rtm.Header.Index), prefixLen
+	}
+
+	if bestLen < 0 {
+		return nil, 0, ErrNoRoute
+	}
+	return gateway, ifindex, nil
+}
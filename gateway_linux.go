@@ -0,0 +1,139 @@
+package arping
+
+import (
+	"net"
+	"syscall"
+)
+
+// defaultRoute reads the v4 default route with the lowest metric per netlink
+func defaultRoute() (net.IP, int, error) {
+	rib, err := syscall.NetlinkRIB(syscall.RTM_GETROUTE, syscall.AF_INET)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	msgs, err := syscall.ParseNetlinkMessage(rib)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var gateway net.IP
+	var ifindex int
+	var metric uint32
+	for _, msg := range msgs {
+		if msg.Header.Type != syscall.RTM_NEWROUTE || len(msg.Data) < syscall.SizeofRtMsg {
+			continue
+		}
+
+		// struct rtmsg: family, dst_len, src_len, tos, table, protocol, scope, type, flags
+		dstLen, table := msg.Data[1], msg.Data[4]
+		if dstLen != 0 || table != syscall.RT_TABLE_MAIN {
+			continue
+		}
+
+		attrs, err := syscall.ParseNetlinkRouteAttr(&msg)
+		if err != nil {
+			continue
+		}
+		var gw net.IP
+		var oif int
+		var priority uint32
+		for _, attr := range attrs {
+			switch attr.Attr.Type {
+			case syscall.RTA_GATEWAY:
+				gw = net.IP(attr.Value).To4()
+			case syscall.RTA_OIF:
+				if len(attr.Value) >= 4 {
+					oif = int(nativeEndian.Uint32(attr.Value))
+				}
+			case syscall.RTA_PRIORITY:
+				if len(attr.Value) >= 4 {
+					priority = nativeEndian.Uint32(attr.Value)
+				}
+			}
+		}
+		if gw == nil || oif == 0 {
+			continue
+		}
+		if gateway == nil || priority < metric {
+			gateway, ifindex, metric = gw, oif, priority
+		}
+	}
+
+	if gateway == nil {
+		return nil, 0, ErrNoDefaultRoute
+	}
+	return gateway, ifindex, nil
+}
+
+// routeTo reads the v4 route to 'dstIP' per netlink - a route of the local table, else the longest prefix match
+// of the main table with the lowest metric. The gateway is nil for an on-link route.
+func routeTo(dstIP net.IP) (net.IP, int, error) {
+	rib, err := syscall.NetlinkRIB(syscall.RTM_GETROUTE, syscall.AF_INET)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	msgs, err := syscall.ParseNetlinkMessage(rib)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var gateway net.IP
+	var ifindex int
+	var metric uint32
+	bestLen := -1
+	for _, msg := range msgs {
+		if msg.Header.Type != syscall.RTM_NEWROUTE || len(msg.Data) < syscall.SizeofRtMsg {
+			continue
+		}
+
+		// struct rtmsg: family, dst_len, src_len, tos, table, protocol, scope, type, flags
+		dstLen, table, routeType := int(msg.Data[1]), msg.Data[4], msg.Data[7]
+		local := table == syscall.RT_TABLE_LOCAL
+		if !local && (table != syscall.RT_TABLE_MAIN || routeType != syscall.RTN_UNICAST || dstLen < bestLen) {
+			continue
+		}
+
+		attrs, err := syscall.ParseNetlinkRouteAttr(&msg)
+		if err != nil {
+			continue
+		}
+		dst := net.IPv4zero.To4()
+		var gw net.IP
+		var oif int
+		var priority uint32
+		for _, attr := range attrs {
+			switch attr.Attr.Type {
+			case syscall.RTA_DST:
+				dst = net.IP(attr.Value).To4()
+			case syscall.RTA_GATEWAY:
+				gw = net.IP(attr.Value).To4()
+			case syscall.RTA_OIF:
+				if len(attr.Value) >= 4 {
+					oif = int(nativeEndian.Uint32(attr.Value))
+				}
+			case syscall.RTA_PRIORITY:
+				if len(attr.Value) >= 4 {
+					priority = nativeEndian.Uint32(attr.Value)
+				}
+			}
+		}
+		network := net.IPNet{IP: dst, Mask: net.CIDRMask(dstLen, 8*net.IPv4len)}
+		if dst == nil || oif == 0 || !network.Contains(dstIP) {
+			continue
+		}
+		if local {
+			// the local table is consulted first: 'dstIP' is an own or a broadcast address
+			return nil, oif, nil
+		}
+		if dstLen > bestLen || priority < metric {
+			gateway, ifindex, metric, bestLen = gw, oif, priority, dstLen
+		}
+	}
+
+	if bestLen < 0 {
+		return nil, 0, ErrNoRoute
+	}
+	return gateway, ifindex, nil
+}
@@ -0,0 +1,114 @@
+package arping
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPingGateway(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	sock := newFakeSocket(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{newArpReply(request, mac)}
+	})
+	useFakeSocket(t, sock)
+
+	lo := loopbackInterface(t)
+	origRoute := readDefaultRoute
+	readDefaultRoute = func() (net.IP, int, error) {
+		return net.ParseIP("127.0.0.254"), lo.Index, nil
+	}
+	t.Cleanup(func() {
+		readDefaultRoute = origRoute
+	})
+
+	results, err := PingGateway(WithTimeout(10 * time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Iface != lo.Name {
+		t.Errorf("one result over '%s' expected, but got: %v", lo.Name, results)
+	}
+	if sent := sock.sentDatagrams(); len(sent) != 1 || !sent[0].TargetIP().Equal(net.ParseIP("127.0.0.254")) {
+		t.Errorf("one request to the gateway expected, but sent: %v", sent)
+	}
+
+	readDefaultRoute = func() (net.IP, int, error) {
+		return nil, 0, ErrNoDefaultRoute
+	}
+	if _, err := PingGateway(); err != ErrNoDefaultRoute {
+		t.Errorf("'ErrNoDefaultRoute' expected, but got: %v", err)
+	}
+}
+
+func TestDefaultGateway(t *testing.T) {
+	gateway, iface, err := DefaultGateway()
+	if err == ErrNoDefaultRoute {
+		t.Skip("no default route")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gateway.To4() == nil || len(iface.Name) == 0 {
+		t.Errorf("v4 gateway and interface expected, but got: '%s' over '%s'", gateway, iface.Name)
+	}
+}
+
+func TestPingNextHop(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	sock := newFakeSocket(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{newArpReply(request, mac)}
+	})
+	useFakeSocket(t, sock)
+
+	lo := loopbackInterface(t)
+	origRoute := readRoute
+	readRoute = func(dstIP net.IP) (net.IP, int, error) {
+		switch {
+		case dstIP.Equal(net.ParseIP("198.51.100.1")):
+			return net.ParseIP("127.0.0.254"), lo.Index, nil
+		case dstIP.Equal(net.ParseIP("127.0.0.2")):
+			return nil, lo.Index, nil
+		}
+		return nil, 0, ErrNoRoute
+	}
+	t.Cleanup(func() {
+		readRoute = origRoute
+	})
+
+	results, err := PingNextHop(net.ParseIP("198.51.100.1"), WithTimeout(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Iface != lo.Name {
+		t.Errorf("one result over '%s' expected, but got: %v", lo.Name, results)
+	}
+	if sent := sock.sentDatagrams(); len(sent) != 1 || !sent[0].TargetIP().Equal(net.ParseIP("127.0.0.254")) {
+		t.Errorf("one request to the next-hop expected, but sent: %v", sent)
+	}
+
+	if _, err := PingNextHop(net.ParseIP("127.0.0.2")); !errors.Is(err, ErrOnLink) {
+		t.Errorf("'ErrOnLink' expected, but got: %v", err)
+	}
+	if _, err := PingNextHop(net.ParseIP("203.0.113.1")); err != ErrNoRoute {
+		t.Errorf("'ErrNoRoute' expected, but got: %v", err)
+	}
+}
+
+func TestNextHop(t *testing.T) {
+	if _, _, err := NextHop(net.ParseIP("127.0.0.1")); !errors.Is(err, ErrOnLink) {
+		t.Errorf("'ErrOnLink' expected for the loopback network, but got: %v", err)
+	}
+
+	gateway, iface, err := NextHop(net.ParseIP("198.51.100.1"))
+	if err == ErrNoRoute {
+		t.Skip("no route")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gateway.To4() == nil || len(iface.Name) == 0 {
+		t.Errorf("v4 gateway and interface expected, but got: '%s' over '%s'", gateway, iface.Name)
+	}
+}
@@ -0,0 +1,263 @@
+package arping
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryWire is an in-memory ethernet segment: it delivers every frame sent by one endpoint
+// to the other endpoints, which it's addressed to - per broadcast or per their hardware address
+type memoryWire struct {
+	mu        sync.Mutex
+	endpoints []*memoryEndpoint
+}
+
+// memoryEndpoint is a 'FrameSocket' attached to a 'memoryWire'
+type memoryEndpoint struct {
+	wire   *memoryWire
+	mac    net.HardwareAddr
+	frames chan []byte
+	closed chan struct{}
+	once   sync.Once
+}
+
+// attach adds an endpoint with hardware address 'mac' to the wire - until it's closed
+func (w *memoryWire) attach(mac net.HardwareAddr) *memoryEndpoint {
+	ep := &memoryEndpoint{
+		wire:   w,
+		mac:    mac,
+		frames: make(chan []byte, 64),
+		closed: make(chan struct{}),
+	}
+	w.mu.Lock()
+	w.endpoints = append(w.endpoints, ep)
+	w.mu.Unlock()
+	return ep
+}
+
+// factory returns a 'SocketFactory' which attaches an endpoint with hardware address 'mac' per socket
+func (w *memoryWire) factory(mac net.HardwareAddr) SocketFactory {
+	return func(iface net.Interface) (FrameSocket, error) {
+		return w.attach(mac), nil
+	}
+}
+
+func (w *memoryWire) deliver(from *memoryEndpoint, frame []byte) {
+	dst := net.HardwareAddr(frame[:6])
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, ep := range w.endpoints {
+		if ep == from || !(bytes.Equal(dst, ep.mac) || bytes.Equal(dst, BroadcastMAC())) {
+			continue
+		}
+		select {
+		case ep.frames <- append([]byte(nil), frame...):
+		default:
+			// like a full socket buffer
+		}
+	}
+}
+
+func (w *memoryWire) detach(ep *memoryEndpoint) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i, e := range w.endpoints {
+		if e == ep {
+			w.endpoints = append(w.endpoints[:i], w.endpoints[i+1:]...)
+			return
+		}
+	}
+}
+
+func (ep *memoryEndpoint) SendFrame(frame []byte) (time.Time, error) {
+	if len(frame) < ethernetHeaderLen {
+		return time.Now(), errors.New("frame without ethernet header")
+	}
+	select {
+	case <-ep.closed:
+		return time.Now(), net.ErrClosed
+	default:
+	}
+	sendTime := time.Now()
+	ep.wire.deliver(ep, frame)
+	return sendTime, nil
+}
+
+func (ep *memoryEndpoint) ReceiveFrame(deadline time.Time) ([]byte, time.Time, error) {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	select {
+	case frame := <-ep.frames:
+		return frame, time.Now(), nil
+	case <-timer.C:
+		return nil, time.Now(), ErrTimeout
+	case <-ep.closed:
+		return nil, time.Now(), net.ErrClosed
+	}
+}
+
+func (ep *memoryEndpoint) Close() error {
+	ep.once.Do(func() {
+		ep.wire.detach(ep)
+		close(ep.closed)
+	})
+	return nil
+}
+
+// addHost attaches a host with 'ip' and 'mac', which answers the arp requests for 'ip' - until the test ends
+func (w *memoryWire) addHost(t testing.TB, ip net.IP, mac net.HardwareAddr) {
+	t.Helper()
+
+	ep := w.attach(mac)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			frame, _, err := ep.ReceiveFrame(time.Now().Add(pollInterval))
+			if err == ErrTimeout {
+				continue
+			}
+			if err != nil {
+				return
+			}
+			request, err := parseArpDatagram(frame[ethernetHeaderLen:])
+			if err != nil || request.oper != requestOper || !request.TargetIP().Equal(ip) {
+				continue
+			}
+			reply := newArpReply(request, mac)
+			ep.SendFrame(reply.MarshalWithEthernetHeader())
+		}
+	}()
+	t.Cleanup(func() {
+		ep.Close()
+		<-done
+	})
+}
+
+func TestPingOverMemoryWire(t *testing.T) {
+	wire := &memoryWire{}
+	hostIP, hostMac := net.ParseIP("10.0.0.2"), net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+	wire.addHost(t, hostIP, hostMac)
+
+	localMac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	iface := net.Interface{Index: 1, Name: "mem0", HardwareAddr: localMac, Flags: net.FlagUp | net.FlagBroadcast}
+	opts := []Option{WithSocketFactory(wire.factory(localMac)), WithSourceIP(net.ParseIP("10.0.0.1")),
+		WithTimeout(200 * time.Millisecond)}
+
+	results, err := PingOverIface(hostIP, iface, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("one result expected, but got: %v", results)
+	}
+	if results[0].HwAddr.String() != hostMac.String() || !results[0].IP.Equal(hostIP) || !results[0].Solicited {
+		t.Errorf("solicited reply from %s / %s expected, but got: %+v", hostIP, hostMac, results[0])
+	}
+	if results[0].Duration <= 0 {
+		t.Errorf("positive rtt expected, but got: %s", results[0].Duration)
+	}
+
+	if _, err := PingOverIface(net.ParseIP("10.0.0.3"), iface, opts...); err != ErrTimeout {
+		t.Errorf("ErrTimeout expected for an unknown host, but got: %v", err)
+	}
+}
+
+func TestPingWithRewrittenEthernetSource(t *testing.T) {
+	wire := &memoryWire{}
+	hostIP, hostMac := net.ParseIP("10.0.0.2"), net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+	bridgeMac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0xbb}
+	host := wire.attach(hostMac)
+	t.Cleanup(func() { host.Close() })
+	go func() {
+		frame, _, err := host.ReceiveFrame(time.Now().Add(time.Second))
+		if err != nil {
+			return
+		}
+		request, err := parseArpDatagram(frame[ethernetHeaderLen:])
+		if err != nil {
+			return
+		}
+		// the bridge rewrites the ethernet source - the arp payload stays intact
+		reply := newArpReply(request, hostMac).MarshalWithEthernetHeader()
+		copy(reply[6:12], bridgeMac)
+		host.SendFrame(reply)
+	}()
+
+	localMac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	iface := net.Interface{Index: 1, Name: "mem0", HardwareAddr: localMac, Flags: net.FlagUp | net.FlagBroadcast}
+	results, err := PingOverIface(hostIP, iface, WithSocketFactory(wire.factory(localMac)),
+		WithSourceIP(net.ParseIP("10.0.0.1")), WithTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].HwAddr.String() != hostMac.String() || results[0].EthSrcMac.String() != bridgeMac.String() {
+		t.Errorf("reply with sender mac '%s' and ethernet source '%s' expected, but got: %+v", hostMac, bridgeMac, results)
+	}
+}
+
+// steppedClockEndpoint returns wall clock timestamps without a monotonic reading - like hardware timestamps,
+// from a clock, which steps back by an hour between the send and the receive
+type steppedClockEndpoint struct {
+	*memoryEndpoint
+	clock func() time.Time
+	step  func()
+}
+
+func (ep steppedClockEndpoint) SendFrame(frame []byte) (time.Time, error) {
+	sendTime := ep.clock()
+	_, err := ep.memoryEndpoint.SendFrame(frame)
+	return sendTime, err
+}
+
+func (ep steppedClockEndpoint) ReceiveFrame(deadline time.Time) ([]byte, time.Time, error) {
+	ep.step()
+	frame, _, err := ep.memoryEndpoint.ReceiveFrame(deadline)
+	return frame, ep.clock(), err
+}
+
+func TestPingRTTWithWallClockStep(t *testing.T) {
+	var mu sync.Mutex
+	var offset time.Duration
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return time.Now().Add(offset).Round(0)
+	}
+	step := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		offset = -time.Hour
+	}
+	wire := &memoryWire{}
+	hostIP, hostMac := net.ParseIP("10.0.0.2"), net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+	wire.addHost(t, hostIP, hostMac)
+
+	localMac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	iface := net.Interface{Index: 1, Name: "mem0", HardwareAddr: localMac, Flags: net.FlagUp | net.FlagBroadcast}
+	ep := wire.attach(localMac)
+	factory := func(iface net.Interface) (FrameSocket, error) {
+		return steppedClockEndpoint{memoryEndpoint: ep, clock: clock, step: step}, nil
+	}
+	orig := wallClock
+	wallClock = clock
+	t.Cleanup(func() {
+		// the receiver of the ping stops after the return - at the socket close
+		<-ep.closed
+		wallClock = orig
+	})
+	results, err := PingOverIface(hostIP, iface, WithSocketFactory(factory), WithSourceIP(net.ParseIP("10.0.0.1")),
+		WithTimeout(200*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Duration <= 0 || results[0].Duration > time.Second {
+		t.Errorf("one result with a sane rtt expected despite the clock step, but got: %+v", results)
+	}
+}
@@ -0,0 +1,151 @@
+package arping
+
+import (
+	"context"
+	"net"
+	"strings"
+)
+
+// NeighborState of a kernel neighbor table entry - the values match the linux 'NUD_*' states
+type NeighborState uint16
+
+const (
+	NeighborIncomplete NeighborState = 0x01
+	NeighborReachable  NeighborState = 0x02
+	NeighborStale      NeighborState = 0x04
+	NeighborDelay      NeighborState = 0x08
+	NeighborProbe      NeighborState = 0x10
+	NeighborFailed     NeighborState = 0x20
+	NeighborNoArp      NeighborState = 0x40
+	NeighborPermanent  NeighborState = 0x80
+)
+
+func (state NeighborState) String() string {
+	names := []string{"INCOMPLETE", "REACHABLE", "STALE", "DELAY", "PROBE", "FAILED", "NOARP", "PERMANENT"}
+
+	var set []string
+	for i, name := range names {
+		if state&(1<<i) != 0 {
+			set = append(set, name)
+		}
+	}
+	if len(set) == 0 {
+		return "NONE"
+	}
+	return strings.Join(set, "|")
+}
+
+// Neighbor is a v4 entry of the kernel neighbor (arp) table
+type Neighbor struct {
+	IP     net.IP
+	HwAddr net.HardwareAddr
+	// Iface is the name of the interface of the entry
+	Iface string
+	State NeighborState
+}
+
+// Neighbors returns the v4 entries of the kernel neighbor (arp) table.
+//
+// BSD has no reachability states - complete entries are reported as 'NeighborReachable',
+// static ones as 'NeighborPermanent'.
+func Neighbors() ([]Neighbor, error) {
+	return readNeighbors()
+}
+
+// known returns true for a reachable or permanent entry with a hardware address - such as the static entries of BSD
+func (n Neighbor) known() bool {
+	return n.State&(NeighborReachable|NeighborPermanent) != 0 && len(n.HwAddr) > 0
+}
+
+// readNeighbors reads the kernel neighbor table - replaced in tests
+var readNeighbors = neighbors
+
+// ResolveCachedFirst returns the hardware address of 'dstIP' from the kernel neighbor table,
+// if it has a reachable or permanent entry for it - with 'fromCache' true.
+// Otherwise, if the entry is stale, incomplete or missing, it falls back to 'Resolve'.
+func ResolveCachedFirst(dstIP net.IP, opts ...Option) (mac net.HardwareAddr, fromCache bool, err error) {
+	if err := validateIP(dstIP); err != nil {
+		return nil, false, err
+	}
+
+	if neighbor, ok := findNeighbor(dstIP); ok && neighbor.known() {
+		verboseLog.Printf("found neighbor: ip: '%s', mac: '%s', state: %s\n", neighbor.IP, neighbor.HwAddr, neighbor.State)
+		return neighbor.HwAddr, true, nil
+	}
+
+	mac, err = Resolve(dstIP, opts...)
+	return mac, false, err
+}
+
+// RefreshNeighbors pings every entry of the kernel neighbor table on interface 'iface' - see 'PingManyOverIfaceContext'.
+//
+// Returns the replies keyed by ip - entries which didn't reply are missing and can be pruned by the caller.
+func RefreshNeighbors(iface net.Interface, opts ...Option) (map[string]Result, error) {
+	neighbors, err := readNeighbors()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var dstIPs []net.IP
+	for _, neighbor := range neighbors {
+		if neighbor.Iface != iface.Name || seen[neighbor.IP.String()] {
+			continue
+		}
+		seen[neighbor.IP.String()] = true
+		dstIPs = append(dstIPs, neighbor.IP)
+	}
+	verboseLog.Printf("refresh %d neighbors on interface: '%s'\n", len(dstIPs), iface.Name)
+	return PingManyOverIfaceContext(context.Background(), dstIPs, iface, opts...)
+}
+
+// ScanNewOnly sends an arp ping over interface 'iface' to every host address in 'cidr', which has no reachable
+// or permanent entry on 'iface' in the kernel neighbor table - see 'ScanCIDROverIfaceContext'.
+//
+// Returns the newly discovered hosts keyed by ip. Known hosts aren't probed again,
+// which reduces the broadcasts of periodic rescans - stale, incomplete or failed entries are probed.
+func ScanNewOnly(cidr string, iface net.Interface, opts ...Option) (map[string]Result, error) {
+	dstIPs, err := CIDRHosts(cidr)
+	if err != nil {
+		return nil, err
+	}
+	neighbors, err := readNeighbors()
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool)
+	for _, neighbor := range neighbors {
+		if neighbor.Iface == iface.Name && neighbor.known() {
+			known[neighbor.IP.String()] = true
+		}
+	}
+	var unknown []net.IP
+	for _, dstIP := range dstIPs {
+		if !known[dstIP.String()] {
+			unknown = append(unknown, dstIP)
+		}
+	}
+	verboseLog.Printf("scan %d of %d addresses in '%s' - the others are known neighbors\n",
+		len(unknown), len(dstIPs), cidr)
+	if len(unknown) == 0 {
+		return make(map[string]Result), nil
+	}
+	return PingManyOverIfaceContext(context.Background(), unknown, iface, opts...)
+}
+
+// findNeighbor returns the kernel neighbor table entry of 'ip'
+func findNeighbor(ip net.IP) (Neighbor, bool) {
+	neighbors, err := readNeighbors()
+	if err != nil {
+		verboseLog.Printf("unable to read the neighbor table: %s\n", err)
+		return Neighbor{}, false
+	}
+
+	for _, neighbor := range neighbors {
+		if neighbor.IP.Equal(ip) {
+			return neighbor, true
+		}
+	}
+	return Neighbor{}, false
+}
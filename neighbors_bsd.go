@@ -0,0 +1,76 @@
+//go:build darwin || freebsd || openbsd
+// +build darwin freebsd openbsd
+
+package arping
+
+import (
+	"net"
+	"syscall"
+)
+
+func neighbors() ([]Neighbor, error) {
+	rib, err := syscall.RouteRIB(syscall.NET_RT_FLAGS, syscall.RTF_LLINFO)
+	if err != nil {
+		return nil, err
+	}
+
+	msgs, err := syscall.ParseRoutingMessage(rib)
+	if err != nil {
+		return nil, err
+	}
+
+	var neighbors []Neighbor
+	for _, msg := range msgs {
+		rtm, ok := msg.(*syscall.RouteMessage)
+		if !ok {
+			continue
+		}
+
+		sas, err := syscall.ParseRoutingSockaddr(rtm)
+		if err != nil || len(sas) <= syscall.RTAX_GATEWAY {
+			continue
+		}
+		dst, ok := sas[syscall.RTAX_DST].(*syscall.SockaddrInet4)
+		if !ok {
+			continue
+		}
+		link, ok := sas[syscall.RTAX_GATEWAY].(*syscall.SockaddrDatalink)
+		if !ok {
+			continue
+		}
+
+		neighbor := Neighbor{
+			IP:    net.IPv4(dst.Addr[0], dst.Addr[1], dst.Addr[2], dst.Addr[3]).To4(),
+			State: NeighborIncomplete,
+		}
+		if iface, err := net.InterfaceByIndex(int(link.Index)); err == nil {
+			neighbor.Iface = iface.Name
+		}
+		if link.Alen > 0 {
+			mac, ok := datalinkAddr(link)
+			if !ok {
+				continue
+			}
+			neighbor.HwAddr = mac
+			neighbor.State = NeighborReachable
+		}
+		if rtm.Header.Flags&syscall.RTF_STATIC != 0 {
+			neighbor.State = NeighborPermanent
+		}
+		neighbors = append(neighbors, neighbor)
+	}
+	return neighbors, nil
+}
+
+// datalinkAddr returns the hardware address of 'link' - false if its lengths exceed the data,
+// such as per a long interface name in front of the address
+func datalinkAddr(link *syscall.SockaddrDatalink) (net.HardwareAddr, bool) {
+	if int(link.Nlen)+int(link.Alen) > len(link.Data) {
+		return nil, false
+	}
+	mac := make(net.HardwareAddr, link.Alen)
+	for i := range mac {
+		mac[i] = byte(link.Data[int(link.Nlen)+i])
+	}
+	return mac, true
+}
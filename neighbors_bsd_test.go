@@ -0,0 +1,44 @@
+//go:build darwin || freebsd || openbsd
+// +build darwin freebsd openbsd
+
+package arping
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestDatalinkAddr(t *testing.T) {
+	newLink := func(name string, mac []byte) *syscall.SockaddrDatalink {
+		link := &syscall.SockaddrDatalink{Nlen: uint8(len(name)), Alen: uint8(len(mac))}
+		for i, b := range append([]byte(name), mac...) {
+			if i < len(link.Data) {
+				link.Data[i] = int8(b)
+			}
+		}
+		return link
+	}
+	mac := []byte{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	longName := string(make([]byte, len(syscall.SockaddrDatalink{}.Data)-len(mac)+1))
+
+	for _, tt := range []struct {
+		name string
+		link *syscall.SockaddrDatalink
+		ok   bool
+	}{
+		{"short interface name", newLink("em0", mac), true},
+		{"without interface name", newLink("", mac), true},
+		{"interface name up to the end", newLink(longName[1:], mac), true},
+		{"interface name past the end", newLink(longName, mac), false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := datalinkAddr(tt.link)
+			if ok != tt.ok {
+				t.Fatalf("ok %v expected, but got: %v", tt.ok, ok)
+			}
+			if ok && got.String() != "02:00:00:00:00:01" {
+				t.Errorf("02:00:00:00:00:01 expected, but got: %s", got)
+			}
+		})
+	}
+}
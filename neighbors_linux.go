@@ -0,0 +1,98 @@
+package arping
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// neighbor message attributes - from 'linux/neighbour.h'
+	ndaDst    = 1
+	ndaLladdr = 2
+
+	// sizeof(struct ndmsg)
+	sizeofNdmsg = 12
+)
+
+// nativeEndian is the byte order of netlink messages
+var nativeEndian binary.ByteOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+func neighbors() ([]Neighbor, error) {
+	rib, err := syscall.NetlinkRIB(syscall.RTM_GETNEIGH, syscall.AF_INET)
+	if err != nil {
+		return nil, err
+	}
+
+	msgs, err := syscall.ParseNetlinkMessage(rib)
+	if err != nil {
+		return nil, err
+	}
+
+	ifaceNames := interfaceNames()
+
+	var neighbors []Neighbor
+	for _, msg := range msgs {
+		if msg.Header.Type != syscall.RTM_NEWNEIGH || len(msg.Data) < sizeofNdmsg {
+			continue
+		}
+
+		// struct ndmsg: family, pad1, pad2, ifindex, state, flags, type
+		ifindex := int(int32(nativeEndian.Uint32(msg.Data[4:8])))
+		state := NeighborState(nativeEndian.Uint16(msg.Data[8:10]))
+		attrs := parseNetlinkAttrs(msg.Data[sizeofNdmsg:])
+
+		ip := net.IP(attrs[ndaDst]).To4()
+		if ip == nil {
+			continue
+		}
+		neighbors = append(neighbors, Neighbor{
+			IP:     ip,
+			HwAddr: net.HardwareAddr(attrs[ndaLladdr]),
+			Iface:  ifaceNames[ifindex],
+			State:  state,
+		})
+	}
+	return neighbors, nil
+}
+
+// parseNetlinkAttrs parses the route attributes in 'b' - syscall.ParseNetlinkRouteAttr supports no neighbor messages
+func parseNetlinkAttrs(b []byte) map[uint16][]byte {
+	attrs := make(map[uint16][]byte)
+	for len(b) >= syscall.SizeofRtAttr {
+		l := int(nativeEndian.Uint16(b[0:2]))
+		t := nativeEndian.Uint16(b[2:4])
+		if l < syscall.SizeofRtAttr || l > len(b) {
+			break
+		}
+		attrs[t] = b[syscall.SizeofRtAttr:l]
+
+		// attributes are 4 byte aligned
+		aligned := (l + syscall.RTA_ALIGNTO - 1) &^ (syscall.RTA_ALIGNTO - 1)
+		if aligned > len(b) {
+			break
+		}
+		b = b[aligned:]
+	}
+	return attrs
+}
+
+// interfaceNames returns the interface names per index
+func interfaceNames() map[int]string {
+	names := make(map[int]string)
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return names
+	}
+	for _, iface := range ifaces {
+		names[iface.Index] = iface.Name
+	}
+	return names
+}
@@ -0,0 +1,148 @@
+package arping
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// useNeighbors replaces the kernel neighbor table with 'neighbors' until the test ends
+func useNeighbors(t *testing.T, neighbors ...Neighbor) {
+	t.Helper()
+
+	orig := readNeighbors
+	readNeighbors = func() ([]Neighbor, error) {
+		return neighbors, nil
+	}
+	t.Cleanup(func() {
+		readNeighbors = orig
+	})
+}
+
+func TestResolveCachedFirstWithReachableEntry(t *testing.T) {
+	cached := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	dstIP := net.ParseIP("127.0.0.2")
+	useNeighbors(t, Neighbor{IP: dstIP.To4(), HwAddr: cached, State: NeighborReachable})
+	sock := newFakeSocket(nil)
+	useFakeSocket(t, sock)
+
+	mac, fromCache, err := ResolveCachedFirst(dstIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fromCache || mac.String() != cached.String() {
+		t.Errorf("cached '%s' expected, but got: '%s' (from cache: %v)", cached, mac, fromCache)
+	}
+	if len(sock.sentDatagrams()) != 0 {
+		t.Error("no request expected for a reachable entry")
+	}
+}
+
+func TestResolveCachedFirstWithPermanentEntry(t *testing.T) {
+	static := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	dstIP := net.ParseIP("127.0.0.2")
+	useNeighbors(t, Neighbor{IP: dstIP.To4(), HwAddr: static, State: NeighborPermanent})
+	sock := newFakeSocket(nil)
+	useFakeSocket(t, sock)
+
+	mac, fromCache, err := ResolveCachedFirst(dstIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fromCache || mac.String() != static.String() {
+		t.Errorf("static '%s' expected from the cache, but got: '%s' (from cache: %v)", static, mac, fromCache)
+	}
+	if len(sock.sentDatagrams()) != 0 {
+		t.Error("no request expected for a permanent entry")
+	}
+}
+
+func TestResolveCachedFirstWithStaleEntry(t *testing.T) {
+	stale := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	current := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+	dstIP := net.ParseIP("127.0.0.2")
+	useNeighbors(t, Neighbor{IP: dstIP.To4(), HwAddr: stale, State: NeighborStale})
+	useFakeSocket(t, newFakeSocket(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{newArpReply(request, current)}
+	}))
+	SetInterfaceSelector(func([]net.Interface, net.IP) (net.Interface, error) {
+		return loopbackInterface(t), nil
+	})
+	defer SetInterfaceSelector(nil)
+
+	mac, fromCache, err := ResolveCachedFirst(dstIP, WithTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromCache || mac.String() != current.String() {
+		t.Errorf("resolved '%s' expected, but got: '%s' (from cache: %v)", current, mac, fromCache)
+	}
+}
+
+func TestNeighborStateString(t *testing.T) {
+	if s := NeighborReachable.String(); s != "REACHABLE" {
+		t.Errorf("'REACHABLE' expected, but got: '%s'", s)
+	}
+	if s := (NeighborStale | NeighborPermanent).String(); s != "STALE|PERMANENT" {
+		t.Errorf("'STALE|PERMANENT' expected, but got: '%s'", s)
+	}
+}
+
+func TestRefreshNeighbors(t *testing.T) {
+	lo := loopbackInterface(t)
+	alive := net.ParseIP("127.0.0.2").To4()
+	gone := net.ParseIP("127.0.0.3").To4()
+	useNeighbors(t,
+		Neighbor{IP: alive, HwAddr: net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}, Iface: lo.Name},
+		Neighbor{IP: gone, HwAddr: net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}, Iface: lo.Name},
+		Neighbor{IP: net.ParseIP("10.0.0.1").To4(), Iface: "other"},
+	)
+
+	sock := newFakeSocket(func(request arpDatagram) []arpDatagram {
+		if !request.TargetIP().Equal(alive) {
+			return nil
+		}
+		return []arpDatagram{newArpReply(request, net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01})}
+	})
+	useFakeSocket(t, sock)
+
+	results, err := RefreshNeighbors(lo, WithTimeout(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := results[alive.String()]; !ok || len(results) != 1 {
+		t.Errorf("only '%s' alive expected, but got: %v", alive, results)
+	}
+	if sent := sock.sentDatagrams(); len(sent) != 2 {
+		t.Errorf("2 requests - only for the neighbors on '%s' - expected, but sent: %d", lo.Name, len(sent))
+	}
+}
+
+func TestScanNewOnly(t *testing.T) {
+	lo := loopbackInterface(t)
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	useNeighbors(t,
+		Neighbor{IP: net.ParseIP("127.0.0.1").To4(), HwAddr: mac, Iface: lo.Name, State: NeighborReachable},
+		Neighbor{IP: net.ParseIP("127.0.0.2").To4(), HwAddr: mac, Iface: lo.Name, State: NeighborStale},
+		Neighbor{IP: net.ParseIP("127.0.0.3").To4(), HwAddr: mac, Iface: "other", State: NeighborReachable},
+	)
+
+	sock := newFakeSocket(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{newArpReply(request, mac)}
+	})
+	useFakeSocket(t, sock)
+
+	results, err := ScanNewOnly("127.0.0.0/29", lo, WithTimeout(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the stale neighbor and the one on another interface are probed
+	if len(results) != 5 {
+		t.Errorf("5 new hosts expected, but got: %v", results)
+	}
+	for _, request := range sock.sentDatagrams() {
+		if request.TargetIP().Equal(net.ParseIP("127.0.0.1")) {
+			t.Error("the reachable neighbor on the interface shouldn't be probed")
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build darwin || freebsd || openbsd
+// +build darwin freebsd openbsd
+
+package arping
+
+import "errors"
+
+// inNetNS runs 'fn' - network namespaces are not supported, so 'path' must be empty
+func inNetNS(path string, fn func() error) error {
+	if path != "" {
+		return errors.New("network namespaces are only supported under linux")
+	}
+	return fn()
+}
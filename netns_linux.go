@@ -0,0 +1,55 @@
+package arping
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// inNetNS runs 'fn' within the network namespace 'path' - or in the current one, if 'path' is empty
+func inNetNS(path string, fn func() error) error {
+	if path == "" {
+		return fn()
+	}
+
+	// the namespace is a property of the os thread
+	runtime.LockOSThread()
+
+	orig, err := os.Open(fmt.Sprintf("/proc/self/task/%d/ns/net", syscall.Gettid()))
+	if err != nil {
+		runtime.UnlockOSThread()
+		return err
+	}
+	defer orig.Close()
+
+	ns, err := os.Open(path)
+	if err != nil {
+		runtime.UnlockOSThread()
+		return err
+	}
+	defer ns.Close()
+
+	verboseLog.Printf("enter network namespace: '%s'\n", path)
+	if err := setns(int(ns.Fd())); err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("unable to enter network namespace '%s': %w", path, err)
+	}
+
+	fnErr := fn()
+
+	if err := setns(int(orig.Fd())); err != nil {
+		// keep the thread locked - it gets terminated when the goroutine exits
+		return fmt.Errorf("unable to leave network namespace '%s': %w", path, err)
+	}
+	runtime.UnlockOSThread()
+	return fnErr
+}
+
+func setns(fd int) error {
+	_, _, errno := syscall.RawSyscall(sysSetns, uintptr(fd), syscall.CLONE_NEWNET, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,4 @@
+package arping
+
+// not defined in the syscall package for 386
+const sysSetns = 346
@@ -0,0 +1,4 @@
+package arping
+
+// not defined in the syscall package for amd64
+const sysSetns = 308
@@ -0,0 +1,8 @@
+//go:build linux && !amd64 && !386
+// +build linux,!amd64,!386
+
+package arping
+
+import "syscall"
+
+const sysSetns = syscall.SYS_SETNS
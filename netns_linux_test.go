@@ -0,0 +1,36 @@
+package arping
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestInNetNS(t *testing.T) {
+	fnErr := errors.New("fn error")
+	called := false
+	err := inNetNS("/proc/self/ns/net", func() error {
+		called = true
+		return fnErr
+	})
+	if errors.Is(err, syscall.EPERM) {
+		t.Skip("switching network namespaces requires CAP_SYS_ADMIN")
+	}
+	if !called {
+		t.Fatal("fn not called")
+	}
+	if err != fnErr {
+		t.Errorf("fn error expected, but received: %v", err)
+	}
+}
+
+func TestInNetNSWithInvalidPath(t *testing.T) {
+	err := inNetNS("/invalid/ns/net", func() error {
+		t.Error("fn called")
+		return nil
+	})
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("not exist error expected, but received: %v", err)
+	}
+}
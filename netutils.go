@@ -1,35 +1,150 @@
 package arping
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"net"
+	"sync"
+	"time"
 )
 
+// interfaceByName returns the interface named 'name' - replaced in tests
+var interfaceByName = net.InterfaceByName
+
+// interfaceAddrs returns the addresses of 'iface' - replaced in tests
+var interfaceAddrs = func(iface net.Interface) ([]net.Addr, error) {
+	return iface.Addrs()
+}
+
 func findIPInNetworkFromIface(dstIP net.IP, iface net.Interface) (net.IP, error) {
-	addrs, err := iface.Addrs()
+	addrs, err := interfaceAddrs(iface)
 
 	if err != nil {
 		return nil, err
 	}
 
+	// the most specific network wins - such as a /24 over a containing /16, the first one on a tie
+	var found *net.IPNet
 	for _, a := range addrs {
-		if ipnet, ok := a.(*net.IPNet); ok {
-			if ipnet.Contains(dstIP) {
-				return ipnet.IP, nil
+		if ipnet, ok := a.(*net.IPNet); ok && ipnet.Contains(dstIP) {
+			if found == nil || prefixLen(ipnet) > prefixLen(found) {
+				found = ipnet
 			}
 		}
 	}
-	return nil, fmt.Errorf("iface: '%s' can't reach ip: '%s'", iface.Name, dstIP)
+	if found == nil {
+		return nil, fmt.Errorf("iface: '%s' can't reach ip: '%s'", iface.Name, dstIP)
+	}
+	return found.IP, nil
 }
 
-func findUsableInterfaceForNetwork(dstIP net.IP) (*net.Interface, error) {
-	ifaces, err := net.Interfaces()
+func prefixLen(ipnet *net.IPNet) int {
+	ones, _ := ipnet.Mask.Size()
+	return ones
+}
 
+// LocalAddresses returns the v4 addresses and the hardware address of interface 'iface'
+func LocalAddresses(iface net.Interface) (ips []net.IP, macs []net.HardwareAddr, err error) {
+	addrs, err := interfaceAddrs(iface)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+			ips = append(ips, ipnet.IP.To4())
+		}
+	}
+	if len(iface.HardwareAddr) > 0 {
+		macs = append(macs, iface.HardwareAddr)
+	}
+	return ips, macs, nil
+}
+
+// ExpectedSourceMAC returns the source hardware address of the requests to 'dstIP' - of the interface selected per
+// 'SetInterfaceSelector', or the one per 'WithSourceMAC'. Nothing is sent: useful to check port security configs upfront.
+func ExpectedSourceMAC(dstIP net.IP, opts ...Option) (net.HardwareAddr, error) {
+	if err := validateIP(dstIP); err != nil {
+		return nil, err
+	}
+	cfg := newConfig(opts)
+
+	iface, err := findUsableInterfaceForNetwork(dstIP, cfg)
 	if err != nil {
 		return nil, err
 	}
+	return cfg.srcMac(*iface), nil
+}
+
+// VerifySourceMAC checks that the requests to 'dstIP' would be sent from 'expected' - see 'ExpectedSourceMAC'.
+// Returns an error wrapping 'ErrSourceMacMismatch' with both addresses otherwise.
+func VerifySourceMAC(dstIP net.IP, expected net.HardwareAddr, opts ...Option) error {
+	mac, err := ExpectedSourceMAC(dstIP, opts...)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(mac, expected) {
+		return fmt.Errorf("%w: '%s' instead of '%s' to ip: '%s'", ErrSourceMacMismatch, mac, expected, dstIP)
+	}
+	return nil
+}
 
+// sourceIPCandidates returns the v4 addresses of 'iface' to ping 'dstIP' from - per 'WithSourceIPFallback':
+// the address in the network of 'dstIP' first, if any, then the others in interface order
+func sourceIPCandidates(dstIP net.IP, iface net.Interface) ([]net.IP, error) {
+	ips, _, err := LocalAddresses(iface)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []net.IP
+	if first, err := findIPInNetworkFromIface(dstIP, iface); err == nil && first.To4() != nil {
+		candidates = append(candidates, first.To4())
+	}
+	for _, ip := range ips {
+		if len(candidates) == 0 || !ip.Equal(candidates[0]) {
+			candidates = append(candidates, ip)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("iface: '%s' has no v4 address", iface.Name)
+	}
+	return candidates, nil
+}
+
+// BroadcastMAC returns the ethernet broadcast address ff:ff:ff:ff:ff:ff
+func BroadcastMAC() net.HardwareAddr {
+	return net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+}
+
+// MulticastMAC returns the ethernet multicast address for the v4 multicast address 'ip'
+// (RFC 1112: 01:00:5e followed by the low-order 23 bits of 'ip')
+func MulticastMAC(ip net.IP) (net.HardwareAddr, error) {
+	ip4 := ip.To4()
+	if ip4 == nil || !ip4.IsMulticast() {
+		return nil, fmt.Errorf("not a v4 multicast Address: %s", ip)
+	}
+	return net.HardwareAddr{0x01, 0x00, 0x5e, ip4[1] & 0x7f, ip4[2], ip4[3]}, nil
+}
+
+// InterfaceSelector selects the interface to reach 'dstIP' out of 'candidates'
+type InterfaceSelector func(candidates []net.Interface, dstIP net.IP) (net.Interface, error)
+
+var interfaceSelector InterfaceSelector = DefaultInterfaceSelector
+
+// SetInterfaceSelector sets the policy to select the interface, when no interface is given.
+// 'nil' restores the 'DefaultInterfaceSelector'.
+func SetInterfaceSelector(selector InterfaceSelector) {
+	if selector == nil {
+		selector = DefaultInterfaceSelector
+	}
+	interfaceSelector = selector
+	ClearInterfaceCache()
+}
+
+// DefaultInterfaceSelector selects the first interface which is up and has an address in the network of 'dstIP'
+func DefaultInterfaceSelector(candidates []net.Interface, dstIP net.IP) (net.Interface, error) {
 	isDown := func(iface net.Interface) bool {
 		return iface.Flags&1 == 0
 	}
@@ -46,7 +161,7 @@ func findUsableInterfaceForNetwork(dstIP net.IP) (*net.Interface, error) {
 		verboseLog.Printf("%10s: %6s %18s  %s", msg, iface.Name, iface.HardwareAddr, iface.Flags)
 	}
 
-	for _, iface := range ifaces {
+	for _, iface := range candidates {
 		if isDown(iface) {
 			logIfaceResult("DOWN", iface)
 			continue
@@ -58,7 +173,151 @@ func findUsableInterfaceForNetwork(dstIP net.IP) (*net.Interface, error) {
 		}
 
 		logIfaceResult("USABLE", iface)
-		return &iface, nil
+		return iface, nil
 	}
-	return nil, errors.New("no usable interface found")
+	return net.Interface{}, errors.New("no usable interface found")
+}
+
+func findUsableInterfaceForNetwork(dstIP net.IP, cfg *config) (*net.Interface, error) {
+	if cfg.interfaceCacheTTL > 0 {
+		if iface, ok := interfaceCache.get(dstIP, cfg.netns); ok {
+			return &iface, nil
+		}
+	}
+
+	var iface net.Interface
+	err := cfg.retryInterfaceLookup(func() error {
+		return inNetNS(cfg.netns, func() error {
+			ifaces, err := net.Interfaces()
+
+			if err != nil {
+				return err
+			}
+
+			iface, err = interfaceSelector(ifaces, dstIP)
+			return err
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cfg.interfaceCacheTTL > 0 {
+		interfaceCache.put(dstIP, cfg.netns, iface, cfg.interfaceCacheTTL)
+	}
+	return &iface, nil
+}
+
+// interfaceCache holds the interfaces per network of the targets - see 'WithInterfaceCacheTTL'
+var interfaceCache = &ifaceCache{}
+
+type ifaceCache struct {
+	mu      sync.Mutex
+	entries []ifaceCacheEntry
+}
+
+type ifaceCacheEntry struct {
+	netns   string
+	network *net.IPNet
+	iface   net.Interface
+	expires time.Time
+}
+
+// get returns the cached interface for the network of 'dstIP' in namespace 'netns'
+func (c *ifaceCache) get(dstIP net.IP, netns string) (net.Interface, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for _, entry := range c.entries {
+		if entry.netns == netns && entry.network.Contains(dstIP) && now.Before(entry.expires) {
+			return entry.iface, true
+		}
+	}
+	return net.Interface{}, false
+}
+
+// put caches 'iface' for the network of 'dstIP' - only 'dstIP' itself, if 'iface' has no address in its network
+func (c *ifaceCache) put(dstIP net.IP, netns string, iface net.Interface, ttl time.Duration) {
+	network := &net.IPNet{IP: dstIP.To4(), Mask: net.CIDRMask(8*net.IPv4len, 8*net.IPv4len)}
+	var addrs []net.Addr
+	// the addresses of 'iface' are only visible in its namespace
+	err := inNetNS(netns, func() (err error) {
+		addrs, err = interfaceAddrs(iface)
+		return err
+	})
+	if err == nil {
+		for _, a := range addrs {
+			if ipnet, ok := a.(*net.IPNet); ok && ipnet.Contains(dstIP) {
+				network = &net.IPNet{IP: ipnet.IP.Mask(ipnet.Mask), Mask: ipnet.Mask}
+				break
+			}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	entries := c.entries[:0]
+	for _, entry := range c.entries {
+		// drop the expired entries and the one replaced
+		if now.Before(entry.expires) && !(entry.netns == netns && entry.network.String() == network.String()) {
+			entries = append(entries, entry)
+		}
+	}
+	c.entries = append(entries, ifaceCacheEntry{netns: netns, network: network, iface: iface, expires: now.Add(ttl)})
+}
+
+// ClearInterfaceCache drops all interfaces cached per 'WithInterfaceCacheTTL'
+func ClearInterfaceCache() {
+	interfaceCache.mu.Lock()
+	defer interfaceCache.mu.Unlock()
+	interfaceCache.entries = nil
+}
+
+// findBroadcastInterfaces returns the interfaces which are up and broadcast capable
+func findBroadcastInterfaces(cfg *config) (ifaces []net.Interface, err error) {
+	err = inNetNS(cfg.netns, func() error {
+		all, err := net.Interfaces()
+		if err != nil {
+			return err
+		}
+
+		for _, iface := range all {
+			if iface.Flags&net.FlagUp != 0 && iface.Flags&net.FlagBroadcast != 0 {
+				ifaces = append(ifaces, iface)
+			}
+		}
+		return nil
+	})
+	return ifaces, err
+}
+
+// findInterfaceByName returns the interface named 'ifaceName' - such as a VLAN subinterface 'eth0.100',
+// which is used as is: with its own index and hardware address, not the ones of its parent.
+//
+// The frames are sent with the hardware address of the interface in the ethernet header and as sender, so
+// an interface without an ethernet address - such as a tunnel - is rejected with 'ErrUnsupportedInterface',
+// unless the sender address is given per 'WithSourceMAC'.
+func findInterfaceByName(ifaceName string, cfg *config) (iface *net.Interface, err error) {
+	err = cfg.retryInterfaceLookup(func() error {
+		return inNetNS(cfg.netns, func() error {
+			iface, err = interfaceByName(ifaceName)
+			return err
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("interface '%s': %w", ifaceName, err)
+	}
+	if mac := cfg.srcMac(*iface); len(mac) != 6 {
+		return nil, fmt.Errorf("%w: '%s' has no ethernet hardware address: '%s' - see 'WithSourceMAC'",
+			ErrUnsupportedInterface, ifaceName, mac)
+	}
+	return iface, nil
+}
+
+// ifaceFingerprint describes 'iface' for the verbose log - with the index and the source mac 'srcMac',
+// to correlate with packet captures
+func ifaceFingerprint(iface net.Interface, srcMac net.HardwareAddr) string {
+	return fmt.Sprintf("'%s' (index: %d, mac: %s)", iface.Name, iface.Index, srcMac)
 }
@@ -0,0 +1,256 @@
+package arping
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestBroadcastMAC(t *testing.T) {
+	if mac := BroadcastMAC(); mac.String() != "ff:ff:ff:ff:ff:ff" {
+		t.Errorf("unexpected broadcast mac: %s", mac)
+	}
+}
+
+func TestMulticastMAC(t *testing.T) {
+	tests := map[string]string{
+		"224.0.0.1":       "01:00:5e:00:00:01",
+		"224.0.0.251":     "01:00:5e:00:00:fb",
+		"239.255.255.250": "01:00:5e:7f:ff:fa",
+		// the high-order bit of the second octet is dropped
+		"224.128.1.2": "01:00:5e:00:01:02",
+	}
+	for ip, expected := range tests {
+		mac, err := MulticastMAC(net.ParseIP(ip))
+		if err != nil {
+			t.Errorf("'%s': unexpected error: %s", ip, err)
+			continue
+		}
+		if mac.String() != expected {
+			t.Errorf("'%s': '%s' expected, but got: '%s'", ip, expected, mac)
+		}
+	}
+}
+
+func TestMulticastMACWithUnicastIP(t *testing.T) {
+	for _, ip := range []string{"192.168.1.1", "ff02::1", "invalid"} {
+		if _, err := MulticastMAC(net.ParseIP(ip)); err == nil {
+			t.Errorf("'%s': error expected", ip)
+		}
+	}
+}
+
+func TestPingOverVlanSubinterfaceByName(t *testing.T) {
+	parentMac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	vlanMac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x01, 0x00}
+	ifaces := map[string]*net.Interface{
+		"eth0":     {Index: 2, Name: "eth0", HardwareAddr: parentMac, Flags: net.FlagUp | net.FlagBroadcast},
+		"eth0.100": {Index: 7, Name: "eth0.100", HardwareAddr: vlanMac, Flags: net.FlagUp | net.FlagBroadcast},
+	}
+	errNoSuchInterface := errors.New("no such network interface")
+
+	origByName, origAddrs, origOpen := interfaceByName, interfaceAddrs, openSocket
+	interfaceByName = func(name string) (*net.Interface, error) {
+		if iface, ok := ifaces[name]; ok {
+			return iface, nil
+		}
+		return nil, errNoSuchInterface
+	}
+	interfaceAddrs = func(iface net.Interface) ([]net.Addr, error) {
+		return []net.Addr{&net.IPNet{IP: net.IPv4(10, 0, 100, 1).To4(), Mask: net.CIDRMask(24, 32)}}, nil
+	}
+	var opened net.Interface
+	sock := newFakeSocket(nil)
+	openSocket = func(iface net.Interface, cfg *config) (socket, error) {
+		opened = iface
+		return sock, nil
+	}
+	t.Cleanup(func() {
+		interfaceByName, interfaceAddrs, openSocket = origByName, origAddrs, origOpen
+	})
+
+	_, err := PingOverIfaceByName(net.ParseIP("10.0.100.2"), "eth0.100", WithTimeout(10*time.Millisecond))
+	if err != ErrTimeout {
+		t.Fatalf("ErrTimeout expected, but got: %v", err)
+	}
+	if opened.Index != 7 {
+		t.Errorf("socket over the subinterface index 7 expected, but got: %d", opened.Index)
+	}
+	if sent := sock.sentDatagrams(); len(sent) != 1 || !bytes.Equal(sent[0].sha, vlanMac) {
+		t.Errorf("request from the subinterface mac %s expected, but sent: %v", vlanMac, sent)
+	}
+
+	if _, err := PingOverIfaceByName(net.ParseIP("10.0.100.2"), "eth0.200"); !errors.Is(err, errNoSuchInterface) {
+		t.Errorf("wrapped lookup error expected, but got: %v", err)
+	}
+}
+
+func TestInterfaceRetry(t *testing.T) {
+	iface := loopbackInterface(t)
+	iface.HardwareAddr = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	errNotYetUp := errors.New("no such network interface")
+
+	lookups := 0
+	origByName := interfaceByName
+	interfaceByName = func(name string) (*net.Interface, error) {
+		lookups++
+		if lookups < 3 {
+			return nil, errNotYetUp
+		}
+		return &iface, nil
+	}
+	t.Cleanup(func() {
+		interfaceByName = origByName
+	})
+
+	// per default no retry
+	if _, err := findInterfaceByName("eth0", newConfig(nil)); !errors.Is(err, errNotYetUp) || lookups != 1 {
+		t.Errorf("a single failed lookup expected, but got: %d, %v", lookups, err)
+	}
+
+	lookups = 0
+	found, err := findInterfaceByName("eth0", newConfig([]Option{WithInterfaceRetry(3, time.Millisecond)}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lookups != 3 || found.Index != iface.Index {
+		t.Errorf("the interface after 3 lookups expected, but got: %d, %v", lookups, found)
+	}
+}
+
+func TestInterfaceCache(t *testing.T) {
+	lo := loopbackInterface(t)
+	origAddrs := interfaceAddrs
+	interfaceAddrs = func(iface net.Interface) ([]net.Addr, error) {
+		return []net.Addr{&net.IPNet{IP: net.ParseIP("10.0.0.1").To4(), Mask: net.CIDRMask(24, 32)}}, nil
+	}
+	selections := 0
+	SetInterfaceSelector(func(candidates []net.Interface, dstIP net.IP) (net.Interface, error) {
+		selections++
+		return lo, nil
+	})
+	t.Cleanup(func() {
+		interfaceAddrs = origAddrs
+		SetInterfaceSelector(nil)
+	})
+
+	cfg := newConfig([]Option{WithInterfaceCacheTTL(50 * time.Millisecond)})
+	for _, ip := range []string{"10.0.0.2", "10.0.0.3", "10.0.0.4"} {
+		if _, err := findUsableInterfaceForNetwork(net.ParseIP(ip), cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if selections != 1 {
+		t.Errorf("one enumeration for the same subnet expected, but got: %d", selections)
+	}
+
+	findUsableInterfaceForNetwork(net.ParseIP("10.0.1.2"), cfg)
+	if selections != 2 {
+		t.Errorf("another enumeration for another subnet expected, but got: %d", selections)
+	}
+
+	ClearInterfaceCache()
+	findUsableInterfaceForNetwork(net.ParseIP("10.0.0.2"), cfg)
+	time.Sleep(60 * time.Millisecond)
+	findUsableInterfaceForNetwork(net.ParseIP("10.0.0.2"), cfg)
+	if selections != 4 {
+		t.Errorf("enumerations after clearing and the expiry expected, but got: %d", selections)
+	}
+
+	findUsableInterfaceForNetwork(net.ParseIP("10.0.0.2"), newConfig(nil))
+	if selections != 5 {
+		t.Errorf("no caching expected per default, but got: %d enumerations", selections)
+	}
+}
+
+func TestFindIPInNetworkFromIfaceWithOverlappingNetworks(t *testing.T) {
+	origAddrs := interfaceAddrs
+	interfaceAddrs = func(iface net.Interface) ([]net.Addr, error) {
+		return []net.Addr{
+			&net.IPNet{IP: net.ParseIP("10.0.0.1").To4(), Mask: net.CIDRMask(16, 32)},
+			&net.IPNet{IP: net.ParseIP("10.0.5.1").To4(), Mask: net.CIDRMask(24, 32)},
+			&net.IPNet{IP: net.ParseIP("10.0.0.2").To4(), Mask: net.CIDRMask(16, 32)},
+		}, nil
+	}
+	t.Cleanup(func() {
+		interfaceAddrs = origAddrs
+	})
+
+	for dstIP, want := range map[string]string{"10.0.5.9": "10.0.5.1", "10.0.6.9": "10.0.0.1"} {
+		srcIP, err := findIPInNetworkFromIface(net.ParseIP(dstIP), net.Interface{Name: "eth0"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if srcIP.String() != want {
+			t.Errorf("source ip %s expected for %s, but got: %s", want, dstIP, srcIP)
+		}
+	}
+}
+
+func BenchmarkFindUsableInterface(b *testing.B) {
+	dstIP := net.ParseIP("127.0.0.2")
+	for _, ttl := range []time.Duration{0, time.Minute} {
+		b.Run("ttl="+ttl.String(), func(b *testing.B) {
+			ClearInterfaceCache()
+			cfg := newConfig([]Option{WithInterfaceCacheTTL(ttl)})
+			for i := 0; i < b.N; i++ {
+				if _, err := findUsableInterfaceForNetwork(dstIP, cfg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestExpectedSourceMAC(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	SetInterfaceSelector(func(candidates []net.Interface, dstIP net.IP) (net.Interface, error) {
+		return net.Interface{Index: 99, Name: "sel0", HardwareAddr: mac}, nil
+	})
+	t.Cleanup(func() {
+		SetInterfaceSelector(nil)
+	})
+
+	dstIP := net.ParseIP("10.0.0.2")
+	if got, err := ExpectedSourceMAC(dstIP); err != nil || got.String() != mac.String() {
+		t.Errorf("'%s' of the selected interface expected, but got: '%s' / %v", mac, got, err)
+	}
+	spoofed := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+	if got, err := ExpectedSourceMAC(dstIP, WithSourceMAC(spoofed)); err != nil || got.String() != spoofed.String() {
+		t.Errorf("'%s' per 'WithSourceMAC' expected, but got: '%s' / %v", spoofed, got, err)
+	}
+
+	if err := VerifySourceMAC(dstIP, mac); err != nil {
+		t.Errorf("no mismatch expected, but got: %v", err)
+	}
+	if err := VerifySourceMAC(dstIP, spoofed); !errors.Is(err, ErrSourceMacMismatch) {
+		t.Errorf("'ErrSourceMacMismatch' expected, but got: %v", err)
+	}
+}
+
+func TestFindInterfaceByNameWithoutEthernetAddress(t *testing.T) {
+	tun := &net.Interface{Index: 9, Name: "tun0", Flags: net.FlagUp | net.FlagPointToPoint}
+	origByName := interfaceByName
+	interfaceByName = func(name string) (*net.Interface, error) {
+		return tun, nil
+	}
+	t.Cleanup(func() {
+		interfaceByName = origByName
+	})
+
+	if _, err := findInterfaceByName("tun0", newConfig(nil)); !errors.Is(err, ErrUnsupportedInterface) {
+		t.Errorf("unsupported interface error expected, but got: %v", err)
+	}
+
+	// the source mac overrides the missing address of the interface
+	srcMac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x09}
+	found, err := findInterfaceByName("tun0", newConfig([]Option{WithSourceMAC(srcMac)}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Index != tun.Index {
+		t.Errorf("interface index %d expected, but got: %d", tun.Index, found.Index)
+	}
+}
@@ -0,0 +1,670 @@
+package arping
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Option configures a single ping or gratuitous arp call
+type Option func(*config)
+
+type config struct {
+	timeout             time.Duration
+	targetFilter        bool
+	acceptedLocalIPs    []net.IP
+	maxResults          int
+	stats               *Stats
+	netns               string
+	socketFD            int
+	allowSelf           bool
+	unicastMac          net.HardwareAddr
+	quietPeriod         time.Duration
+	sourceIP            net.IP
+	sourceMac           net.HardwareAddr
+	frameRate           int
+	sourceIPFallback    bool
+	zeroSource          bool
+	hideIgnored         bool
+	minFrameSize        int
+	bridgePortReporting bool
+	hardwareType        uint16
+	lenient             bool
+	acceptAnyFromTarget bool
+	matchByMACOnly      bool
+	probeTimeout        time.Duration
+	maxReplyAge         time.Duration
+	deadline            time.Time
+	progress            func(Progress)
+	socketConcurrency   int
+	targetMac           net.HardwareAddr
+	interfaceAttempts   int
+	interfaceRetryDelay time.Duration
+	interfaceCacheTTL   time.Duration
+	frameMutator        func(frame []byte) []byte
+	frameInspector      func(frame []byte) bool
+	socketFactory       SocketFactory
+	confirmations       *[]net.HardwareAddr
+	confirmationWindow  time.Duration
+	rate                int
+	maxInFlight         int
+	ethProto            uint16
+	excludeOutgoing     bool
+	unicastAfterFirst   bool
+	socketRetries       int
+	events              func(Event)
+}
+
+// appendOptions appends 'more' to 'opts' - without modifying the backing array of 'opts'
+func appendOptions(opts []Option, more ...Option) []Option {
+	return append(opts[:len(opts):len(opts)], more...)
+}
+
+func newConfig(opts []Option) *config {
+	cfg := &config{
+		timeout:  timeout,
+		socketFD: -1,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// WithTimeout sets the timeout for a single call - overrides the global timeout from 'SetTimeout'.
+//
+// When the call also gets a context with a deadline, the earlier one of both is effective.
+func WithTimeout(t time.Duration) Option {
+	return func(cfg *config) {
+		cfg.timeout = t
+	}
+}
+
+// WithProbeTimeout sets how long to wait for the replies to a single probe - overrides 'WithTimeout' for probes.
+//
+// Multi-probe operations, such as 'PingN' or 'PingManyContext', wait that long after the last probe.
+// Use 'WithDeadline' to bound the whole operation.
+func WithProbeTimeout(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.probeTimeout = d
+	}
+}
+
+// WithMaxReplyAge discards replies received later than 'd' after their probe - per default any reply within
+// the timeout is accepted.
+//
+// Busy switches can delay a reply that long, that 'PingN' attributes it to the wrong probe and skews the round
+// trip times. A reply is only attributed to a probe sent at most 'd' before it - see 'Stats.Late' for the discarded.
+func WithMaxReplyAge(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.maxReplyAge = d
+	}
+}
+
+// WithUnicastAfterFirst sends the probes of 'PingN' to the hardware address of the first reply, instead of
+// broadcasting them - less broadcast noise on long probe sequences. Only the ethernet destination changes,
+// the arp datagram stays the same.
+func WithUnicastAfterFirst() Option {
+	return func(cfg *config) {
+		cfg.unicastAfterFirst = true
+	}
+}
+
+// WithDeadline sets the deadline of the whole operation - such as all probes of 'PingN'.
+//
+// When the deadline passes with probes remaining, the operation stops and returns the replies until then
+// - or 'ErrTimeout' if there are none. As with context deadlines, the earliest deadline is effective.
+func WithDeadline(t time.Time) Option {
+	return func(cfg *config) {
+		cfg.deadline = t
+	}
+}
+
+// WithTargetFilter installs a kernel packet filter, which passes only arp replies from the pinged ip.
+//
+// This reduces the parsing overhead on busy links - the replies are still verified per 'IsResponseOf'.
+func WithTargetFilter() Option {
+	return func(cfg *config) {
+		cfg.targetFilter = true
+	}
+}
+
+// WithAcceptedLocalIPs accepts replies targeted to one of 'ips' - in addition to the sender ip of the request.
+//
+// Useful in anycast or VIP setups, where a reply can target an address we serve,
+// but which we didn't send from. See 'LocalAddresses' to get the addresses of an interface.
+func WithAcceptedLocalIPs(ips []net.IP) Option {
+	return func(cfg *config) {
+		cfg.acceptedLocalIPs = ips
+	}
+}
+
+// WithMaxResults limits the number of stored results to 'n' - further replies are only counted.
+//
+// This bounds the memory on floods of replies. Use 'WithStats' to get the count of all replies.
+func WithMaxResults(n int) Option {
+	return func(cfg *config) {
+		cfg.maxResults = n
+	}
+}
+
+// WithStats fills 's' with the statistics of the call, when the call returns
+func WithStats(s *Stats) Option {
+	return func(cfg *config) {
+		cfg.stats = s
+	}
+}
+
+// WithNetNS runs the interface lookup and the socket setup within the network namespace 'path',
+// such as '/proc/<PID>/ns/net' - only supported under linux.
+//
+// The calling goroutine gets locked to its os thread, which enters the namespace per setns(2),
+// and returns to its original namespace when the setup is done. The socket stays in the namespace.
+// This requires CAP_SYS_ADMIN to switch the namespace, and CAP_NET_RAW for the raw socket.
+func WithNetNS(path string) Option {
+	return func(cfg *config) {
+		cfg.netns = path
+	}
+}
+
+// WithSocketFD uses the externally created socket 'fd' instead of opening a new one.
+//
+// under linux: a raw AF_PACKET socket, under BSD: an opened '/dev/bpfX' device.
+// The caller keeps the ownership of 'fd' - it doesn't get closed, nor bound to the interface.
+// Under BSD the device isn't configured either: the caller sets the interface, the immediate mode and the
+// read filter - and the direction filter for 'WithExcludeOutgoing'.
+func WithSocketFD(fd int) Option {
+	return func(cfg *config) {
+		cfg.socketFD = fd
+	}
+}
+
+// WithAllowSelf accepts replies from our own hardware address.
+//
+// Per default they are ignored, because hairpinning switches reflect our own frames.
+func WithAllowSelf() Option {
+	return func(cfg *config) {
+		cfg.allowSelf = true
+	}
+}
+
+// WithQuietPeriod stops collecting replies, when no further reply arrived within 'd' after the last one.
+//
+// Per default replies are collected until the timeout - to catch late duplicates.
+// With a quiet period the call returns faster on quiet networks.
+func WithQuietPeriod(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.quietPeriod = d
+	}
+}
+
+// WithSourceIP sends the requests from 'ip' - instead of our address in the network of the target.
+//
+// Useful to probe from an address which isn't (yet) configured, such as during a VIP migration.
+// Gratuitous arps announce the given ip regardless of this option.
+func WithSourceIP(ip net.IP) Option {
+	return func(cfg *config) {
+		cfg.sourceIP = ip
+	}
+}
+
+// WithSourceIPFallback retries the ping from the next address of the interface, when it timed out without reply
+// - before declaring the host offline. See 'Result.SourceIP' for the address which finally worked.
+//
+// Useful on interfaces with multiple addresses, when the target only replies to its own subnet.
+// The address in the network of the target is tried first. Every try waits up to the timeout,
+// the deadline from the context bounds all of them. Has no effect together with 'WithSourceIP'.
+func WithSourceIPFallback() Option {
+	return func(cfg *config) {
+		cfg.sourceIPFallback = true
+	}
+}
+
+// WithZeroSource sends the requests from the unspecified address 0.0.0.0 - such as the probes of RFC 5227.
+//
+// Pings work over interfaces without a v4 address, such as bridge ports or interfaces only used on layer 2.
+// The replies are matched by their sender ip - the target of the request.
+// Overrides 'WithSourceIP' and 'WithSourceIPFallback'. Pass the interface, as it can't be found per the target network.
+func WithZeroSource() Option {
+	return func(cfg *config) {
+		cfg.zeroSource = true
+	}
+}
+
+// WithIgnoredFrameLog controls whether the verbose log reports every received arp, which isn't a reply to us
+// - enabled per default. Disable it to keep the verbose log readable on busy networks, the replies are still logged,
+// as are the totals of the received, matched and ignored frames at the end of the call.
+func WithIgnoredFrameLog(enabled bool) Option {
+	return func(cfg *config) {
+		cfg.hideIgnored = !enabled
+	}
+}
+
+// WithFrameMutator passes every outgoing frame to 'mutate' and sends the returned frame instead
+// - such as to add headers, tags or checksums for custom hardware offload or encapsulation.
+//
+// 'mutate' gets the complete ethernet frame, as built per the other options, and the caller is responsible
+// that it returns a valid frame: it's sent as is, the replies are matched to the unmodified request.
+// 'mutate' may modify the frame in place. Applies to the requests and announcements, not to 'SendRaw'.
+func WithFrameMutator(mutate func(frame []byte) []byte) Option {
+	return func(cfg *config) {
+		cfg.frameMutator = mutate
+	}
+}
+
+// WithFrameInspector passes every received frame to 'inspect' - the frame is dropped if it returns false.
+// Useful for filters beyond the kernel filter, such as per VLAN or per source subnet.
+//
+// 'inspect' runs after the kernel filter - see 'WithTargetFilter' - and before the frame is parsed and matched
+// to the requests. It gets the complete ethernet frame, which it mustn't modify or retain.
+// Dropped frames aren't counted per 'SocketStats'. Doesn't apply to 'ReceiveRaw'.
+func WithFrameInspector(inspect func(frame []byte) bool) Option {
+	return func(cfg *config) {
+		cfg.frameInspector = inspect
+	}
+}
+
+// WithSocketFactory opens the sockets per 'factory' instead of the platform sockets
+// - such as an in-memory network to test without privileges, or a userspace network stack.
+//
+// The 'FrameSocket' sends and receives complete ethernet frames. Without a kernel filter it may return any frame:
+// they are parsed and matched to the requests as usual. Doesn't apply to 'SendRaw' and 'ReceiveRaw'.
+func WithSocketFactory(factory SocketFactory) Option {
+	return func(cfg *config) {
+		cfg.socketFactory = factory
+	}
+}
+
+// WithAnnounceConfirmation listens for 'window' after the gratuitous arps, and fills 'neighbors' with the hardware
+// addresses of the hosts, which sent an arp request for the announced ip - such as a neighbor checking a new VIP.
+// This confirms the announcement was noticed. 'neighbors' is empty if no host asked, which isn't an error.
+//
+// The requests are collected from the first announcement on. Applies to the gratuitous arps only.
+func WithAnnounceConfirmation(window time.Duration, neighbors *[]net.HardwareAddr) Option {
+	return func(cfg *config) {
+		cfg.confirmationWindow = window
+		cfg.confirmations = neighbors
+	}
+}
+
+// WithSourceMAC sends the requests with the sender hardware address 'mac' - instead of the interface address.
+//
+// 'mac' must be a 6 byte ethernet address - it's also used as the source of the ethernet frame.
+func WithSourceMAC(mac net.HardwareAddr) Option {
+	return func(cfg *config) {
+		cfg.sourceMac = mac
+	}
+}
+
+// WithTargetMAC sets the target hardware address field of the sent requests and gratuitous arps to 'mac'
+// - instead of the destination of the frame, such as the broadcast address.
+//
+// Strict peers expect the all-zero address in requests - use 'make(net.HardwareAddr, 6)'.
+// The destination of the ethernet frame is unchanged.
+func WithTargetMAC(mac net.HardwareAddr) Option {
+	return func(cfg *config) {
+		cfg.targetMac = mac
+	}
+}
+
+// WithInterfaceRetry tries the interface lookup up to 'attempts' times - with 'delay' between them,
+// before the call fails. Applies to the auto-detection and the lookup per name.
+//
+// Smooths the startup races in init scripts and containers, where the interface or its address isn't up yet.
+// Per default the lookup isn't retried.
+func WithInterfaceRetry(attempts int, delay time.Duration) Option {
+	return func(cfg *config) {
+		cfg.interfaceAttempts = attempts
+		cfg.interfaceRetryDelay = delay
+	}
+}
+
+// WithInterfaceCacheTTL caches the interface found for the network of the target for 'ttl' - disabled per default.
+//
+// Repeated pings without a given interface, such as in a loop, skip the enumeration of all interfaces
+// for targets in the same subnet. Changes of the interfaces are missed until the ttl expired
+// - see 'ClearInterfaceCache' to drop the cache earlier.
+func WithInterfaceCacheTTL(ttl time.Duration) Option {
+	return func(cfg *config) {
+		cfg.interfaceCacheTTL = ttl
+	}
+}
+
+// WithFrameRateLimit delivers at most 'perSecond' frames per second to the callback of 'Sniff' - with bursts up to it.
+//
+// Excess frames are dropped and counted in 'Stats.Dropped' - this protects slow consumers on busy networks,
+// as a slow callback would let the kernel buffer overflow.
+func WithFrameRateLimit(perSecond int) Option {
+	return func(cfg *config) {
+		cfg.frameRate = perSecond
+	}
+}
+
+// WithExcludeOutgoing drops the frames sent by this host in the sniffers - such as our own announcements,
+// which a conflict or gratuitous arp watcher mustn't react to. It applies to the frames of all processes,
+// and to all sockets of the call.
+//
+// The kernel tells the direction: the packet type 'PACKET_OUTGOING' under linux, the bpf device per
+// 'BIOCSSEESENT' or 'BIOCSDIRFILT' under BSD. Has no effect with 'WithSocketFactory'.
+func WithExcludeOutgoing() Option {
+	return func(cfg *config) {
+		cfg.excludeOutgoing = true
+	}
+}
+
+// WithMinFrameSize zero pads the sent ethernet frames to at least 'n' bytes - without the frame check sequence.
+//
+// Per default the frames are padded to the ethernet minimum of 60 bytes. Useful for picky hardware,
+// or to compare captures in tests. Frames exceeding the MTU of the interface are rejected with an error.
+func WithMinFrameSize(n int) Option {
+	return func(cfg *config) {
+		cfg.minFrameSize = n
+	}
+}
+
+// WithBridgePortReporting annotates the results with the bridge port, which learned the replying hardware address
+// - see 'Result.BridgePort'. A diagnostic aid to map the L2 topology behind a linux bridge.
+//
+// The port is read from the bridge forwarding database per netlink after the ping.
+// A no-op if the interface isn't a bridge, and under BSD.
+func WithBridgePortReporting() Option {
+	return func(cfg *config) {
+		cfg.bridgePortReporting = true
+	}
+}
+
+// WithMatchByMACOnly accepts any reply to our sender addresses - whatever its sender ip.
+//
+// For odd hosts with multiple addresses, which answer a request for one address from another one,
+// such as their primary. 'Result.IP' is then the address the reply came from.
+// Use it cautiously: any reply to us is taken as the reply of the target, such as a late reply to an earlier ping.
+// Scans file the replies by their sender ip - there it has no effect.
+// The kernel filter per 'WithTargetFilter' is skipped, as it passes replies from the target ip only.
+func WithMatchByMACOnly() Option {
+	return func(cfg *config) {
+		cfg.matchByMACOnly = true
+	}
+}
+
+// WithAcceptAnyFromTarget accepts any arp frame from the target ip as proof of liveness - also requests.
+//
+// This catches chatty devices, which don't answer our request. The hardware address of such a result
+// is the sender of the observed frame. The kernel filter per 'WithTargetFilter' is skipped, as it passes replies only.
+func WithAcceptAnyFromTarget() Option {
+	return func(cfg *config) {
+		cfg.acceptAnyFromTarget = true
+	}
+}
+
+// WithHardwareType sends the requests with the arp hardware type 'ht' - instead of 1 for ethernet.
+//
+// For protocol conformance tests only - most users should never set this, as hosts ignore unknown types.
+// Replies must carry the same hardware type, unless 'WithLenient' is given.
+func WithHardwareType(ht uint16) Option {
+	return func(cfg *config) {
+		cfg.hardwareType = ht
+	}
+}
+
+// WithLenient accepts replies, which don't match the hardware type per 'WithHardwareType'
+func WithLenient() Option {
+	return func(cfg *config) {
+		cfg.lenient = true
+	}
+}
+
+// WithProgress calls 'fn' with the progress of multi-target operations, such as 'PingManyContext' or 'ScanCIDR'
+// - after every sent probe and every new responder, one call at a time.
+//
+// 'fn' blocks the sending and receiving - keep it short.
+func WithProgress(fn func(Progress)) Option {
+	return func(cfg *config) {
+		cfg.progress = fn
+	}
+}
+
+// WithSocketConcurrency scans over 'n' sockets per interface - instead of a single one.
+//
+// The targets are sharded round robin over the sockets and sent concurrently, the results are merged.
+// Useful for huge scans, such as of a /16, when a single socket bottlenecks. Every socket receives all arp frames
+// of the interface, so keep 'n' small. Has no effect together with 'WithSocketFD'.
+func WithSocketConcurrency(n int) Option {
+	return func(cfg *config) {
+		cfg.socketConcurrency = n
+	}
+}
+
+// WithRate sends at most 'perSecond' requests per second per interface in scans, such as 'ScanCIDR'
+// and 'PingMany' - evenly spaced over all sockets of the interface. Combine with 'WithMaxInFlight'
+// to tune scans on constrained links.
+func WithRate(perSecond int) Option {
+	return func(cfg *config) {
+		cfg.rate = perSecond
+	}
+}
+
+// WithMaxInFlight bounds the requests awaiting a reply per interface in scans to 'n' - a request is in flight
+// until its first reply or until the probe timeout, see 'WithProbeTimeout'. Further requests wait for a free slot.
+func WithMaxInFlight(n int) Option {
+	return func(cfg *config) {
+		cfg.maxInFlight = n
+	}
+}
+
+// WithSocketRetry reopens the socket on a recoverable error, such as ENOBUFS under memory pressure,
+// and retries the send or receive - up to 'attempts' times per call. Fatal errors, such as a missing
+// privilege or a removed interface, fail the call as before. Has no effect together with 'WithSocketFD'.
+func WithSocketRetry(attempts int) Option {
+	return func(cfg *config) {
+		cfg.socketRetries = attempts
+	}
+}
+
+// withUnicast sends the request to 'mac' instead of broadcasting it - see 'PingUnicast'
+func withUnicast(mac net.HardwareAddr) Option {
+	return func(cfg *config) {
+		cfg.unicastMac = mac
+	}
+}
+
+// withEthProto opens the sockets for ether type 'ethProto' instead of arp - see 'SniffProto'
+func withEthProto(ethProto uint16) Option {
+	return func(cfg *config) {
+		cfg.ethProto = ethProto
+	}
+}
+
+// withEvents passes the lifecycle events of a ping to 'fn' - see 'PingWithEvents'
+func withEvents(fn func(Event)) Option {
+	return func(cfg *config) {
+		cfg.events = fn
+	}
+}
+
+// scanSockets returns the number of sockets per 'WithSocketConcurrency' to scan 'targets' targets
+func (cfg *config) scanSockets(targets int) int {
+	n := cfg.socketConcurrency
+	if n > targets {
+		n = targets
+	}
+	if n < 1 || cfg.socketFD >= 0 {
+		n = 1
+	}
+	return n
+}
+
+// srcIP returns the sender ip of requests to 'dstIP' over interface 'iface'
+func (cfg *config) srcIP(dstIP net.IP, iface net.Interface) (net.IP, error) {
+	if cfg.zeroSource {
+		return net.IPv4zero.To4(), nil
+	}
+	if cfg.sourceIP != nil {
+		if err := validateIP(cfg.sourceIP); err != nil {
+			return nil, err
+		}
+		return cfg.sourceIP.To4(), nil
+	}
+	return findIPInNetworkFromIface(dstIP, iface)
+}
+
+// srcMac returns the sender hardware address of requests over interface 'iface'
+func (cfg *config) srcMac(iface net.Interface) net.HardwareAddr {
+	if cfg.sourceMac != nil {
+		return cfg.sourceMac
+	}
+	return iface.HardwareAddr
+}
+
+// newArpRequest returns a request per 'newArpRequest' - padded per 'WithMinFrameSize',
+// with the hardware type per 'WithHardwareType' and the target hardware address per 'WithTargetMAC'
+func (cfg *config) newArpRequest(srcMac net.HardwareAddr, srcIP net.IP, dstMac net.HardwareAddr, dstIP net.IP) arpDatagram {
+	request := newArpRequest(srcMac, srcIP, dstMac, dstIP)
+	request.minFrameSize = cfg.minFrameSize
+	if cfg.targetMac != nil {
+		request.ethDst = dstMac
+		request.tha = cfg.targetMac
+	}
+	if cfg.hardwareType != 0 {
+		request.htype = cfg.hardwareType
+	}
+	return request
+}
+
+// retryInterfaceLookup calls 'lookup' until it succeeds - at most per 'WithInterfaceRetry'
+func (cfg *config) retryInterfaceLookup(lookup func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := lookup()
+		if err == nil || attempt >= cfg.interfaceAttempts {
+			return err
+		}
+		verboseLog.Printf("interface lookup failed: %s - retry %d of %d in %s\n",
+			err, attempt, cfg.interfaceAttempts-1, cfg.interfaceRetryDelay)
+		time.Sleep(cfg.interfaceRetryDelay)
+	}
+}
+
+// checkMTU returns an error if the sent frames exceed the MTU of 'iface' - such as per 'WithMinFrameSize',
+// as they would be truncated or dropped silently
+func (cfg *config) checkMTU(iface net.Interface) error {
+	if iface.MTU <= 0 {
+		return nil
+	}
+	request := cfg.newArpRequest(cfg.srcMac(iface), net.IPv4zero, cfg.dstMac(), net.IPv4zero)
+	if payload := len(request.MarshalWithEthernetHeader()) - ethernetHeaderLen; payload > iface.MTU {
+		return fmt.Errorf("frame payload of %d bytes exceeds the MTU of %d bytes of interface '%s'",
+			payload, iface.MTU, iface.Name)
+	}
+	return nil
+}
+
+// dstMac returns the destination hardware address of requests
+func (cfg *config) dstMac() net.HardwareAddr {
+	if cfg.unicastMac != nil {
+		return cfg.unicastMac
+	}
+	return BroadcastMAC()
+}
+
+// isResponse returns true if 'response' is an accepted response of 'request'
+func (cfg *config) isResponse(response, request arpDatagram) bool {
+	if !cfg.allowSelf && response.isFromSenderOf(request) {
+		return false
+	}
+	if cfg.hardwareType != 0 && !cfg.lenient && response.htype != request.htype {
+		return false
+	}
+	if cfg.matchByMACOnly && response.isAddressedTo(request) {
+		return true
+	}
+	if cfg.acceptAnyFromTarget && response.isFromTargetOf(request) {
+		return true
+	}
+	if cfg.zeroSource && response.oper == responseOper && response.isFromTargetOf(request) {
+		// the target replies to 0.0.0.0 or to any address - there is no sender ip to match
+		return true
+	}
+	return response.IsResponseOf(request) || response.isResponseTo(request, cfg.acceptedLocalIPs)
+}
+
+// logIgnored logs 'response' as ignored - unless disabled per 'WithIgnoredFrameLog'
+func (cfg *config) logIgnored(response arpDatagram) {
+	if !cfg.hideIgnored {
+		verboseLog.Printf("ignore received arp: srcIP: '%s', srcMac: '%s'\n", response.SenderIP(), response.SenderMac())
+	}
+}
+
+// storeResult returns true if a further result can be stored, when 'n' results are already stored
+func (cfg *config) storeResult(n int) bool {
+	return cfg.maxResults <= 0 || n < cfg.maxResults
+}
+
+// logFrameSummary logs the totals of the received frames of a call - the ignored ones aren't logged
+// per frame on busy networks, see 'WithIgnoredFrameLog'
+func (cfg *config) logFrameSummary(stats Stats) {
+	verboseLog.Printf("received %d arp frames, %d matched, %d ignored\n",
+		stats.Socket.Received, stats.Replies+stats.Late, stats.Ignored)
+}
+
+// reportStats reports 'stats' per 'WithStats'
+func (cfg *config) reportStats(stats Stats) {
+	if cfg.stats != nil {
+		*cfg.stats = stats
+	}
+}
+
+// withDeadline returns a context which is done at the effective deadline of a single probe:
+// the earliest one of the deadline from 'ctx', the deadline per 'WithDeadline' and the probe timeout
+func (cfg *config) withDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := cfg.withOverallDeadline(ctx)
+	ctx, cancelProbe := context.WithTimeout(ctx, cfg.effectiveProbeTimeout())
+	return ctx, func() {
+		cancelProbe()
+		cancel()
+	}
+}
+
+// withOverallDeadline returns a context which is done at the deadline per 'WithDeadline' - or when 'ctx' is done
+func (cfg *config) withOverallDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if cfg.deadline.IsZero() {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, cfg.deadline)
+}
+
+// isLate returns true if a reply after 'duration' is older than the max age per 'WithMaxReplyAge'
+func (cfg *config) isLate(duration time.Duration) bool {
+	return cfg.maxReplyAge > 0 && duration > cfg.maxReplyAge
+}
+
+// socketProto returns the ether type of the sockets per 'withEthProto' - arp per default
+func (cfg *config) socketProto() uint16 {
+	if cfg.ethProto == 0 {
+		return EthPArp
+	}
+	return cfg.ethProto
+}
+
+// effectiveProbeTimeout returns the timeout per 'WithProbeTimeout' - or the timeout per 'WithTimeout'
+func (cfg *config) effectiveProbeTimeout() time.Duration {
+	if cfg.probeTimeout > 0 {
+		return cfg.probeTimeout
+	}
+	return cfg.timeout
+}
+
+// probeDeadline returns the effective deadline of a single probe sent now - without a context
+func (cfg *config) probeDeadline() time.Time {
+	deadline := time.Now().Add(cfg.effectiveProbeTimeout())
+	if !cfg.deadline.IsZero() && cfg.deadline.Before(deadline) {
+		return cfg.deadline
+	}
+	return deadline
+}
+
+// emit passes 'event' to the event consumer per 'withEvents' - a no-op without it
+func (cfg *config) emit(event Event) {
+	if cfg.events != nil {
+		cfg.events(event)
+	}
+}
@@ -0,0 +1,342 @@
+package arping
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// PingN sends 'count' arp pings to 'dstIP' - see 'PingNOverIfaceContext'
+func PingN(dstIP net.IP, count int, interval time.Duration, opts ...Option) ([]Result, error) {
+	return PingNContext(context.Background(), dstIP, count, interval, opts...)
+}
+
+// PingNContext sends 'count' arp pings to 'dstIP' - see 'PingNOverIfaceContext'
+func PingNContext(ctx context.Context, dstIP net.IP, count int, interval time.Duration, opts ...Option) ([]Result, error) {
+	if err := validateIP(dstIP); err != nil {
+		return nil, err
+	}
+
+	iface, err := findUsableInterfaceForNetwork(dstIP, newConfig(opts))
+	if err != nil {
+		return nil, err
+	}
+	return PingNOverIfaceContext(ctx, dstIP, *iface, count, interval, opts...)
+}
+
+// PingNOverIfaceContext sends 'count' arp pings over interface 'iface' to 'dstIP' - with 'interval' between them,
+// all over a single socket. Replies are collected until the probe timeout after the last probe - see 'WithProbeTimeout',
+// or until 'ctx' is done or the deadline per 'WithDeadline' passed - with the replies until then.
+//
+// Arp has no sequence field and all probes are identical, so the send time of every probe is tracked and a reply
+// is attributed to a probe per its receive time - reported as 'Result.ProbeIndex':
+//   - the latest probe sent before the reply was received, if that one is unanswered yet
+//   - otherwise the oldest earlier probe without reply - a delayed reply, counted as reordered
+//   - otherwise the latest probe again - a further reply to an answered probe, flagged per 'Result.Duplicate' and
+//     counted as duplicated: a host replying twice, or an echo of our own retransmission on the link
+//
+// Probes sent longer than the max age per 'WithMaxReplyAge' before the reply are skipped - a reply older than all
+// of them is late. 'Result.Duration' is measured from the send time of the attributed probe.
+// The heuristic can't tell a delayed reply from a reply to a later probe, if it arrives after that one was sent.
+// See 'Stats' - per 'WithStats' - for the totals.
+// Returns 'ErrTimeout' if no probe got replied.
+func PingNOverIfaceContext(ctx context.Context, dstIP net.IP, iface net.Interface, count int,
+	interval time.Duration, opts ...Option) ([]Result, error) {
+	start := time.Now()
+	if err := validateIP(dstIP); err != nil {
+		return nil, err
+	}
+	if count < 1 {
+		return nil, fmt.Errorf("invalid count: %d - at least 1 probe expected", count)
+	}
+	cfg := newConfig(opts)
+
+	srcIP, sock, err := openPingSocket(iface, dstIP, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	request := cfg.newArpRequest(cfg.srcMac(iface), srcIP, cfg.dstMac(), dstIP)
+
+	type received struct {
+		response    arpDatagram
+		receiveTime time.Time
+		err         error
+	}
+	receivedChan := make(chan received)
+
+	ctx, cancel := cfg.withOverallDeadline(ctx)
+	defer cancel()
+
+	go func() {
+		defer sock.deinitialize()
+
+		for ctx.Err() == nil {
+			response, receiveTime, err := sock.receive(time.Now().Add(pollInterval))
+			if err == ErrTimeout {
+				continue
+			}
+			select {
+			case receivedChan <- received{response, receiveTime, err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var stats Stats
+	var durations []time.Duration
+	defer func() {
+		stats.Socket = socketStatsOf(sock)
+		stats.Jitter = jitter(durations)
+		cfg.logFrameSummary(stats)
+		cfg.reportStats(stats)
+	}()
+
+	var sendTimes []time.Time
+	var answered []bool
+	// unicast is true once the probes are sent to the learned mac - see 'WithUnicastAfterFirst'
+	var unicast bool
+	results := make([]Result, 0)
+
+	// 'next' fires for the next probe - 'done' after the timeout after the last probe
+	next := time.After(0)
+	var done <-chan time.Time
+
+Break:
+	for {
+		select {
+		case <-next:
+			verboseLog.Printf("arping '%s' over interface: %s with address: '%s' - seq: %d\n",
+				dstIP, ifaceFingerprint(iface, request.SenderMac()), srcIP, len(sendTimes))
+			sendTime, err := sock.send(request)
+			if err != nil {
+				return nil, err
+			}
+			sendTimes = append(sendTimes, sendTime)
+			answered = append(answered, false)
+			stats.Sent++
+
+			if len(sendTimes) < count {
+				next = time.After(interval)
+			} else {
+				next = nil
+				done = time.After(cfg.effectiveProbeTimeout())
+			}
+		case r := <-receivedChan:
+			if r.err != nil {
+				return nil, r.err
+			}
+			if !cfg.isResponse(r.response, request) {
+				stats.Ignored++
+				cfg.logIgnored(r.response)
+				continue
+			}
+			seq := attributeReply(sendTimes, answered, r.receiveTime, cfg.maxReplyAge, &stats)
+			if seq == lateReply {
+				stats.Late++
+				continue
+			}
+			stats.Replies++
+			stats.firstReply(start, r.receiveTime)
+			if seq < 0 {
+				continue
+			}
+			duplicate := answered[seq]
+			answered[seq] = true
+			if cfg.unicastAfterFirst && !unicast {
+				verboseLog.Printf("send the next probes unicast to: '%s'\n", r.response.SenderMac())
+				request.ethDst = r.response.SenderMac()
+				unicast = true
+			}
+			duration := r.receiveTime.Sub(sendTimes[seq])
+			durations = append(durations, duration)
+			if cfg.storeResult(len(results)) {
+				result := newResult(r.response, request, duration, iface)
+				result.ProbeIndex = seq
+				result.Duplicate = duplicate
+				results = append(results, result)
+			}
+		case <-done:
+			break Break
+		case <-ctx.Done():
+			break Break
+		}
+	}
+
+	for _, ok := range answered {
+		if !ok {
+			stats.Lost++
+		}
+	}
+
+	if ctx.Err() == context.Canceled {
+		return nil, ctx.Err()
+	}
+	if len(results) == 0 {
+		return nil, ErrTimeout
+	}
+	return results, nil
+}
+
+// lateReply is returned by 'attributeReply' for replies older than the max age - see 'WithMaxReplyAge'
+const lateReply = -2
+
+// attributeReply returns the index of the probe, which a reply received at 'receiveTime' is attributed to
+// - see 'PingNOverIfaceContext'. Returns -1 if no probe was sent before it, or 'lateReply' if the reply is older
+// than 'maxAge' relative to every probe it could be attributed to - any age is accepted if 'maxAge' <= 0.
+func attributeReply(sendTimes []time.Time, answered []bool, receiveTime time.Time, maxAge time.Duration,
+	stats *Stats) int {
+	young := func(seq int) bool {
+		return maxAge <= 0 || receiveTime.Sub(sendTimes[seq]) <= maxAge
+	}
+
+	latest := -1
+	for seq, sendTime := range sendTimes {
+		if !sendTime.After(receiveTime) {
+			latest = seq
+		}
+	}
+	if latest < 0 {
+		return latest
+	}
+	if !young(latest) {
+		// the earlier probes are even older
+		return lateReply
+	}
+	if !answered[latest] {
+		return latest
+	}
+
+	for seq := 0; seq < latest; seq++ {
+		if !answered[seq] && young(seq) {
+			stats.Reordered++
+			return seq
+		}
+	}
+	stats.Duplicated++
+	return latest
+}
+
+// PingLoop pings 'dstIP' every 'interval' until 'ctx' is done - see 'PingLoopOverIface'
+func PingLoop(ctx context.Context, dstIP net.IP, interval time.Duration, onProbe func(result Result, up bool),
+	opts ...Option) error {
+	if err := validateIP(dstIP); err != nil {
+		return err
+	}
+
+	iface, err := findUsableInterfaceForNetwork(dstIP, newConfig(opts))
+	if err != nil {
+		return err
+	}
+	return PingLoopOverIface(ctx, dstIP, *iface, interval, onProbe, opts...)
+}
+
+// PingLoopOverIface pings 'dstIP' over interface 'iface' every 'interval' until 'ctx' is done,
+// or the deadline per 'WithDeadline' passed - such as to watch a host reboot.
+//
+// 'onProbe' is called per probe in the calling goroutine: with the first reply and 'up' set, as soon as it's received
+// - or with 'up' unset after the probe timeout without reply. Every probe waits at most the probe timeout,
+// see 'WithProbeTimeout' - it should be shorter than 'interval'.
+// Returns the error from 'ctx' - or the error which stopped the loop.
+func PingLoopOverIface(ctx context.Context, dstIP net.IP, iface net.Interface, interval time.Duration,
+	onProbe func(result Result, up bool), opts ...Option) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid interval: %s - a positive duration expected", interval)
+	}
+	cfg := newConfig(opts)
+
+	ctx, cancel := cfg.withOverallDeadline(ctx)
+	defer cancel()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		var reply Result
+		err := PingOverIfaceFuncContext(ctx, dstIP, iface, func(result Result) bool {
+			reply = result
+			return false
+		}, opts...)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil && err != ErrTimeout {
+			return err
+		}
+		onProbe(reply, err == nil)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// ProbeFromAllLocalSubnets pings 'dstIP' from every local address - see 'ProbeFromAllLocalSubnetsOverIfaceContext'
+func ProbeFromAllLocalSubnets(dstIP net.IP, opts ...Option) ([]Result, error) {
+	return ProbeFromAllLocalSubnetsContext(context.Background(), dstIP, opts...)
+}
+
+// ProbeFromAllLocalSubnetsContext pings 'dstIP' from every address of the interface
+// - see 'ProbeFromAllLocalSubnetsOverIfaceContext'
+func ProbeFromAllLocalSubnetsContext(ctx context.Context, dstIP net.IP, opts ...Option) ([]Result, error) {
+	if err := validateIP(dstIP); err != nil {
+		return nil, err
+	}
+
+	iface, err := findUsableInterfaceForNetwork(dstIP, newConfig(opts))
+	if err != nil {
+		return nil, err
+	}
+	return ProbeFromAllLocalSubnetsOverIfaceContext(ctx, dstIP, *iface, opts...)
+}
+
+// ProbeFromAllLocalSubnetsOverIfaceContext pings 'dstIP' over interface 'iface' from every v4 address of it,
+// one after another - to discover hidden devices, which only reply to requests from specific subnets.
+//
+// The address in the network of 'dstIP' goes first. Unlike 'WithSourceIPFallback', all addresses are tried:
+// the results of all of them are returned, see 'Result.SourceIP' for the address which got replied.
+// Every address waits up to the timeout, the deadline from the context bounds all of them.
+// Returns 'ErrTimeout' if no address got replied. 'WithSourceIP' is ignored.
+func ProbeFromAllLocalSubnetsOverIfaceContext(ctx context.Context, dstIP net.IP, iface net.Interface,
+	opts ...Option) ([]Result, error) {
+	if err := validateIP(dstIP); err != nil {
+		return nil, err
+	}
+	cfg := newConfig(opts)
+
+	var candidates []net.IP
+	err := inNetNS(cfg.netns, func() (err error) {
+		candidates, err = sourceIPCandidates(dstIP, iface)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, 0)
+	for _, srcIP := range candidates {
+		replies, err := PingOverIfaceContext(ctx, dstIP, iface, appendOptions(opts, WithSourceIP(srcIP))...)
+		if err == ErrTimeout {
+			if ctx.Err() != nil {
+				break
+			}
+			verboseLog.Printf("no reply to '%s' from address: '%s'\n", dstIP, srcIP)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, replies...)
+	}
+	if len(results) == 0 {
+		return nil, ErrTimeout
+	}
+	return results, nil
+}
@@ -0,0 +1,295 @@
+package arping
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPingNStats(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	probes := 0
+	sock := newFakeSocket(nil)
+	sock.respond = func(request arpDatagram) []arpDatagram {
+		probes++
+		switch probes {
+		case 1:
+			// lost - but answered late, after the second probe got answered
+			return nil
+		case 2:
+			reply := newArpReply(request, mac)
+			return []arpDatagram{reply, reply}
+		case 3:
+			// duplicated
+			reply := newArpReply(request, mac)
+			return []arpDatagram{reply, reply}
+		}
+		return nil
+	}
+	useFakeSocket(t, sock)
+
+	var stats Stats
+	results, err := PingNOverIfaceContext(context.Background(), net.ParseIP("127.0.0.2"), loopbackInterface(t),
+		4, 30*time.Millisecond, WithTimeout(50*time.Millisecond), WithStats(&stats))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the late reply of the first probe varies the round trip times
+	if stats.Jitter <= 0 {
+		t.Errorf("jitter expected, but got: %s", stats.Jitter)
+	}
+	stats.Jitter = 0
+	// the first reply answers the second probe
+	if stats.FirstReplyLatency < 30*time.Millisecond {
+		t.Errorf("first reply latency of at least 30ms expected, but got: %s", stats.FirstReplyLatency)
+	}
+	stats.FirstReplyLatency = 0
+	expected := Stats{Replies: 4, Sent: 4, Lost: 1, Reordered: 1, Duplicated: 1}
+	if stats != expected {
+		t.Errorf("stats %+v expected, but got: %+v", expected, stats)
+	}
+	var seqs []int
+	var duplicates []bool
+	for _, result := range results {
+		seqs = append(seqs, result.ProbeIndex)
+		duplicates = append(duplicates, result.Duplicate)
+	}
+	if len(seqs) != 4 || seqs[0] != 1 || seqs[1] != 0 || seqs[2] != 2 || seqs[3] != 2 {
+		t.Errorf("sequence numbers [1 0 2 2] expected, but got: %v", seqs)
+	}
+	if fmt.Sprint(duplicates) != "[false false false true]" {
+		t.Errorf("only the second reply to probe 2 expected as duplicate, but got: %v", duplicates)
+	}
+}
+
+func TestPingNProbeIndex(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	probes := 0
+	sock := newFakeSocket(nil)
+	sock.respond = func(request arpDatagram) []arpDatagram {
+		probes++
+		reply := newArpReply(request, mac)
+		if probes == 1 {
+			// the reply to the first probe arrives after the second probe got answered
+			time.AfterFunc(45*time.Millisecond, func() { sock.inject(reply) })
+			return nil
+		}
+		return []arpDatagram{reply}
+	}
+	useFakeSocket(t, sock)
+
+	start := time.Now()
+	results, err := PingNOverIfaceContext(context.Background(), net.ParseIP("127.0.0.2"), loopbackInterface(t),
+		3, 30*time.Millisecond, WithTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 45*time.Millisecond {
+		t.Fatalf("the delayed reply expected within the ping, but it took: %s", elapsed)
+	}
+
+	var indexes []int
+	for _, result := range results {
+		indexes = append(indexes, result.ProbeIndex)
+		if result.Duplicate {
+			t.Errorf("reply to probe %d shouldn't be a duplicate", result.ProbeIndex)
+		}
+	}
+	if fmt.Sprint(indexes) != "[1 0 2]" {
+		t.Fatalf("probe indexes [1 0 2] expected, but got: %v", indexes)
+	}
+	// the delayed reply is measured from the first probe
+	if results[1].Duration < 40*time.Millisecond {
+		t.Errorf("duration of the delayed reply from the first probe expected, but got: %s", results[1].Duration)
+	}
+	if results[0].Duration >= 30*time.Millisecond || results[2].Duration >= 30*time.Millisecond {
+		t.Errorf("durations of the direct replies below the interval expected, but got: %s, %s",
+			results[0].Duration, results[2].Duration)
+	}
+}
+
+func TestAttributeReply(t *testing.T) {
+	now := time.Now()
+	sendTimes := []time.Time{now, now.Add(time.Second)}
+
+	var stats Stats
+	if seq := attributeReply(sendTimes, []bool{false, false}, now.Add(-time.Second), 0, &stats); seq != -1 {
+		t.Errorf("reply before the first probe: -1 expected, but got: %d", seq)
+	}
+	if seq := attributeReply(sendTimes, []bool{false, false}, now.Add(500*time.Millisecond), 0, &stats); seq != 0 {
+		t.Errorf("reply before the second probe: 0 expected, but got: %d", seq)
+	}
+	if seq := attributeReply(sendTimes, []bool{false, true}, now.Add(2*time.Second), 0, &stats); seq != 0 || stats.Reordered != 1 {
+		t.Errorf("late reply of the first probe: 0 / reordered expected, but got: %d / %+v", seq, stats)
+	}
+	if seq := attributeReply(sendTimes, []bool{true, true}, now.Add(2*time.Second), 0, &stats); seq != 1 || stats.Duplicated != 1 {
+		t.Errorf("reply of answered probes: 1 / duplicated expected, but got: %d / %+v", seq, stats)
+	}
+
+	// per 'WithMaxReplyAge'
+	stats = Stats{}
+	if seq := attributeReply(sendTimes, []bool{false, false}, now.Add(1500*time.Millisecond), time.Second, &stats); seq != 1 {
+		t.Errorf("young reply: 1 expected, but got: %d", seq)
+	}
+	if seq := attributeReply(sendTimes, []bool{false, true}, now.Add(1500*time.Millisecond), time.Second, &stats); seq != 1 ||
+		stats.Reordered != 0 || stats.Duplicated != 1 {
+		t.Errorf("too old for the first probe: 1 / duplicated expected, but got: %d / %+v", seq, stats)
+	}
+	if seq := attributeReply(sendTimes, []bool{false, false}, now.Add(3*time.Second), time.Second, &stats); seq != lateReply {
+		t.Errorf("too old for all probes: late expected, but got: %d", seq)
+	}
+}
+
+func TestPingNStopsAtDeadline(t *testing.T) {
+	useFakeSocket(t, newFakeSocket(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{newArpReply(request, net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01})}
+	}))
+
+	var stats Stats
+	start := time.Now()
+	results, err := PingNOverIfaceContext(context.Background(), net.ParseIP("127.0.0.2"), loopbackInterface(t),
+		100, 50*time.Millisecond, WithProbeTimeout(time.Second), WithDeadline(time.Now().Add(120*time.Millisecond)),
+		WithStats(&stats))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("deadline not honored - took: %s", elapsed)
+	}
+	if stats.Sent == 0 || stats.Sent >= 100 || len(results) != stats.Sent {
+		t.Errorf("partial results of the probes until the deadline expected, but sent: %d, got: %d",
+			stats.Sent, len(results))
+	}
+}
+
+func TestPingNDeadlineWithoutReply(t *testing.T) {
+	useFakeSocket(t, newFakeSocket(nil))
+
+	_, err := PingNOverIfaceContext(context.Background(), net.ParseIP("127.0.0.2"), loopbackInterface(t),
+		100, 50*time.Millisecond, WithDeadline(time.Now().Add(80*time.Millisecond)))
+	if err != ErrTimeout {
+		t.Errorf("timeout error expected, but received: %v", err)
+	}
+}
+
+func TestPingNWaitsProbeTimeoutAfterLastProbe(t *testing.T) {
+	sock := newFakeSocket(nil)
+	useFakeSocket(t, sock)
+
+	start := time.Now()
+	_, err := PingNOverIfaceContext(context.Background(), net.ParseIP("127.0.0.2"), loopbackInterface(t),
+		2, 10*time.Millisecond, WithTimeout(10*time.Second), WithProbeTimeout(50*time.Millisecond))
+	if err != ErrTimeout {
+		t.Errorf("timeout error expected, but received: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("probe timeout not honored - took: %s", elapsed)
+	}
+	if sent := sock.sentDatagrams(); len(sent) != 2 {
+		t.Errorf("2 probes expected, but sent: %d", len(sent))
+	}
+}
+
+func TestPingNWithUnicastAfterFirst(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	sock := newFakeSocket(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{newArpReply(request, mac)}
+	})
+	useFakeSocket(t, sock)
+
+	results, err := PingNOverIfaceContext(context.Background(), net.ParseIP("127.0.0.2"), loopbackInterface(t), 3,
+		20*time.Millisecond, WithTimeout(20*time.Millisecond), WithUnicastAfterFirst())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Errorf("3 results expected, but got: %v", results)
+	}
+	sent := sock.sentDatagrams()
+	if len(sent) != 3 {
+		t.Fatalf("3 probes expected, but sent: %d", len(sent))
+	}
+	for i, request := range sent {
+		want := mac
+		if i == 0 {
+			want = BroadcastMAC()
+		}
+		if dst := net.HardwareAddr(request.MarshalWithEthernetHeader()[:6]); dst.String() != want.String() {
+			t.Errorf("probe %d expected to '%s', but sent to: '%s'", i, want, dst)
+		}
+		if tha := net.HardwareAddr(request.tha); tha.String() != BroadcastMAC().String() {
+			t.Errorf("probe %d expected with the broadcast target mac, but got: '%s'", i, tha)
+		}
+	}
+}
+
+func TestPingLoop(t *testing.T) {
+	probes := 0
+	useFakeSocket(t, newFakeSocket(func(request arpDatagram) []arpDatagram {
+		probes++
+		if probes == 2 {
+			// rebooting
+			return nil
+		}
+		return []arpDatagram{newArpReply(request, net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01})}
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var states []bool
+	err := PingLoopOverIface(ctx, net.ParseIP("127.0.0.2"), loopbackInterface(t), 30*time.Millisecond,
+		func(result Result, up bool) {
+			if up && result.HwAddr == nil {
+				t.Error("result of the reply expected")
+			}
+			states = append(states, up)
+			if len(states) == 3 {
+				cancel()
+			}
+		}, WithTimeout(20*time.Millisecond))
+	if err != context.Canceled {
+		t.Errorf("context.Canceled expected, but got: %v", err)
+	}
+	if len(states) != 3 || !states[0] || states[1] || !states[2] {
+		t.Errorf("states [true false true] expected, but got: %v", states)
+	}
+}
+
+func TestProbeFromAllLocalSubnets(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	sock := newFakeSocket(func(request arpDatagram) []arpDatagram {
+		// the device only replies to its management subnet
+		if !request.SenderIP().Equal(net.ParseIP("10.0.2.1")) {
+			return nil
+		}
+		return []arpDatagram{newArpReply(request, mac)}
+	})
+	useFakeSocket(t, sock)
+	origAddrs := interfaceAddrs
+	interfaceAddrs = func(iface net.Interface) ([]net.Addr, error) {
+		return []net.Addr{
+			&net.IPNet{IP: net.ParseIP("10.0.1.1").To4(), Mask: net.CIDRMask(24, 32)},
+			&net.IPNet{IP: net.ParseIP("10.0.2.1").To4(), Mask: net.CIDRMask(24, 32)},
+			&net.IPNet{IP: net.ParseIP("10.0.3.1").To4(), Mask: net.CIDRMask(24, 32)},
+		}, nil
+	}
+	t.Cleanup(func() {
+		interfaceAddrs = origAddrs
+	})
+
+	results, err := ProbeFromAllLocalSubnetsOverIfaceContext(context.Background(), net.ParseIP("10.0.1.50"),
+		loopbackInterface(t), WithTimeout(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !results[0].SourceIP.Equal(net.ParseIP("10.0.2.1")) {
+		t.Errorf("one reply to source 10.0.2.1 expected, but got: %v", results)
+	}
+	if sent := sock.sentDatagrams(); len(sent) != 3 || !sent[0].SenderIP().Equal(net.ParseIP("10.0.1.1")) {
+		t.Errorf("a probe per address expected - the same subnet first, but sent: %v", sent)
+	}
+}
@@ -0,0 +1,82 @@
+package arping
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// rawSockets keeps the sockets of 'SendRaw' and 'ReceiveRaw' open per interface,
+// so a reply received between both calls isn't lost
+var rawSockets = struct {
+	sync.Mutex
+	byIface map[string]frameSocket
+}{byIface: make(map[string]frameSocket)}
+
+func rawSocket(iface net.Interface) (frameSocket, error) {
+	rawSockets.Lock()
+	defer rawSockets.Unlock()
+
+	if sock, ok := rawSockets.byIface[iface.Name]; ok {
+		return sock, nil
+	}
+	sock, err := openFrameSocket(iface, newConfig(nil))
+	if err != nil {
+		return nil, err
+	}
+	rawSockets.byIface[iface.Name] = sock
+	return sock, nil
+}
+
+// SendRaw sends the pre-built ethernet frame 'frame' over interface 'iface' and returns the send time.
+//
+// The caller is responsible for the whole frame - the ethernet header with destination, source and ethertype,
+// followed by the payload, without the frame check sequence. Nothing gets validated or padded.
+// Sending requires root privileges or the CAP_NET_RAW capability on linux, and access to the bpf devices on bsd.
+//
+// The socket is kept open for the following 'ReceiveRaw' calls - release it per 'CloseRaw'.
+func SendRaw(iface net.Interface, frame []byte) (time.Time, error) {
+	sock, err := rawSocket(iface)
+	if err != nil {
+		return time.Now(), err
+	}
+	return sock.sendFrame(frame)
+}
+
+// ReceiveRaw blocks until a frame is received over interface 'iface' or 'deadline' is reached.
+// returns 'ErrTimeout' when the deadline is reached.
+//
+// The socket only receives arp frames. The returned frame starts with the ethernet header -
+// decoding it and matching it to a request is left to the caller, such as per 'DecodeARP'.
+// The privileges of 'SendRaw' apply.
+func ReceiveRaw(iface net.Interface, deadline time.Time) ([]byte, time.Time, error) {
+	sock, err := rawSocket(iface)
+	if err != nil {
+		return nil, time.Now(), err
+	}
+	for {
+		frame, receiveTime, err := sock.receiveFrame(deadline)
+		retry := errors.Is(err, syscall.EINTR) || errors.Is(err, ErrInvalidArp) || err == ErrTimeout
+		if !retry {
+			return frame, receiveTime, err
+		}
+		if !time.Now().Before(deadline) {
+			return nil, time.Now(), ErrTimeout
+		}
+	}
+}
+
+// CloseRaw closes the socket of 'SendRaw' and 'ReceiveRaw' over interface 'iface' - a no-op if none is open
+func CloseRaw(iface net.Interface) error {
+	rawSockets.Lock()
+	defer rawSockets.Unlock()
+
+	sock, ok := rawSockets.byIface[iface.Name]
+	if !ok {
+		return nil
+	}
+	delete(rawSockets.byIface, iface.Name)
+	return sock.deinitialize()
+}
@@ -0,0 +1,162 @@
+package arping
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeFrameSocket replaces the platform frame socket in tests - it passes the frames as datagrams to 'fakeSocket'
+type fakeFrameSocket struct {
+	*fakeSocket
+}
+
+func (s fakeFrameSocket) sendFrame(frame []byte) (time.Time, error) {
+	datagram, err := parseArpDatagram(frame[ethernetHeaderLen:])
+	if err != nil {
+		return time.Now(), err
+	}
+	return s.send(datagram)
+}
+
+func (s fakeFrameSocket) receiveFrame(deadline time.Time) ([]byte, time.Time, error) {
+	datagram, receiveTime, err := s.receive(deadline)
+	if err != nil {
+		return nil, receiveTime, err
+	}
+	return datagram.MarshalWithEthernetHeader(), receiveTime, nil
+}
+
+// useFakeFrameSocket replaces the platform frame socket with 'sock' until the test ends
+func useFakeFrameSocket(t testing.TB, sock *fakeSocket) *int {
+	t.Helper()
+
+	opened := 0
+	orig := openFrameSocket
+	openFrameSocket = func(iface net.Interface, cfg *config) (frameSocket, error) {
+		opened++
+		return fakeFrameSocket{sock}, nil
+	}
+	t.Cleanup(func() {
+		openFrameSocket = orig
+	})
+	return &opened
+}
+
+func TestSendReceiveRaw(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	sock := newFakeSocket(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{newArpReply(request, mac)}
+	})
+	opened := useFakeFrameSocket(t, sock)
+
+	iface := loopbackInterface(t)
+	t.Cleanup(func() { CloseRaw(iface) })
+
+	request := newArpRequest(mac, net.ParseIP("127.0.0.1"), net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, net.ParseIP("127.0.0.2"))
+	frame := request.MarshalWithEthernetHeader()
+	if _, err := SendRaw(iface, frame); err != nil {
+		t.Fatal(err)
+	}
+	if sent := sock.sentDatagrams(); len(sent) != 1 || !bytes.Equal(sent[0].Marshal(), request.Marshal()) {
+		t.Errorf("request %v expected to be sent, but sent: %v", request, sent)
+	}
+
+	reply, _, err := ReceiveRaw(iface, time.Now().Add(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet, err := DecodeARP(reply, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !packet.SenderIP.Equal(net.ParseIP("127.0.0.2")) || packet.SenderMac.String() != mac.String() {
+		t.Errorf("reply from 127.0.0.2 / %s expected, but got: %+v", mac, packet)
+	}
+
+	if _, _, err := ReceiveRaw(iface, time.Now().Add(20*time.Millisecond)); err != ErrTimeout {
+		t.Errorf("ErrTimeout expected, but got: %v", err)
+	}
+	if *opened != 1 {
+		t.Errorf("one socket expected to be opened, but opened: %d", *opened)
+	}
+
+	if err := CloseRaw(iface); err != nil {
+		t.Fatal(err)
+	}
+	if !sock.closed {
+		t.Error("socket expected to be closed")
+	}
+	if err := CloseRaw(iface); err != nil {
+		t.Errorf("closing twice expected to be a no-op, but got: %v", err)
+	}
+}
+
+// recordingFrameSocket records the sent frames
+type recordingFrameSocket struct {
+	fakeFrameSocket
+	frames [][]byte
+}
+
+func (s *recordingFrameSocket) sendFrame(frame []byte) (time.Time, error) {
+	s.mu.Lock()
+	s.frames = append(s.frames, append([]byte(nil), frame...))
+	s.mu.Unlock()
+	return s.fakeFrameSocket.sendFrame(frame)
+}
+
+func TestFrameMutator(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	sock := &recordingFrameSocket{fakeFrameSocket: fakeFrameSocket{newFakeSocket(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{newArpReply(request, mac)}
+	})}}
+	orig := openFrameSocket
+	openFrameSocket = func(iface net.Interface, cfg *config) (frameSocket, error) {
+		return sock, nil
+	}
+	t.Cleanup(func() {
+		openFrameSocket = orig
+	})
+
+	tag := []byte{0xca, 0xfe}
+	srcMac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x0a}
+	results, err := PingOverIface(net.ParseIP("127.0.0.2"), loopbackInterface(t), WithTimeout(20*time.Millisecond),
+		WithSourceMAC(srcMac), WithFrameMutator(func(frame []byte) []byte {
+			return append(frame, tag...)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Errorf("the reply to the unmodified request expected, but got: %v", results)
+	}
+	if len(sock.frames) != 1 || !bytes.HasSuffix(sock.frames[0], tag) {
+		t.Errorf("one frame with the tag % x expected, but sent: % x", tag, sock.frames)
+	}
+}
+
+func TestFrameInspector(t *testing.T) {
+	trusted := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	other := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+	useFakeFrameSocket(t, newFakeSocket(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{newArpReply(request, other), newArpReply(request, trusted)}
+	}))
+
+	inspected := 0
+	results, err := PingOverIface(net.ParseIP("127.0.0.2"), loopbackInterface(t), WithTimeout(20*time.Millisecond),
+		WithSourceMAC(net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x0a}), WithFrameInspector(func(frame []byte) bool {
+			inspected++
+			// the ethernet source
+			return bytes.Equal(frame[6:12], trusted)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].HwAddr.String() != trusted.String() {
+		t.Errorf("only the reply from '%s' expected, but got: %v", trusted, results)
+	}
+	if inspected != 2 {
+		t.Errorf("2 inspected frames expected, but got: %d", inspected)
+	}
+}
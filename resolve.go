@@ -0,0 +1,210 @@
+package arping
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// Resolve returns the hardware address of 'dstIP' - from the first reply
+func Resolve(dstIP net.IP, opts ...Option) (net.HardwareAddr, error) {
+	result, err := PingFirst(dstIP, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return result.HwAddr, nil
+}
+
+// PingFirst sends an arp ping to 'dstIP' and returns the first reply
+func PingFirst(dstIP net.IP, opts ...Option) (Result, error) {
+	if err := validateIP(dstIP); err != nil {
+		return Result{}, err
+	}
+
+	iface, err := findUsableInterfaceForNetwork(dstIP, newConfig(opts))
+	if err != nil {
+		return Result{}, err
+	}
+	return PingFirstOverIface(dstIP, *iface, opts...)
+}
+
+// PingRTT sends an arp ping over interface 'iface' to 'dstIP' and returns the round trip time and the hardware
+// address of the first reply - see 'PingFirstOverIface'.
+//
+// For high frequency health checks: it runs in the calling goroutine and allocates no results.
+// Pass 'WithSourceIP' to also skip the lookup of the interface addresses per ping.
+func PingRTT(dstIP net.IP, iface net.Interface, opts ...Option) (time.Duration, net.HardwareAddr, error) {
+	result, err := PingFirstOverIface(dstIP, iface, opts...)
+	if err != nil {
+		return 0, nil, err
+	}
+	return result.Duration, result.HwAddr, nil
+}
+
+// PingFirstOverIface sends an arp ping over interface 'iface' to 'dstIP' and returns the first reply
+//
+// In contrast to 'PingOverIface' it returns as soon as the first reply is received,
+// and runs completely in the calling goroutine.
+func PingFirstOverIface(dstIP net.IP, iface net.Interface, opts ...Option) (Result, error) {
+	if err := validateIP(dstIP); err != nil {
+		return Result{}, err
+	}
+	cfg := newConfig(opts)
+
+	deadline := cfg.probeDeadline()
+
+	srcIP, sock, err := openPingSocket(iface, dstIP, cfg)
+	if err != nil {
+		return Result{}, err
+	}
+	defer sock.deinitialize()
+
+	srcMac := cfg.srcMac(iface)
+	request := cfg.newArpRequest(srcMac, srcIP, cfg.dstMac(), dstIP)
+
+	// send arp request
+	verboseLog.Printf("arping '%s' over interface: %s with address: '%s'\n", dstIP, ifaceFingerprint(iface, srcMac), srcIP)
+	sendTime, err := sock.send(request)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var stats Stats
+	for {
+		// receive arp response
+		response, receiveTime, err := sock.receive(deadline)
+		if err != nil {
+			stats.Socket = socketStatsOf(sock)
+			cfg.logFrameSummary(stats)
+			cfg.reportStats(stats)
+			return Result{}, err
+		}
+
+		if cfg.isResponse(response, request) {
+			verboseLog.Printf("process received arp: srcIP: '%s', srcMac: '%s'\n",
+				response.SenderIP(), response.SenderMac())
+			stats.Replies = 1
+			stats.Socket = socketStatsOf(sock)
+			cfg.logFrameSummary(stats)
+			cfg.reportStats(stats)
+			return newResult(response, request, receiveTime.Sub(sendTime), iface), nil
+		}
+
+		stats.Ignored++
+		cfg.logIgnored(response)
+	}
+}
+
+// FindIPsForMACs returns the ips of the hardware addresses 'macs' over interface 'iface' - see 'FindIPsForMACsContext'
+func FindIPsForMACs(macs []net.HardwareAddr, iface net.Interface, opts ...Option) (map[string]net.IP, error) {
+	return FindIPsForMACsContext(context.Background(), macs, iface, opts...)
+}
+
+// FindIPsForMACsContext returns the ips, which the hardware addresses 'macs' advertise over interface 'iface'
+// - keyed per 'net.HardwareAddr.String'. This is the inverse of 'Resolve', such as to find known devices.
+//
+// It listens to all arp frames - requests, replies and announcements - while it stimulates replies by a scan of
+// the v4 networks of 'iface', see 'PingManyOverIfaceStream'. The first ip of a hardware address wins.
+// Returns when all of 'macs' were found, or with the ones found until the scan ended - at the probe timeout after
+// the last request, or until 'ctx' is done. Networks with a shorter prefix than 'MinCIDRPrefix' aren't scanned, only
+// listened to. Bound scans of huge networks per 'WithDeadline', throttle them per 'WithRate'.
+func FindIPsForMACsContext(ctx context.Context, macs []net.HardwareAddr, iface net.Interface,
+	opts ...Option) (map[string]net.IP, error) {
+	cfg := newConfig(opts)
+
+	var dstIPs []net.IP
+	err := inNetNS(cfg.netns, func() (err error) {
+		dstIPs, err = localNetworkHosts(iface)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(macs))
+	for _, mac := range macs {
+		wanted[mac.String()] = true
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	found := make(map[string]net.IP)
+	observe := func(mac net.HardwareAddr, ip net.IP) {
+		mu.Lock()
+		defer mu.Unlock()
+		key := mac.String()
+		if !wanted[key] || ip.IsUnspecified() {
+			return
+		}
+		if _, ok := found[key]; ok {
+			return
+		}
+		verboseLog.Printf("found '%s' at '%s'\n", mac, ip)
+		found[key] = ip
+		if len(found) == len(wanted) {
+			cancel()
+		}
+	}
+
+	sniffErr := make(chan error, 1)
+	go func() {
+		sniffErr <- sniff(ctx, iface, nil, func(frame Frame) {
+			observe(frame.SenderMac, frame.SenderIP)
+		}, opts)
+	}()
+
+	err = PingManyOverIfaceStream(ctx, dstIPs, iface, func(result Result) {
+		observe(result.HwAddr, result.IP)
+	}, opts...)
+	// stopped per the found addresses - or per 'ctx'
+	stopped := ctx.Err() != nil
+	cancel()
+	if err != nil && !stopped {
+		return nil, err
+	}
+	if err := <-sniffErr; err != nil && err != context.Canceled && !stopped {
+		return nil, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return found, nil
+}
+
+// localNetworkHosts returns the host addresses of the v4 networks of 'iface' - without duplicates,
+// and without the networks shorter than 'MinCIDRPrefix'
+func localNetworkHosts(iface net.Interface) ([]net.IP, error) {
+	addrs, err := interfaceAddrs(iface)
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []net.IP
+	seen := make(map[string]bool)
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || ipnet.IP.To4() == nil {
+			continue
+		}
+		network := &net.IPNet{IP: ipnet.IP.Mask(ipnet.Mask), Mask: ipnet.Mask}
+		networkHosts, err := CIDRHosts(network.String())
+		if errors.Is(err, ErrNetworkTooLarge) {
+			verboseLog.Printf("network '%s' too large to scan - only listen to it\n", network)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, host := range networkHosts {
+			if !seen[host.String()] {
+				seen[host.String()] = true
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	return hosts, nil
+}
@@ -0,0 +1,56 @@
+package arping
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestFindIPsForMACs(t *testing.T) {
+	wire := &memoryWire{}
+	replying, replyingMac := net.ParseIP("10.0.0.2"), net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+	wire.addHost(t, replying, replyingMac)
+
+	// a host outside of the scanned network, which only announces itself
+	announcing, announcingMac := net.ParseIP("10.0.9.7"), net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x07}
+	announcer := wire.attach(announcingMac)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		announcement := newArpRequest(announcingMac, announcing, BroadcastMAC(), announcing).MarshalWithEthernetHeader()
+		for {
+			announcer.SendFrame(announcement)
+			select {
+			case <-done:
+				return
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		close(done)
+		<-stopped
+		announcer.Close()
+	})
+
+	origAddrs := interfaceAddrs
+	interfaceAddrs = func(iface net.Interface) ([]net.Addr, error) {
+		return []net.Addr{&net.IPNet{IP: net.ParseIP("10.0.0.1").To4(), Mask: net.CIDRMask(29, 32)}}, nil
+	}
+	t.Cleanup(func() {
+		interfaceAddrs = origAddrs
+	})
+
+	localMac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	iface := net.Interface{Index: 1, Name: "mem0", HardwareAddr: localMac, Flags: net.FlagUp | net.FlagBroadcast}
+	unknownMac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x09}
+	found, err := FindIPsForMACs([]net.HardwareAddr{replyingMac, announcingMac, unknownMac}, iface,
+		WithSocketFactory(wire.factory(localMac)), WithTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 || !found[replyingMac.String()].Equal(replying) || !found[announcingMac.String()].Equal(announcing) {
+		t.Errorf("%s at %s and %s at %s expected, but got: %v", replyingMac, replying, announcingMac, announcing, found)
+	}
+}
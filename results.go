@@ -0,0 +1,120 @@
+package arping
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+)
+
+// SortOrder of results - see 'SortResults'
+type SortOrder int
+
+const (
+	// ByMAC sorts by the hardware address
+	ByMAC SortOrder = iota
+	// ByDuration sorts by the round trip time - fastest first
+	ByDuration
+)
+
+// SortResults sorts 'results' in place - equal results keep their order.
+//
+// Results are returned in arrival order, use this for a reproducible order.
+func SortResults(results []Result, by SortOrder) {
+	sort.SliceStable(results, func(i, j int) bool {
+		switch by {
+		case ByDuration:
+			return results[i].Duration < results[j].Duration
+		default:
+			return bytes.Compare(results[i].HwAddr, results[j].HwAddr) < 0
+		}
+	})
+}
+
+// SameHost returns true if 'r' and 'o' are from the same host - same hardware address,
+// and same ip if both have one. The duration and the other fields are ignored.
+func (r Result) SameHost(o Result) bool {
+	if !bytes.Equal(r.HwAddr, o.HwAddr) {
+		return false
+	}
+	return r.IP == nil || o.IP == nil || r.IP.Equal(o.IP)
+}
+
+// Key returns the hardware address as string - usable as map key, as the struct isn't comparable
+func (r Result) Key() string {
+	return r.HwAddr.String()
+}
+
+// UniqueHosts returns the first result per host - see 'SameHost'
+func UniqueHosts(results []Result) []Result {
+	var unique []Result
+Results:
+	for _, result := range results {
+		for _, u := range unique {
+			if u.SameHost(result) {
+				continue Results
+			}
+		}
+		unique = append(unique, result)
+	}
+	return unique
+}
+
+// ResultFor returns the result of 'ip' from the results of a batch operation, such as 'PingManyContext' or 'ScanCIDR'
+// - or 'ErrNoReply' if 'ip' didn't reply
+func ResultFor(results map[string]Result, ip net.IP) (Result, error) {
+	result, ok := results[ip.String()]
+	if !ok {
+		return Result{}, fmt.Errorf("ip: '%s': %w", ip, ErrNoReply)
+	}
+	return result, nil
+}
+
+// GroupByMAC returns the ips of 'results' grouped by their hardware address - keyed per 'Result.Key', ips sorted.
+//
+// A hardware address with multiple ips hints a multi-homed host, or a router answering per proxy arp.
+func GroupByMAC(results map[string]Result) map[string][]net.IP {
+	groups := make(map[string][]net.IP)
+	for _, result := range results {
+		groups[result.Key()] = append(groups[result.Key()], result.IP)
+	}
+	for _, ips := range groups {
+		sort.Slice(ips, func(i, j int) bool {
+			return bytes.Compare(ips[i].To16(), ips[j].To16()) < 0
+		})
+	}
+	return groups
+}
+
+// csvHeader holds the columns of 'WriteCSV'
+var csvHeader = []string{"ip", "mac", "rtt_us", "iface", "vendor"}
+
+// WriteCSV writes 'results' as csv to 'w' - a header row, followed by one row per result in the given order.
+//
+// The columns are: ip, mac, rtt_us - the round trip time in microseconds, iface and vendor.
+// Unset fields are left blank - the vendor is blank for now, as results carry no vendor yet.
+// See 'SortResults' for a reproducible order.
+func WriteCSV(w io.Writer, results []Result) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, result := range results {
+		var ip, mac string
+		if result.IP != nil {
+			ip = result.IP.String()
+		}
+		if len(result.HwAddr) > 0 {
+			mac = result.HwAddr.String()
+		}
+		row := []string{ip, mac, strconv.FormatInt(result.Duration.Microseconds(), 10), result.Iface, ""}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
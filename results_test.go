@@ -0,0 +1,113 @@
+package arping
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSortResults(t *testing.T) {
+	macA := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x0a}
+	macB := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x0b}
+	macC := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x0c}
+	newResults := func() []Result {
+		return []Result{
+			{HwAddr: macB, Duration: 1 * time.Millisecond},
+			{HwAddr: macC, Duration: 3 * time.Millisecond},
+			{HwAddr: macA, Duration: 2 * time.Millisecond},
+		}
+	}
+
+	results := newResults()
+	SortResults(results, ByMAC)
+	for i, mac := range []net.HardwareAddr{macA, macB, macC} {
+		if results[i].HwAddr.String() != mac.String() {
+			t.Errorf("ByMAC: index %d: '%s' expected, but got: '%s'", i, mac, results[i].HwAddr)
+		}
+	}
+
+	results = newResults()
+	SortResults(results, ByDuration)
+	for i, mac := range []net.HardwareAddr{macB, macA, macC} {
+		if results[i].HwAddr.String() != mac.String() {
+			t.Errorf("ByDuration: index %d: '%s' expected, but got: '%s'", i, mac, results[i].HwAddr)
+		}
+	}
+}
+
+func TestResultSameHost(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x0a}
+	other := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x0b}
+	a := Result{HwAddr: mac, IP: net.ParseIP("10.0.0.1"), Duration: time.Millisecond}
+
+	tests := []struct {
+		o        Result
+		expected bool
+	}{
+		{Result{HwAddr: mac, IP: net.ParseIP("10.0.0.1").To4(), Duration: time.Second}, true},
+		{Result{HwAddr: mac}, true},
+		{Result{HwAddr: mac, IP: net.ParseIP("10.0.0.2")}, false},
+		{Result{HwAddr: other, IP: net.ParseIP("10.0.0.1")}, false},
+	}
+	for _, tt := range tests {
+		if same := a.SameHost(tt.o); same != tt.expected {
+			t.Errorf("SameHost(%+v): %t expected", tt.o, tt.expected)
+		}
+	}
+
+	unique := UniqueHosts([]Result{a, {HwAddr: mac}, {HwAddr: other}})
+	if len(unique) != 2 || unique[0].Key() != mac.String() || unique[1].Key() != other.String() {
+		t.Errorf("2 unique hosts expected, but got: %v", unique)
+	}
+}
+
+func TestGroupByMAC(t *testing.T) {
+	shared := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	unique := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+	results := map[string]Result{
+		"192.168.1.10": {HwAddr: shared, IP: net.ParseIP("192.168.1.10")},
+		"192.168.1.2":  {HwAddr: shared, IP: net.ParseIP("192.168.1.2")},
+		"192.168.1.3":  {HwAddr: unique, IP: net.ParseIP("192.168.1.3")},
+	}
+
+	groups := GroupByMAC(results)
+	if len(groups) != 2 {
+		t.Fatalf("2 groups expected, but got: %v", groups)
+	}
+	if ips := groups[shared.String()]; len(ips) != 2 || !ips[0].Equal(net.ParseIP("192.168.1.2")) ||
+		!ips[1].Equal(net.ParseIP("192.168.1.10")) {
+		t.Errorf("shared mac: sorted [192.168.1.2 192.168.1.10] expected, but got: %v", ips)
+	}
+	if ips := groups[unique.String()]; len(ips) != 1 || !ips[0].Equal(net.ParseIP("192.168.1.3")) {
+		t.Errorf("unique mac: [192.168.1.3] expected, but got: %v", ips)
+	}
+	if groups := GroupByMAC(nil); len(groups) != 0 {
+		t.Errorf("no groups expected, but got: %v", groups)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	results := []Result{
+		{IP: net.ParseIP("10.0.0.1"), HwAddr: net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01},
+			Duration: 1500 * time.Microsecond, Iface: "eth0"},
+		// without interface
+		{IP: net.ParseIP("10.0.0.2"), HwAddr: net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02},
+			Duration: 42 * time.Microsecond},
+		// empty
+		{},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, results); err != nil {
+		t.Fatal(err)
+	}
+	golden, err := os.ReadFile("testdata/results.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), golden) {
+		t.Errorf("csv of 'testdata/results.csv' expected, but got:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,686 @@
+package arping
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// ScanCIDR sends an arp ping to every host address in 'cidr' - see 'PingManyContext'
+func ScanCIDR(cidr string, opts ...Option) (map[string]Result, error) {
+	return ScanCIDRContext(context.Background(), cidr, opts...)
+}
+
+// ScanCIDRContext sends an arp ping to every host address in 'cidr' - see 'PingManyContext'
+func ScanCIDRContext(ctx context.Context, cidr string, opts ...Option) (map[string]Result, error) {
+	dstIPs, err := CIDRHosts(cidr)
+	if err != nil {
+		return nil, err
+	}
+	return PingManyContext(ctx, dstIPs, opts...)
+}
+
+// ScanCIDROverIfaceContext sends an arp ping over interface 'iface' to every host address in 'cidr'
+// - see 'PingManyContext'
+func ScanCIDROverIfaceContext(ctx context.Context, cidr string, iface net.Interface, opts ...Option) (map[string]Result, error) {
+	dstIPs, err := CIDRHosts(cidr)
+	if err != nil {
+		return nil, err
+	}
+	return PingManyOverIfaceContext(ctx, dstIPs, iface, opts...)
+}
+
+// ScanLinkLocal sends an arp ping over interface 'iface' to every link-local address - see 'ScanLinkLocalContext'
+func ScanLinkLocal(iface net.Interface, opts ...Option) (map[string]Result, error) {
+	return ScanLinkLocalContext(context.Background(), iface, opts...)
+}
+
+// ScanLinkLocalContext sends an arp ping over interface 'iface' to every link-local address
+// - such as to discover zeroconf (APIPA) devices. See 'PingManyOverIfaceContext'.
+//
+// The range 169.254.1.0 - 169.254.254.255 of RFC 3927 holds 65024 addresses: the sweep takes a while and
+// floods the link with broadcasts. Bound it per 'WithDeadline', and watch it per 'WithProgress'.
+// The requests are sent from the link-local address of 'iface' - or from 0.0.0.0 per 'WithZeroSource'
+// if it has none. 'WithSourceIP' overrides both.
+func ScanLinkLocalContext(ctx context.Context, iface net.Interface, opts ...Option) (map[string]Result, error) {
+	if newConfig(opts).sourceIP == nil {
+		source := WithZeroSource()
+		if srcIP := linkLocalAddress(iface); srcIP != nil {
+			source = WithSourceIP(srcIP)
+		}
+		opts = append([]Option{source}, opts...)
+	}
+	return PingManyOverIfaceContext(ctx, linkLocalHosts(), iface, opts...)
+}
+
+// linkLocalAddress returns the first link-local v4 address of 'iface' - nil if it has none
+func linkLocalAddress(iface net.Interface) net.IP {
+	ips, _, err := LocalAddresses(iface)
+	if err != nil {
+		return nil
+	}
+	for _, ip := range ips {
+		if ip.IsLinkLocalUnicast() {
+			return ip
+		}
+	}
+	return nil
+}
+
+// linkLocalHosts returns the link-local addresses per RFC 3927 - without the reserved first and last 256 ones
+func linkLocalHosts() []net.IP {
+	all, _ := CIDRHosts("169.254.0.0/16")
+	hosts := make([]net.IP, 0, len(all))
+	for _, ip := range all {
+		if ip[2] != 0 && ip[2] != 255 {
+			hosts = append(hosts, ip)
+		}
+	}
+	return hosts
+}
+
+// PingMany sends an arp ping to every ip in 'dstIPs' - see 'PingManyContext'
+func PingMany(dstIPs []net.IP, opts ...Option) (map[string]Result, error) {
+	return PingManyContext(context.Background(), dstIPs, opts...)
+}
+
+// PingManyContext sends an arp ping to every ip in 'dstIPs' concurrently
+//
+// The interface is auto-detected per ip, and every interface gets a single socket for all of its ips.
+// Returns the first reply per answering host, keyed by its ip - hosts without reply are missing.
+// Replies are collected until the probe timeout after the last request was sent - see 'WithProbeTimeout',
+// or until the deadline from 'ctx' or per 'WithDeadline'.
+func PingManyContext(ctx context.Context, dstIPs []net.IP, opts ...Option) (map[string]Result, error) {
+	return pingMany(ctx, dstIPs, nil, opts)
+}
+
+// PingManyStream sends an arp ping to every ip in 'dstIPs' concurrently - see 'PingManyContext'.
+//
+// 'onResult' is called the moment the first reply per answering host is received - one call at a time.
+// No call happens after the return.
+func PingManyStream(ctx context.Context, dstIPs []net.IP, onResult func(Result), opts ...Option) error {
+	var mu sync.Mutex
+	_, err := pingMany(ctx, dstIPs, func(result Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		onResult(result)
+	}, opts)
+	return err
+}
+
+// ScanCIDRStream sends an arp ping to every host address in 'cidr' - see 'PingManyStream'
+func ScanCIDRStream(ctx context.Context, cidr string, onResult func(Result), opts ...Option) error {
+	dstIPs, err := CIDRHosts(cidr)
+	if err != nil {
+		return err
+	}
+	return PingManyStream(ctx, dstIPs, onResult, opts...)
+}
+
+// ScanUntil sends an arp ping to the host addresses in 'cidr' until 'n' distinct hosts replied - see 'ScanCIDRStream'.
+//
+// This stops the scan early, when a quorum is enough - such as to find any printer. Returns the replies so far,
+// keyed by ip, if 'timeout' passes first - or the scan ends without 'n' replies, at the probe timeout after the last request.
+func ScanUntil(cidr string, n int, timeout time.Duration, opts ...Option) (map[string]Result, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("invalid count: %d - at least 1 host expected", n)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	found := make(map[string]Result)
+	err := ScanCIDRStream(ctx, cidr, func(result Result) {
+		if len(found) >= n {
+			return
+		}
+		found[result.IP.String()] = result
+		if len(found) == n {
+			verboseLog.Printf("%d hosts replied - stop the scan\n", n)
+			cancel()
+		}
+	}, opts...)
+	// stopped per quorum or timeout
+	if err != nil && ctx.Err() == nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// PingManyOverIfaceStream sends an arp ping over interface 'iface' to every ip in 'dstIPs' - see 'PingManyStream'
+func PingManyOverIfaceStream(ctx context.Context, dstIPs []net.IP, iface net.Interface, onResult func(Result),
+	opts ...Option) error {
+	_, err := pingManyOverIface(ctx, dstIPs, iface, onResult, nil, opts)
+	return err
+}
+
+// pingMany pings 'dstIPs' grouped per interface - 'onResult' gets called per first reply, if not nil
+func pingMany(ctx context.Context, dstIPs []net.IP, onResult func(Result), opts []Option) (map[string]Result, error) {
+	cfg := newConfig(opts)
+
+	// group the ips per interface
+	var ifaces []net.Interface
+	ifaceIPs := make(map[int][]net.IP)
+	for _, dstIP := range dstIPs {
+		if err := validateIP(dstIP); err != nil {
+			return nil, err
+		}
+
+		iface, err := findUsableInterfaceForNetwork(dstIP, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("ip: '%s': %w", dstIP, err)
+		}
+		if _, ok := ifaceIPs[iface.Index]; !ok {
+			ifaces = append(ifaces, *iface)
+		}
+		ifaceIPs[iface.Index] = append(ifaceIPs[iface.Index], dstIP)
+	}
+
+	// a single progress over all interfaces
+	progress := newScanProgress(cfg, len(dstIPs))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	results := make(map[string]Result)
+	for _, iface := range ifaces {
+		wg.Add(1)
+		go func(iface net.Interface) {
+			defer wg.Done()
+
+			ifaceResults, err := pingManyOverIface(ctx, ifaceIPs[iface.Index], iface, onResult, progress, opts)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			for ip, result := range ifaceResults {
+				results[ip] = result
+			}
+		}(iface)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return results, nil
+}
+
+// PingManyOverIfaceContext sends an arp ping over interface 'iface' to every ip in 'dstIPs' - over a single socket
+// - see 'PingManyContext'
+func PingManyOverIfaceContext(ctx context.Context, dstIPs []net.IP, iface net.Interface, opts ...Option) (map[string]Result, error) {
+	return pingManyOverIface(ctx, dstIPs, iface, nil, nil, opts)
+}
+
+// pingManyOverIface pings 'dstIPs' over interface 'iface' - 'onResult' gets called per first reply, if not nil.
+// 'progress' is shared with the scans over other interfaces - a new one is used, if nil.
+func pingManyOverIface(ctx context.Context, dstIPs []net.IP, iface net.Interface, onResult func(Result),
+	progress *scanProgress, opts []Option) (map[string]Result, error) {
+	cfg := newConfig(opts)
+	if len(dstIPs) == 0 {
+		return map[string]Result{}, nil
+	}
+	if progress == nil {
+		progress = newScanProgress(cfg, len(dstIPs))
+	}
+	if err := cfg.checkMTU(iface); err != nil {
+		return nil, err
+	}
+	for _, dstIP := range dstIPs {
+		if err := validateIP(dstIP); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := cfg.withOverallDeadline(ctx)
+	defer cancel()
+
+	var srcIPs []net.IP
+	var socks []socket
+	err := inNetNS(cfg.netns, func() (err error) {
+		if srcIPs, err = scanSourceIPs(dstIPs, iface, cfg); err != nil {
+			return err
+		}
+		for i := 0; i < cfg.scanSockets(len(dstIPs)); i++ {
+			sock, err := openSocket(iface, cfg)
+			if err != nil {
+				for _, sock := range socks {
+					sock.deinitialize()
+				}
+				return err
+			}
+			socks = append(socks, sock)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// shard the targets round robin over the sockets
+	shardIPs := make([][]net.IP, len(socks))
+	shardSrcIPs := make([][]net.IP, len(socks))
+	for i, dstIP := range dstIPs {
+		shardIPs[i%len(socks)] = append(shardIPs[i%len(socks)], dstIP)
+		shardSrcIPs[i%len(socks)] = append(shardSrcIPs[i%len(socks)], srcIPs[i])
+	}
+
+	// the shards are received concurrently - the callbacks must not
+	if onResult != nil && len(socks) > 1 {
+		var mu sync.Mutex
+		serialized := onResult
+		onResult = func(result Result) {
+			mu.Lock()
+			defer mu.Unlock()
+			serialized(result)
+		}
+	}
+
+	// stop the other shards on the first error
+	ctx, cancelShards := context.WithCancel(ctx)
+	defer cancelShards()
+
+	// the limits apply to all sockets of the interface
+	limiter := newScanLimiter(cfg)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	var stats Stats
+	results := make(map[string]Result)
+	for i, sock := range socks {
+		s := &scan{
+			cfg:      cfg,
+			iface:    iface,
+			onResult: onResult,
+			progress: progress,
+			limiter:  limiter,
+			pending:  make(map[string]*scanTarget),
+			results:  make(map[string]Result),
+			done:     make(chan struct{}),
+			stopped:  make(chan struct{}),
+			errChan:  make(chan error, 1),
+		}
+		srcMac := cfg.srcMac(iface)
+		for j, dstIP := range shardIPs[i] {
+			s.pending[string(dstIP.To4())] = &scanTarget{
+				request: cfg.newArpRequest(srcMac, shardSrcIPs[i][j], cfg.dstMac(), dstIP),
+			}
+		}
+
+		wg.Add(1)
+		go func(s *scan, sock socket, dstIPs []net.IP) {
+			defer wg.Done()
+
+			shardResults, shardStats, err := s.run(ctx, sock, dstIPs)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+					cancelShards()
+				}
+				return
+			}
+			for ip, result := range shardResults {
+				results[ip] = result
+			}
+			stats.Replies += shardStats.Replies
+			stats.Ignored += shardStats.Ignored
+			stats.Socket.add(shardStats.Socket)
+		}(s, sock, shardIPs[i])
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	cfg.logFrameSummary(stats)
+	cfg.reportStats(stats)
+	return results, nil
+}
+
+// scanSourceIPs returns the source ip per target - the address of 'iface' in the network of the target,
+// so probes to multiple local subnets on one interface get replied. Targets outside of all local subnets
+// use the source of the first target within one.
+func scanSourceIPs(dstIPs []net.IP, iface net.Interface, cfg *config) ([]net.IP, error) {
+	srcIPs := make([]net.IP, len(dstIPs))
+	var fallback net.IP
+	var firstErr error
+	for i, dstIP := range dstIPs {
+		srcIP, err := cfg.srcIP(dstIP, iface)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		srcIPs[i] = srcIP
+		if fallback == nil {
+			fallback = srcIP
+		}
+	}
+	if fallback == nil {
+		return nil, firstErr
+	}
+
+	for i := range srcIPs {
+		if srcIPs[i] == nil {
+			srcIPs[i] = fallback
+		}
+	}
+	return srcIPs, nil
+}
+
+// MinCIDRPrefix is the shortest prefix of the networks per 'CIDRHosts' - a /16 has 65534 hosts already
+const MinCIDRPrefix = 16
+
+// CIDRHosts returns the host addresses in the v4 network 'cidr' - without the network and broadcast address,
+// except for /31 and /32 networks. Returns 'ErrNetworkTooLarge' for prefixes shorter than 'MinCIDRPrefix',
+// such as a /8 - split them into smaller networks.
+func CIDRHosts(cidr string) ([]net.IP, error) {
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	network := ipnet.IP.To4()
+	if network == nil {
+		return nil, fmt.Errorf("not a valid v4 network: %s", cidr)
+	}
+
+	ones, bits := ipnet.Mask.Size()
+	if ones < MinCIDRPrefix {
+		return nil, fmt.Errorf("%w: %s - at least a /%d expected", ErrNetworkTooLarge, cidr, MinCIDRPrefix)
+	}
+	first := binary.BigEndian.Uint32(network)
+	last := first | (1<<uint(bits-ones) - 1)
+	if bits-ones > 1 {
+		// skip the network and broadcast address
+		first++
+		last--
+	}
+
+	hosts := make([]net.IP, 0, last-first+1)
+	for n := first; n <= last && n >= first; n++ {
+		ip := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(ip, n)
+		hosts = append(hosts, ip)
+	}
+	return hosts, nil
+}
+
+type scanTarget struct {
+	request  arpDatagram
+	sendTime time.Time
+	// release frees the in-flight slot of the sent request - see 'scanLimiter'
+	release func()
+}
+
+// scanLimiter paces the requests of a scan per 'WithRate', and bounds the requests awaiting a reply
+// per 'WithMaxInFlight' - a request is in flight until its reply or the probe timeout
+type scanLimiter struct {
+	interval time.Duration
+	timeout  time.Duration
+	// slots holds a token per request in flight - nil without limit
+	slots chan struct{}
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+func newScanLimiter(cfg *config) *scanLimiter {
+	l := &scanLimiter{timeout: cfg.effectiveProbeTimeout()}
+	if cfg.rate > 0 {
+		l.interval = time.Second / time.Duration(cfg.rate)
+	}
+	if cfg.maxInFlight > 0 {
+		l.slots = make(chan struct{}, cfg.maxInFlight)
+	}
+	return l
+}
+
+// acquire blocks until a request may be sent - returns the error of 'ctx', if it's done before
+func (l *scanLimiter) acquire(ctx context.Context) error {
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if l.interval <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	at := time.Now()
+	if at.Before(l.next) {
+		at = l.next
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	if wait := time.Until(at); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			l.releaser()()
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// sent returns the function to free the slot of a request sent per 'acquire' - it's freed
+// after the probe timeout at the latest
+func (l *scanLimiter) sent() func() {
+	release := l.releaser()
+	if l.slots != nil {
+		time.AfterFunc(l.timeout, release)
+	}
+	return release
+}
+
+// releaser returns the function to free a slot acquired per 'acquire' - once, however often it's called
+func (l *scanLimiter) releaser() func() {
+	if l.slots == nil {
+		return func() {}
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-l.slots
+		})
+	}
+}
+
+// scan sends requests to many targets over a single socket, and matches the replies per sender ip
+type scan struct {
+	cfg      *config
+	iface    net.Interface
+	onResult func(Result)
+	progress *scanProgress
+	limiter  *scanLimiter
+
+	mu      sync.Mutex
+	pending map[string]*scanTarget
+	results map[string]Result
+	stats   Stats
+
+	done    chan struct{}
+	stopped chan struct{}
+	errChan chan error
+}
+
+// run sends the requests to 'dstIPs' over 'sock' and collects the replies until the probe timeout after the last one
+// - the socket gets closed on return
+func (s *scan) run(ctx context.Context, sock socket, dstIPs []net.IP) (map[string]Result, Stats, error) {
+	go s.receive(sock)
+	defer func() {
+		// no callback after the return
+		close(s.done)
+		<-s.stopped
+	}()
+
+	verboseLog.Printf("scan %d ips over interface: %s\n", len(dstIPs), ifaceFingerprint(s.iface, s.cfg.srcMac(s.iface)))
+	if err := s.send(ctx, sock, dstIPs); err != nil {
+		return nil, Stats{}, err
+	}
+
+	// collect replies until the probe timeout after the last request
+	wait := time.NewTimer(s.cfg.effectiveProbeTimeout())
+	defer wait.Stop()
+	select {
+	case <-wait.C:
+	case err := <-s.errChan:
+		return nil, Stats{}, err
+	case <-ctx.Done():
+		if ctx.Err() == context.Canceled {
+			return nil, Stats{}, ctx.Err()
+		}
+	}
+	results, stats := s.collect(sock)
+	return results, stats, nil
+}
+
+func (s *scan) send(ctx context.Context, sock socket, dstIPs []net.IP) error {
+	for _, dstIP := range dstIPs {
+		err := ctx.Err()
+		if err == nil {
+			err = s.limiter.acquire(ctx)
+		}
+		if err != nil {
+			if err == context.Canceled {
+				return err
+			}
+			// deadline reached - collect the replies until now
+			return nil
+		}
+
+		s.mu.Lock()
+		target := s.pending[string(dstIP.To4())]
+		sendTime, err := sock.send(target.request)
+		target.sendTime = sendTime
+		target.release = s.limiter.sent()
+		s.mu.Unlock()
+		if err != nil {
+			target.release()
+			return err
+		}
+		s.progress.probed()
+	}
+	return nil
+}
+
+func (s *scan) receive(sock socket) {
+	defer close(s.stopped)
+	defer sock.deinitialize()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+
+		response, receiveTime, err := sock.receive(time.Now().Add(pollInterval))
+		if err == ErrTimeout {
+			continue
+		}
+		if err != nil {
+			select {
+			case s.errChan <- err:
+			default:
+			}
+			return
+		}
+
+		s.mu.Lock()
+		var result *Result
+		key := string(response.SenderIP().To4())
+		if target, ok := s.pending[key]; ok && !target.sendTime.IsZero() && s.cfg.isResponse(response, target.request) {
+			s.stats.Replies++
+			target.release()
+			if _, seen := s.results[key]; !seen {
+				verboseLog.Printf("process received arp: srcIP: '%s', srcMac: '%s'\n",
+					response.SenderIP(), response.SenderMac())
+				r := newResult(response, target.request, receiveTime.Sub(target.sendTime), s.iface)
+				s.results[key] = r
+				result = &r
+			}
+		} else {
+			s.stats.Ignored++
+		}
+		s.mu.Unlock()
+
+		if result != nil {
+			s.progress.up()
+			if s.onResult != nil {
+				s.onResult(*result)
+			}
+		}
+	}
+}
+
+// collect returns the results keyed by ip - and the stats
+func (s *scan) collect(sock socket) (map[string]Result, Stats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stats.Socket = socketStatsOf(sock)
+	results := make(map[string]Result, len(s.results))
+	for _, result := range s.results {
+		results[result.IP.String()] = result
+	}
+	return results, s.stats
+}
+
+// Progress is the progress of a multi-target operation - see 'WithProgress'
+type Progress struct {
+	// Total counts the targets
+	Total int
+	// Probed counts the targets, which got their probe sent
+	Probed int
+	// Up counts the targets, which replied
+	Up int
+}
+
+// scanProgress reports the progress per 'WithProgress' - a no-op without it
+type scanProgress struct {
+	fn       func(Progress)
+	mu       sync.Mutex
+	progress Progress
+}
+
+func newScanProgress(cfg *config, total int) *scanProgress {
+	return &scanProgress{
+		fn:       cfg.progress,
+		progress: Progress{Total: total},
+	}
+}
+
+func (p *scanProgress) probed() {
+	p.report(func(progress *Progress) { progress.Probed++ })
+}
+
+func (p *scanProgress) up() {
+	p.report(func(progress *Progress) { progress.Up++ })
+}
+
+// report applies 'update' and calls the callback - under the lock, so the calls are serialized
+func (p *scanProgress) report(update func(*Progress)) {
+	if p.fn == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	update(&p.progress)
+	p.fn(p.progress)
+}
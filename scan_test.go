@@ -0,0 +1,434 @@
+package arping
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestCIDRHosts(t *testing.T) {
+	tests := []struct {
+		cidr  string
+		first string
+		last  string
+		count int
+	}{
+		{"192.168.1.0/24", "192.168.1.1", "192.168.1.254", 254},
+		{"10.0.0.5/30", "10.0.0.5", "10.0.0.6", 2},
+		{"10.0.0.4/31", "10.0.0.4", "10.0.0.5", 2},
+		{"10.0.0.4/32", "10.0.0.4", "10.0.0.4", 1},
+	}
+	for _, tt := range tests {
+		hosts, err := CIDRHosts(tt.cidr)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", tt.cidr, err)
+		}
+		if len(hosts) != tt.count {
+			t.Fatalf("%s: %d hosts expected, but got: %d", tt.cidr, tt.count, len(hosts))
+		}
+		if hosts[0].String() != tt.first || hosts[len(hosts)-1].String() != tt.last {
+			t.Errorf("%s: range '%s' - '%s' expected, but got: '%s' - '%s'",
+				tt.cidr, tt.first, tt.last, hosts[0], hosts[len(hosts)-1])
+		}
+	}
+
+	for _, cidr := range []string{"fe80::/64", "192.168.1.0", "no-network"} {
+		if _, err := CIDRHosts(cidr); err == nil {
+			t.Errorf("%s: error expected", cidr)
+		}
+	}
+
+	for _, cidr := range []string{"0.0.0.0/0", "10.0.0.0/8", "172.16.0.0/15"} {
+		if _, err := CIDRHosts(cidr); !errors.Is(err, ErrNetworkTooLarge) {
+			t.Errorf("%s: 'ErrNetworkTooLarge' expected, but got: %v", cidr, err)
+		}
+	}
+	if hosts, err := CIDRHosts("172.16.0.0/16"); err != nil || len(hosts) != 65534 {
+		t.Errorf("65534 hosts of a /16 expected, but got: %d (%v)", len(hosts), err)
+	}
+}
+
+func TestPingManyOverIface(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	useFakeSocket(t, newFakeSocket(func(request arpDatagram) []arpDatagram {
+		// only 127.0.0.2 and 127.0.0.4 are online - 127.0.0.2 answers twice
+		switch request.TargetIP().String() {
+		case "127.0.0.2":
+			return []arpDatagram{newArpReply(request, mac), newArpReply(request, mac)}
+		case "127.0.0.4":
+			return []arpDatagram{newArpReply(request, mac)}
+		}
+		return nil
+	}))
+
+	dstIPs := []net.IP{
+		net.ParseIP("127.0.0.2"),
+		net.ParseIP("127.0.0.3"),
+		net.ParseIP("127.0.0.4"),
+	}
+	var stats Stats
+	results, err := PingManyOverIfaceContext(context.Background(), dstIPs, loopbackInterface(t),
+		WithTimeout(100*time.Millisecond), WithStats(&stats))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("2 results expected, but got: %v", results)
+	}
+	for _, ip := range []string{"127.0.0.2", "127.0.0.4"} {
+		result, ok := results[ip]
+		if !ok {
+			t.Errorf("result for '%s' expected", ip)
+			continue
+		}
+		if result.IP.String() != ip || result.HwAddr.String() != mac.String() || !result.Solicited {
+			t.Errorf("unexpected result for '%s': %+v", ip, result)
+		}
+	}
+	if stats.Replies != 3 {
+		t.Errorf("3 replies expected, but got: %d", stats.Replies)
+	}
+}
+
+func TestPingManyOverIfaceContextCancel(t *testing.T) {
+	useFakeSocket(t, newFakeSocket(nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	_, err := PingManyOverIfaceContext(ctx, []net.IP{net.ParseIP("127.0.0.2")}, loopbackInterface(t),
+		WithTimeout(10*time.Second))
+	if err != context.Canceled {
+		t.Fatalf("context canceled error expected, but received: %v", err)
+	}
+}
+
+func TestPingManyOverIfaceWithTwoSubnets(t *testing.T) {
+	origAddrs := interfaceAddrs
+	interfaceAddrs = func(iface net.Interface) ([]net.Addr, error) {
+		return []net.Addr{
+			&net.IPNet{IP: net.ParseIP("127.0.0.1").To4(), Mask: net.CIDRMask(24, 32)},
+			&net.IPNet{IP: net.ParseIP("10.0.0.1").To4(), Mask: net.CIDRMask(24, 32)},
+		}, nil
+	}
+	t.Cleanup(func() {
+		interfaceAddrs = origAddrs
+	})
+
+	sock := newFakeSocket(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{newArpReply(request, net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01})}
+	})
+	useFakeSocket(t, sock)
+
+	dstIPs := []net.IP{net.ParseIP("127.0.0.2"), net.ParseIP("10.0.0.2")}
+	results, err := PingManyOverIfaceContext(context.Background(), dstIPs, loopbackInterface(t),
+		WithTimeout(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Errorf("2 results expected, but got: %v", results)
+	}
+
+	expected := map[string]string{"127.0.0.2": "127.0.0.1", "10.0.0.2": "10.0.0.1"}
+	for _, request := range sock.sentDatagrams() {
+		if src := expected[request.TargetIP().String()]; request.SenderIP().String() != src {
+			t.Errorf("request to '%s' from '%s' expected, but sent from: '%s'",
+				request.TargetIP(), src, request.SenderIP())
+		}
+	}
+}
+
+func TestPingManyStream(t *testing.T) {
+	useFakeSocket(t, newFakeSocket(func(request arpDatagram) []arpDatagram {
+		if request.TargetIP().Equal(net.ParseIP("127.0.0.3")) {
+			return nil
+		}
+		reply := newArpReply(request, net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01})
+		return []arpDatagram{reply, reply}
+	}))
+
+	var streamed []Result
+	dstIPs := []net.IP{net.ParseIP("127.0.0.2"), net.ParseIP("127.0.0.3"), net.ParseIP("127.0.0.4")}
+	err := PingManyStream(context.Background(), dstIPs, func(result Result) {
+		streamed = append(streamed, result)
+	}, WithTimeout(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streamed) != 2 {
+		t.Errorf("2 streamed results - one per host - expected, but got: %v", streamed)
+	}
+}
+
+func TestPingManyProgress(t *testing.T) {
+	useFakeSocket(t, newFakeSocket(func(request arpDatagram) []arpDatagram {
+		if request.TargetIP().Equal(net.ParseIP("127.0.0.3")) {
+			return nil
+		}
+		return []arpDatagram{newArpReply(request, net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01})}
+	}))
+
+	var last Progress
+	calls := 0
+	dstIPs := []net.IP{net.ParseIP("127.0.0.2"), net.ParseIP("127.0.0.3"), net.ParseIP("127.0.0.4")}
+	_, err := PingMany(dstIPs, WithTimeout(20*time.Millisecond), WithProgress(func(p Progress) {
+		last = p
+		calls++
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Progress{Total: 3, Probed: 3, Up: 2}); last != want {
+		t.Errorf("final progress %+v expected, but got: %+v", want, last)
+	}
+	if calls != 5 {
+		t.Errorf("5 calls - per probe and responder - expected, but got: %d", calls)
+	}
+}
+
+// useFakeSockets opens a new fake socket per 'openSocket' - as every raw socket receives its own copy of the frames
+func useFakeSockets(t testing.TB, sendDelay time.Duration, respond func(request arpDatagram) []arpDatagram) *int {
+	t.Helper()
+
+	opened := 0
+	orig := openSocket
+	openSocket = func(iface net.Interface, cfg *config) (socket, error) {
+		opened++
+		sock := newFakeSocket(respond)
+		sock.sendDelay = sendDelay
+		return &countingSocket{socket: sock}, nil
+	}
+	t.Cleanup(func() {
+		openSocket = orig
+	})
+	return &opened
+}
+
+func TestPingManySocketConcurrency(t *testing.T) {
+	opened := useFakeSockets(t, 0, func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{newArpReply(request, net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01})}
+	})
+
+	dstIPs, err := CIDRHosts("127.0.0.0/28")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stats Stats
+	results, err := PingManyOverIfaceContext(context.Background(), dstIPs, loopbackInterface(t),
+		WithTimeout(20*time.Millisecond), WithSocketConcurrency(3), WithStats(&stats))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *opened != 3 {
+		t.Errorf("3 sockets expected, but opened: %d", *opened)
+	}
+	if len(results) != len(dstIPs) {
+		t.Errorf("%d results expected, but got: %d", len(dstIPs), len(results))
+	}
+	if stats.Replies != len(dstIPs) || stats.Socket.Sent != len(dstIPs) {
+		t.Errorf("%d replies and sent frames expected, but got: %+v", len(dstIPs), stats)
+	}
+}
+
+// sendTimes records the send time of every request answered per 'respond'
+func sendTimes(respond func(request arpDatagram) []arpDatagram) (*[]time.Time, func(request arpDatagram) []arpDatagram) {
+	var times []time.Time
+	return &times, func(request arpDatagram) []arpDatagram {
+		times = append(times, time.Now())
+		if respond == nil {
+			return nil
+		}
+		return respond(request)
+	}
+}
+
+func TestPingManyWithRate(t *testing.T) {
+	times, respond := sendTimes(nil)
+	useFakeSocket(t, newFakeSocket(respond))
+
+	dstIPs, err := CIDRHosts("127.0.0.0/28")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PingManyOverIfaceContext(context.Background(), dstIPs, loopbackInterface(t),
+		WithTimeout(10*time.Millisecond), WithRate(200)); err != nil {
+		t.Fatal(err)
+	}
+	if len(*times) != len(dstIPs) {
+		t.Fatalf("%d requests expected, but sent: %d", len(dstIPs), len(*times))
+	}
+	// the first request may be sent a bit late - the later ones are paced from its schedule
+	for i, sent := range *times {
+		if min := time.Duration(i)*5*time.Millisecond - time.Millisecond; sent.Sub((*times)[0]) < min {
+			t.Errorf("request %d expected at least %s after the first, but sent after: %s", i, min, sent.Sub((*times)[0]))
+		}
+	}
+}
+
+func TestPingManyWithMaxInFlight(t *testing.T) {
+	dstIPs, err := CIDRHosts("127.0.0.0/29")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// without replies, every request stays in flight until the probe timeout
+	times, respond := sendTimes(nil)
+	useFakeSocket(t, newFakeSocket(respond))
+	probeTimeout := 20 * time.Millisecond
+	if _, err := PingManyOverIfaceContext(context.Background(), dstIPs, loopbackInterface(t),
+		WithProbeTimeout(probeTimeout), WithMaxInFlight(2)); err != nil {
+		t.Fatal(err)
+	}
+	if len(*times) != len(dstIPs) {
+		t.Fatalf("%d requests expected, but sent: %d", len(dstIPs), len(*times))
+	}
+	for i := 2; i < len(*times); i++ {
+		if gap := (*times)[i].Sub((*times)[i-2]); gap < probeTimeout {
+			t.Errorf("request %d expected at least %s after request %d, but sent after: %s", i, probeTimeout, i-2, gap)
+		}
+	}
+
+	// a reply frees the slot right away
+	times, respond = sendTimes(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{newArpReply(request, net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01})}
+	})
+	useFakeSocket(t, newFakeSocket(respond))
+	results, err := PingManyOverIfaceContext(context.Background(), dstIPs, loopbackInterface(t),
+		WithProbeTimeout(time.Second), WithDeadline(time.Now().Add(300*time.Millisecond)), WithMaxInFlight(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(dstIPs) {
+		t.Errorf("%d results expected, but got: %d", len(dstIPs), len(results))
+	}
+}
+
+func BenchmarkScanSocketConcurrency(b *testing.B) {
+	dstIPs, err := CIDRHosts("127.0.0.0/24")
+	if err != nil {
+		b.Fatal(err)
+	}
+	iface := loopbackInterface(b)
+
+	for _, n := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("sockets=%d", n), func(b *testing.B) {
+			useFakeSockets(b, 20*time.Microsecond, func(request arpDatagram) []arpDatagram {
+				return []arpDatagram{newArpReply(request, net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01})}
+			})
+			for i := 0; i < b.N; i++ {
+				if _, err := PingManyOverIfaceContext(context.Background(), dstIPs, iface,
+					WithTimeout(time.Millisecond), WithSocketConcurrency(n)); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(dstIPs)*b.N)/b.Elapsed().Seconds(), "targets/s")
+		})
+	}
+}
+
+func TestPingManyErrNoReply(t *testing.T) {
+	useFakeSocket(t, newFakeSocket(func(request arpDatagram) []arpDatagram {
+		if request.TargetIP().Equal(net.ParseIP("127.0.0.3")) {
+			return nil
+		}
+		return []arpDatagram{newArpReply(request, net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01})}
+	}))
+
+	// the deadline passes before the probe timeout - that's no error of the batch
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	online, offline := net.ParseIP("127.0.0.2"), net.ParseIP("127.0.0.3")
+	results, err := PingManyContext(ctx, []net.IP{online, offline}, WithTimeout(time.Second))
+	if err != nil {
+		t.Fatalf("no error of the batch expected, but got: %v", err)
+	}
+
+	if result, err := ResultFor(results, online); err != nil || !result.IP.Equal(online) {
+		t.Errorf("result of '%s' expected, but got: %+v, %v", online, result, err)
+	}
+	_, err = ResultFor(results, offline)
+	if !errors.Is(err, ErrNoReply) || errors.Is(err, ErrTimeout) {
+		t.Errorf("ErrNoReply - not ErrTimeout - expected, but got: %v", err)
+	}
+}
+
+func TestScanLinkLocal(t *testing.T) {
+	var addrs []net.Addr
+	origAddrs := interfaceAddrs
+	interfaceAddrs = func(iface net.Interface) ([]net.Addr, error) {
+		return addrs, nil
+	}
+	t.Cleanup(func() {
+		interfaceAddrs = origAddrs
+	})
+
+	peer := net.ParseIP("169.254.10.20")
+	sock := newFakeSocket(func(request arpDatagram) []arpDatagram {
+		if !request.TargetIP().Equal(peer) {
+			return nil
+		}
+		return []arpDatagram{newArpReply(request, net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01})}
+	})
+	useFakeSocket(t, sock)
+
+	lo := loopbackInterface(t)
+	for _, srcIP := range []net.IP{net.ParseIP("169.254.7.7").To4(), net.IPv4zero.To4()} {
+		addrs = nil
+		if !srcIP.IsUnspecified() {
+			addrs = []net.Addr{&net.IPNet{IP: srcIP, Mask: net.CIDRMask(16, 32)}}
+		}
+		results, err := ScanLinkLocal(lo, WithTimeout(20*time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result, ok := results[peer.String()]; !ok || len(results) != 1 || !result.SourceIP.Equal(srcIP) {
+			t.Errorf("one result from '%s' to '%s' expected, but got: %v", peer, srcIP, results)
+		}
+	}
+	if sent := len(sock.sentDatagrams()); sent != 2*65024 {
+		t.Errorf("2 sweeps of 65024 addresses expected, but sent: %d", sent)
+	}
+}
+
+func TestScanUntil(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	sock := newFakeSocket(func(request arpDatagram) []arpDatagram {
+		switch request.TargetIP().String() {
+		case "127.0.0.2", "127.0.0.3", "127.0.0.5":
+			return []arpDatagram{newArpReply(request, mac)}
+		}
+		return nil
+	})
+	useFakeSocket(t, sock)
+	SetInterfaceSelector(func(candidates []net.Interface, dstIP net.IP) (net.Interface, error) {
+		return loopbackInterface(t), nil
+	})
+	t.Cleanup(func() {
+		SetInterfaceSelector(nil)
+	})
+
+	// the rate stretches the sweep of the /24 to 254ms
+	results, err := ScanUntil("127.0.0.0/24", 2, time.Second, WithRate(1000), WithTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results["127.0.0.2"].IP == nil || results["127.0.0.3"].IP == nil {
+		t.Errorf("the replies of 127.0.0.2 and 127.0.0.3 expected, but got: %v", results)
+	}
+	if sent := len(sock.sentDatagrams()); sent >= 254 {
+		t.Errorf("the scan expected to stop early, but sent: %d", sent)
+	}
+
+	// the timeout passes before the quorum
+	results, err = ScanUntil("127.0.0.0/29", 4, 50*time.Millisecond, WithTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Errorf("the replies so far expected, but got: %v", results)
+	}
+}
@@ -0,0 +1,233 @@
+package arping
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"syscall"
+	"time"
+)
+
+// Frame is a received arp datagram - request or reply
+type Frame struct {
+	// Oper is the arp operation - 1 for requests, 2 for replies
+	Oper      uint16
+	SenderMac net.HardwareAddr
+	SenderIP  net.IP
+	TargetMac net.HardwareAddr
+	TargetIP  net.IP
+	// EthSrcMac is the source address of the ethernet header - see 'Result.EthSrcMac'
+	EthSrcMac net.HardwareAddr
+	// Time is the receive time
+	Time time.Time
+	// Iface is the name of the interface which received the frame
+	Iface string
+}
+
+// IsRequest returns true for arp requests
+func (f Frame) IsRequest() bool {
+	return f.Oper == requestOper
+}
+
+// IsReply returns true for arp replies
+func (f Frame) IsReply() bool {
+	return f.Oper == responseOper
+}
+
+// IsGratuitous returns true for gratuitous arps - announcements of the sender ip, see 'SniffGratuitous'
+func (f Frame) IsGratuitous() bool {
+	return isGratuitous(f.Oper, f.SenderIP, f.TargetMac, f.TargetIP)
+}
+
+// isGratuitous returns true if the sender announces its own address: the sender ip is the target ip,
+// or a reply to the broadcast address. Probes from the unspecified address 0.0.0.0 announce nothing.
+func isGratuitous(oper uint16, senderIP net.IP, targetMac net.HardwareAddr, targetIP net.IP) bool {
+	if senderIP.IsUnspecified() {
+		return false
+	}
+	return senderIP.Equal(targetIP) || (oper == responseOper && bytes.Equal(targetMac, BroadcastMAC()))
+}
+
+func newFrame(datagram arpDatagram, receiveTime time.Time, iface net.Interface) Frame {
+	return Frame{
+		Oper:      datagram.oper,
+		SenderMac: datagram.SenderMac(),
+		SenderIP:  datagram.SenderIP(),
+		TargetMac: net.HardwareAddr(datagram.tha),
+		TargetIP:  datagram.TargetIP(),
+		EthSrcMac: datagram.EthSrcMac(),
+		Time:      receiveTime,
+		Iface:     iface.Name,
+	}
+}
+
+// Sniff calls 'onFrame' for every arp frame received over interface 'iface' - until 'ctx' is done.
+//
+// 'onFrame' runs in the calling goroutine - a slow callback delays the reading of the socket.
+// Use 'WithFrameRateLimit' to drop frames above a rate, and 'WithStats' to get the number of dropped frames.
+// No callback happens after 'ctx' is done. Returns the error from 'ctx' - or the error which stopped the sniffer.
+func Sniff(ctx context.Context, iface net.Interface, onFrame func(Frame), opts ...Option) error {
+	return sniff(ctx, iface, nil, onFrame, opts)
+}
+
+// SniffGratuitous calls 'onAnnounce' for every gratuitous arp received over interface 'iface' - until 'ctx' is done.
+//
+// This reports hosts announcing themselves, such as on new dhcp leases or failovers - see 'Frame.IsGratuitous'.
+// Other frames are dropped right after parsing, before the rate limit per 'WithFrameRateLimit' applies.
+// The callback rules and errors are the same as in 'Sniff'.
+func SniffGratuitous(ctx context.Context, iface net.Interface, onAnnounce func(ip net.IP, mac net.HardwareAddr, t time.Time),
+	opts ...Option) error {
+	accept := func(datagram arpDatagram) bool {
+		return isGratuitous(datagram.oper, datagram.SenderIP(), net.HardwareAddr(datagram.tha), datagram.TargetIP())
+	}
+	return sniff(ctx, iface, accept, func(frame Frame) {
+		onAnnounce(frame.SenderIP, frame.SenderMac, frame.Time)
+	}, opts)
+}
+
+// Ether types of the sockets per 'SniffProto' - the values of linux/if_ether.h
+const (
+	// EthPAll captures the frames of all protocols
+	EthPAll uint16 = 0x0003
+	// EthPArp captures the arp frames - the default of all sockets
+	EthPArp uint16 = etherTypeArp
+)
+
+// SniffProto calls 'onFrame' for every ethernet frame of ether type 'ethProto' received over interface 'iface'
+// - until 'ctx' is done. 'EthPAll' captures all protocols, to filter them in go.
+//
+// 'onFrame' gets the raw frame, starting with the ethernet header - it may retain it. Use 'Sniff' for decoded
+// arp frames. The callback rules, 'WithFrameRateLimit' and the errors are the same as in 'Sniff'.
+//
+// 'EthPAll' copies every frame of the interface to userspace, sent or received, in any protocol: on a busy link
+// that's a lot of system calls and allocations, and frames get dropped once the callback can't keep up
+// - see 'Stats.Socket'. Prefer a specific ether type, and a rate limit on busy links.
+func SniffProto(ctx context.Context, iface net.Interface, ethProto uint16, onFrame func(frame []byte, t time.Time),
+	opts ...Option) error {
+	cfg := newConfig(appendOptions(opts, withEthProto(ethProto)))
+
+	var sock frameSocket
+	err := inNetNS(cfg.netns, func() (err error) {
+		sock, err = openFrameSocket(iface, cfg)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	defer sock.deinitialize()
+
+	var stats Stats
+	defer func() {
+		cfg.reportStats(stats)
+	}()
+
+	limiter := newRateLimiter(cfg.frameRate)
+	for ctx.Err() == nil {
+		frame, receiveTime, err := sock.receiveFrame(time.Now().Add(pollInterval))
+		if err == ErrTimeout || errors.Is(err, syscall.EINTR) || errors.Is(err, ErrInvalidArp) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		// the kernel filters per ether type - a socket per 'WithSocketFactory' may not
+		if len(frame) < ethernetHeaderLen ||
+			(ethProto != EthPAll && binary.BigEndian.Uint16(frame[12:14]) != ethProto) {
+			continue
+		}
+
+		if !limiter.allow(receiveTime) {
+			stats.Dropped++
+			continue
+		}
+		onFrame(frame, receiveTime)
+	}
+	return ctx.Err()
+}
+
+// sniff calls 'onFrame' for every received frame which passes 'accept' - all frames if it's nil, see 'Sniff'
+func sniff(ctx context.Context, iface net.Interface, accept func(arpDatagram) bool, onFrame func(Frame),
+	opts []Option) error {
+	cfg := newConfig(opts)
+
+	var sock socket
+	err := inNetNS(cfg.netns, func() (err error) {
+		sock, err = openSocket(iface, cfg)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	defer sock.deinitialize()
+
+	var stats Stats
+	defer func() {
+		stats.Socket = socketStatsOf(sock)
+		cfg.reportStats(stats)
+	}()
+
+	limiter := newRateLimiter(cfg.frameRate)
+	for ctx.Err() == nil {
+		datagram, receiveTime, err := sock.receive(time.Now().Add(pollInterval))
+		if err == ErrTimeout {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if accept != nil && !accept(datagram) {
+			continue
+		}
+
+		if !limiter.allow(receiveTime) {
+			stats.Dropped++
+			continue
+		}
+		onFrame(newFrame(datagram, receiveTime, iface))
+	}
+	return ctx.Err()
+}
+
+// rateLimiter is a token bucket, which allows 'rate' events per second - with bursts up to 'rate'
+type rateLimiter struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a limiter for 'rate' events per second - nil, which allows everything, if 'rate' <= 0
+func newRateLimiter(rate int) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &rateLimiter{rate: float64(rate), tokens: float64(rate)}
+}
+
+// allow returns true if an event at 'now' is within the rate
+func (l *rateLimiter) allow(now time.Time) bool {
+	if l == nil {
+		return true
+	}
+
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.rate {
+			l.tokens = l.rate
+		}
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
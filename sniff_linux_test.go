@@ -0,0 +1,58 @@
+package arping
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSniffWithExcludeOutgoing(t *testing.T) {
+	lo := loopbackInterface(t)
+	t.Cleanup(func() { CloseRaw(lo) })
+	targetIP := net.ParseIP("127.0.0.250")
+	frame := newArpRequest(net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}, net.ParseIP("127.0.0.1"),
+		BroadcastMAC(), targetIP).MarshalWithEthernetHeader()
+
+	// the loopback interface receives every sent frame - the outgoing copy and the looped back one
+	sniffed := func(opts ...Option) int {
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		defer cancel()
+
+		frames := 0
+		var wg sync.WaitGroup
+		var sendErr error
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			time.Sleep(100 * time.Millisecond)
+			_, sendErr = SendRaw(lo, frame)
+		}()
+		defer wg.Wait()
+		err := SniffProto(ctx, lo, EthPAll, func(frame []byte, _ time.Time) {
+			if packet, err := DecodeARP(frame, false); err == nil && packet.TargetIP.Equal(targetIP) {
+				frames++
+			}
+		}, opts...)
+		if errors.Is(err, ErrInsufficientPrivilege) {
+			t.Skip("sniffing requires the raw socket access")
+		}
+		if err != context.DeadlineExceeded {
+			t.Fatalf("deadline exceeded error expected, but received: %v", err)
+		}
+		wg.Wait()
+		if sendErr != nil {
+			t.Fatal(sendErr)
+		}
+		return frames
+	}
+
+	if frames := sniffed(); frames != 2 {
+		t.Errorf("the outgoing and the looped back frame expected, but got: %d", frames)
+	}
+	if frames := sniffed(WithExcludeOutgoing()); frames != 1 {
+		t.Errorf("only the looped back frame expected, but got: %d", frames)
+	}
+}
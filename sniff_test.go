@@ -0,0 +1,125 @@
+package arping
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSniffWithFrameRateLimit(t *testing.T) {
+	sock := newFakeSocket(nil)
+	useFakeSocket(t, sock)
+
+	request := newArpRequest(net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}, net.ParseIP("127.0.0.1"),
+		BroadcastMAC(), net.ParseIP("127.0.0.2"))
+	for i := 0; i < 10; i++ {
+		sock.inject(request)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	var frames []Frame
+	var stats Stats
+	err := Sniff(ctx, loopbackInterface(t), func(frame Frame) {
+		frames = append(frames, frame)
+	}, WithFrameRateLimit(3), WithStats(&stats))
+	if err != context.DeadlineExceeded {
+		t.Fatalf("deadline exceeded error expected, but received: %v", err)
+	}
+
+	if len(frames) != 3 || stats.Dropped != 7 {
+		t.Errorf("3 frames and 7 dropped expected, but got: %d / %d", len(frames), stats.Dropped)
+	}
+	if !frames[0].IsRequest() || !frames[0].TargetIP.Equal(net.ParseIP("127.0.0.2")) {
+		t.Errorf("unexpected frame: %+v", frames[0])
+	}
+	if !sock.closed {
+		t.Error("socket not closed")
+	}
+}
+
+func TestSniffGratuitous(t *testing.T) {
+	sock := newFakeSocket(nil)
+	useFakeSocket(t, sock)
+
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	announce := newArpRequest(mac, net.ParseIP("127.0.0.5"), BroadcastMAC(), net.ParseIP("127.0.0.5"))
+	broadcastReply := newArpRequest(mac, net.ParseIP("127.0.0.6"), BroadcastMAC(), net.ParseIP("127.0.0.1"))
+	broadcastReply.oper = responseOper
+	probe := newArpRequest(mac, net.IPv4zero, BroadcastMAC(), net.ParseIP("127.0.0.7"))
+	request := newArpRequest(mac, net.ParseIP("127.0.0.1"), BroadcastMAC(), net.ParseIP("127.0.0.2"))
+	sock.inject(request, announce, probe, broadcastReply)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	var ips []string
+	err := SniffGratuitous(ctx, loopbackInterface(t), func(ip net.IP, from net.HardwareAddr, _ time.Time) {
+		if from.String() != mac.String() {
+			t.Errorf("announcement from '%s' expected, but got: '%s'", mac, from)
+		}
+		ips = append(ips, ip.String())
+	})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("deadline exceeded error expected, but received: %v", err)
+	}
+	if len(ips) != 2 || ips[0] != "127.0.0.5" || ips[1] != "127.0.0.6" {
+		t.Errorf("announcements of 127.0.0.5 and 127.0.0.6 expected, but got: %v", ips)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	l := newRateLimiter(2)
+	for i, expected := range []bool{true, true, false} {
+		if allowed := l.allow(now); allowed != expected {
+			t.Errorf("event %d: allowed %t expected", i, expected)
+		}
+	}
+	if !l.allow(now.Add(500 * time.Millisecond)) {
+		t.Error("event after refill should be allowed")
+	}
+	if !newRateLimiter(0).allow(now) {
+		t.Error("no limit should allow everything")
+	}
+}
+
+func TestSniffProto(t *testing.T) {
+	arpFrame := newArpRequest(net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}, net.ParseIP("10.0.0.2"),
+		BroadcastMAC(), net.ParseIP("10.0.0.1")).MarshalWithEthernetHeader()
+	ipFrame := append(append(append([]byte(nil), BroadcastMAC()...), 0x02, 0x00, 0x00, 0x00, 0x00, 0x02), 0x08, 0x00)
+	ipFrame = append(ipFrame, make([]byte, 46)...)
+
+	for _, tc := range []struct {
+		ethProto uint16
+		frames   int
+	}{{EthPAll, 2}, {EthPArp, 1}, {0x0800, 1}} {
+		wire := &memoryWire{}
+		peer := wire.attach(net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02})
+		opened := make(chan struct{})
+		factory := func(iface net.Interface) (FrameSocket, error) {
+			defer close(opened)
+			return wire.attach(net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}), nil
+		}
+		go func() {
+			<-opened
+			peer.SendFrame(arpFrame)
+			peer.SendFrame(ipFrame)
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		var types []uint16
+		err := SniffProto(ctx, net.Interface{Index: 1, Name: "mem0"}, tc.ethProto, func(frame []byte, _ time.Time) {
+			types = append(types, uint16(frame[12])<<8|uint16(frame[13]))
+		}, WithSocketFactory(factory))
+		cancel()
+		if err != context.DeadlineExceeded {
+			t.Fatalf("deadline exceeded error expected, but received: %v", err)
+		}
+		if len(types) != tc.frames || (tc.ethProto != EthPAll && types[0] != tc.ethProto) {
+			t.Errorf("%d frames of ether type %#04x expected, but got: %#04x", tc.frames, tc.ethProto, types)
+		}
+	}
+}
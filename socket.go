@@ -0,0 +1,413 @@
+package arping
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// socket sends and receives arp datagrams - see 'arpSocket' for the platform sockets
+type socket interface {
+	send(request arpDatagram) (time.Time, error)
+	// receive blocks until an arp datagram is received or 'deadline' is reached.
+	// returns 'ErrTimeout' when the deadline is reached.
+	receive(deadline time.Time) (arpDatagram, time.Time, error)
+	// setSenderFilter restricts the received datagrams to arp replies from 'ip'
+	setSenderFilter(ip net.IP) error
+	deinitialize() error
+}
+
+// frameSocket is implemented per platform - see 'arping_linux.go' and 'arping_bsd.go'
+type frameSocket interface {
+	// sendFrame sends the ethernet frame 'frame' - without the frame check sequence
+	sendFrame(frame []byte) (time.Time, error)
+	// receiveFrame blocks until an arp frame is received or 'deadline' is reached.
+	// returns 'ErrTimeout' when the deadline is reached.
+	receiveFrame(deadline time.Time) ([]byte, time.Time, error)
+	// setSenderFilter restricts the received frames to arp replies from 'ip'
+	setSenderFilter(ip net.IP) error
+	deinitialize() error
+}
+
+// FrameSocket sends and receives ethernet frames - see 'WithSocketFactory'
+type FrameSocket interface {
+	// SendFrame sends the ethernet frame 'frame' - without the frame check sequence.
+	// Returns the send time.
+	SendFrame(frame []byte) (time.Time, error)
+	// ReceiveFrame blocks until a frame is received or 'deadline' is reached.
+	// Returns the frame with its ethernet header and the receive time - 'ErrTimeout' when the deadline is reached.
+	//
+	// The times may be hardware timestamps without a monotonic clock reading, such as per 'time.Unix':
+	// they get one per their offset to the wall clock when returned - so wall clock steps between the send
+	// and the receive don't skew the round trip time.
+	ReceiveFrame(deadline time.Time) ([]byte, time.Time, error)
+	Close() error
+}
+
+// SocketFactory opens the 'FrameSocket' for interface 'iface' - see 'WithSocketFactory'
+type SocketFactory func(iface net.Interface) (FrameSocket, error)
+
+// factorySocket passes the frames to a 'FrameSocket' of a 'SocketFactory'
+type factorySocket struct {
+	FrameSocket
+}
+
+func (s factorySocket) sendFrame(frame []byte) (time.Time, error) {
+	sendTime, err := s.SendFrame(frame)
+	return monotonic(sendTime), err
+}
+
+func (s factorySocket) receiveFrame(deadline time.Time) ([]byte, time.Time, error) {
+	frame, receiveTime, err := s.ReceiveFrame(deadline)
+	return frame, monotonic(receiveTime), err
+}
+
+// wallClock returns the wall clock time without a monotonic clock reading - replaced in tests
+var wallClock = func() time.Time {
+	return time.Now().Round(0)
+}
+
+// monotonic returns 't' with a monotonic clock reading - per the offset of 't' to the current wall clock.
+// 't' is returned as is if it has one already, such as per 'time.Now'.
+func monotonic(t time.Time) time.Time {
+	if t.IsZero() || t != t.Round(0) {
+		return t
+	}
+	now := time.Now()
+	return now.Add(t.Sub(wallClock()))
+}
+
+// setSenderFilter is a no-op: the replies get matched to the requests anyway
+func (s factorySocket) setSenderFilter(ip net.IP) error {
+	return nil
+}
+
+func (s factorySocket) deinitialize() error {
+	return s.Close()
+}
+
+// arpSocket sends and receives arp datagrams over the platform socket
+type arpSocket struct {
+	frameSocket
+	// mutate gets every frame before it's sent - see 'WithFrameMutator'
+	mutate func(frame []byte) []byte
+	// inspect drops every received frame it returns false for - see 'WithFrameInspector'
+	inspect func(frame []byte) bool
+}
+
+func (s arpSocket) send(request arpDatagram) (time.Time, error) {
+	frame := request.MarshalWithEthernetHeader()
+	if s.mutate != nil {
+		frame = s.mutate(frame)
+	}
+	return s.sendFrame(frame)
+}
+
+func (s arpSocket) receive(deadline time.Time) (arpDatagram, time.Time, error) {
+	frame, receiveTime, err := s.receiveFrame(deadline)
+	for err == nil && s.inspect != nil && !s.inspect(frame) {
+		if !time.Now().Before(deadline) {
+			return arpDatagram{}, time.Now(), ErrTimeout
+		}
+		frame, receiveTime, err = s.receiveFrame(deadline)
+	}
+	if err != nil {
+		return arpDatagram{}, receiveTime, err
+	}
+	if len(frame) <= ethernetHeaderLen {
+		// amount of bytes read by socket is less than an ethernet header. clearly not what we look for
+		return arpDatagram{}, receiveTime, fmt.Errorf("%w: buffer with invalid length", ErrInvalidArp)
+	}
+	// skip the ethernet header
+	datagram, err := parseArpDatagram(frame[ethernetHeaderLen:])
+	if err == nil {
+		datagram.ethSrc = frame[6:12:12]
+	}
+	return datagram, receiveTime, err
+}
+
+func (s arpSocket) kernelDrops() (int, error) {
+	if counter, ok := s.frameSocket.(kernelDropCounter); ok {
+		return counter.kernelDrops()
+	}
+	return 0, nil
+}
+
+// pollInterval bounds a single receive call of background receivers - and so the latency to stop them
+const pollInterval = 100 * time.Millisecond
+
+// openFrameSocket opens the platform socket - or the socket of the 'SocketFactory' per 'WithSocketFactory'
+var openFrameSocket = func(iface net.Interface, cfg *config) (frameSocket, error) {
+	if cfg.socketFactory != nil {
+		sock, err := cfg.socketFactory(iface)
+		if err != nil {
+			return nil, err
+		}
+		return factorySocket{sock}, nil
+	}
+	sock, err := initialize(iface, cfg)
+	if err != nil {
+		return nil, privilegeError(err)
+	}
+	return sock, nil
+}
+
+// privilegeError wraps 'err' with 'ErrInsufficientPrivilege' if it's a permission error
+func privilegeError(err error) error {
+	if errors.Is(err, os.ErrPermission) {
+		return fmt.Errorf("%w: %w", ErrInsufficientPrivilege, err)
+	}
+	return err
+}
+
+// openSocket opens the platform socket for arp datagrams - replaced in tests
+var openSocket = func(iface net.Interface, cfg *config) (socket, error) {
+	sock, err := openFrameSocket(iface, cfg)
+	if err != nil {
+		return nil, err
+	}
+	var arpSock socket = arpSocket{frameSocket: sock, mutate: cfg.frameMutator, inspect: cfg.frameInspector}
+	if cfg.socketRetries > 0 && cfg.socketFD < 0 {
+		arpSock = &reopeningSocket{iface: iface, cfg: cfg, socket: arpSock}
+	}
+	return retryingSocket{&countingSocket{socket: arpSock}}, nil
+}
+
+// isRecoverable returns true for the socket errors, which a fresh socket may not run into again - such as
+// the exhausted buffers under memory pressure. Any other error is fatal.
+func isRecoverable(err error) bool {
+	return errors.Is(err, syscall.ENOBUFS) || errors.Is(err, syscall.ENOMEM)
+}
+
+// reopeningSocket reopens the platform socket on a recoverable error and retries the call - see 'WithSocketRetry'.
+// A call on a socket, which got replaced meanwhile by a concurrent call, is retried on the fresh one.
+type reopeningSocket struct {
+	iface net.Interface
+	cfg   *config
+
+	mu     sync.Mutex
+	socket socket
+	// generation counts the reopens - to tell a replaced socket
+	generation int
+	// senderFilter gets restored on the reopened socket
+	senderFilter net.IP
+}
+
+func (s *reopeningSocket) send(request arpDatagram) (time.Time, error) {
+	for attempt := 0; ; {
+		sock, generation := s.current()
+		sendTime, err := sock.send(request)
+		if err == nil {
+			return sendTime, nil
+		}
+		if s.replaced(generation) {
+			continue
+		}
+		if !isRecoverable(err) || attempt >= s.cfg.socketRetries {
+			return sendTime, err
+		}
+		attempt++
+		verboseLog.Printf("send failed: %s - reopen the socket and retry\n", err)
+		if err := s.reopen(generation); err != nil {
+			return sendTime, err
+		}
+	}
+}
+
+func (s *reopeningSocket) receive(deadline time.Time) (arpDatagram, time.Time, error) {
+	for attempt := 0; ; {
+		sock, generation := s.current()
+		response, receiveTime, err := sock.receive(deadline)
+		if err == nil || err == ErrTimeout {
+			return response, receiveTime, err
+		}
+		if s.replaced(generation) {
+			continue
+		}
+		if !isRecoverable(err) || attempt >= s.cfg.socketRetries {
+			return response, receiveTime, err
+		}
+		attempt++
+		verboseLog.Printf("receive failed: %s - reopen the socket and retry\n", err)
+		if err := s.reopen(generation); err != nil {
+			return response, receiveTime, err
+		}
+	}
+}
+
+func (s *reopeningSocket) setSenderFilter(ip net.IP) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.senderFilter = ip
+	return s.socket.setSenderFilter(ip)
+}
+
+func (s *reopeningSocket) deinitialize() error {
+	sock, _ := s.current()
+	return sock.deinitialize()
+}
+
+func (s *reopeningSocket) kernelDrops() (int, error) {
+	sock, _ := s.current()
+	if counter, ok := sock.(kernelDropCounter); ok {
+		return counter.kernelDrops()
+	}
+	return 0, nil
+}
+
+// current returns the current socket and its generation
+func (s *reopeningSocket) current() (socket, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.socket, s.generation
+}
+
+// replaced returns true if the socket of 'generation' got replaced meanwhile
+func (s *reopeningSocket) replaced(generation int) bool {
+	_, current := s.current()
+	return current != generation
+}
+
+// reopen replaces the failed socket of 'generation' with a fresh one of the same interface and configuration -
+// unless a concurrent call replaced it already. The failed socket stays in use if the reopen fails.
+func (s *reopeningSocket) reopen(generation int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.generation != generation {
+		return nil
+	}
+	sock, err := openFrameSocket(s.iface, s.cfg)
+	if err != nil {
+		return err
+	}
+	fresh := arpSocket{frameSocket: sock, mutate: s.cfg.frameMutator, inspect: s.cfg.frameInspector}
+	if s.senderFilter != nil {
+		if err := fresh.setSenderFilter(s.senderFilter); err != nil {
+			fresh.deinitialize()
+			return err
+		}
+	}
+	s.socket.deinitialize()
+	s.socket = fresh
+	s.generation++
+	return nil
+}
+
+// maxSendRetries bounds the retries of an interrupted send
+const maxSendRetries = 10
+
+// retryingSocket retries interrupted system calls (EINTR) - instead of failing the whole call on signal delivery.
+//
+// A receive gets also retried when it timed out before the deadline - such as per rounding of the socket timeout,
+// or when the received frame was malformed.
+type retryingSocket struct {
+	socket
+}
+
+func (s retryingSocket) send(request arpDatagram) (time.Time, error) {
+	for retries := 0; ; retries++ {
+		sendTime, err := s.socket.send(request)
+		if !errors.Is(err, syscall.EINTR) || retries >= maxSendRetries {
+			return sendTime, err
+		}
+		verboseLog.Println("send interrupted - retry")
+	}
+}
+
+func (s retryingSocket) receive(deadline time.Time) (arpDatagram, time.Time, error) {
+	for {
+		response, receiveTime, err := s.socket.receive(deadline)
+		if errors.Is(err, ErrInvalidArp) {
+			// a malformed frame mustn't stop the caller - such as a sniffer on a hostile network
+			verboseLog.Printf("ignore received frame: %s\n", err)
+			if time.Now().Before(deadline) {
+				continue
+			}
+			return arpDatagram{}, time.Now(), ErrTimeout
+		}
+		interrupted := errors.Is(err, syscall.EINTR)
+		if !interrupted && !(err == ErrTimeout && time.Now().Before(deadline)) {
+			return response, receiveTime, err
+		}
+		if !time.Now().Before(deadline) {
+			return arpDatagram{}, time.Now(), ErrTimeout
+		}
+		if interrupted {
+			verboseLog.Println("receive interrupted - retry")
+		}
+	}
+}
+
+func (s retryingSocket) stats() SocketStats {
+	return socketStatsOf(s.socket)
+}
+
+// kernelDropCounter is implemented by the platform sockets, which can read the drops of the kernel
+type kernelDropCounter interface {
+	// kernelDrops returns the number of frames, which the kernel dropped since the last call
+	kernelDrops() (int, error)
+}
+
+// countingSocket counts the sent and received frames - see 'SocketStats'
+type countingSocket struct {
+	socket
+
+	mu       sync.Mutex
+	counters SocketStats
+	closed   bool
+}
+
+func (s *countingSocket) send(request arpDatagram) (time.Time, error) {
+	sendTime, err := s.socket.send(request)
+	if err == nil {
+		s.mu.Lock()
+		s.counters.Sent++
+		s.mu.Unlock()
+	}
+	return sendTime, err
+}
+
+func (s *countingSocket) receive(deadline time.Time) (arpDatagram, time.Time, error) {
+	response, receiveTime, err := s.socket.receive(deadline)
+	if err == nil {
+		s.mu.Lock()
+		s.counters.Received++
+		s.mu.Unlock()
+	}
+	return response, receiveTime, err
+}
+
+func (s *countingSocket) deinitialize() error {
+	// the drops can't be read anymore after the close
+	s.stats()
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	return s.socket.deinitialize()
+}
+
+func (s *countingSocket) stats() SocketStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if counter, ok := s.socket.(kernelDropCounter); ok && !s.closed {
+		if drops, err := counter.kernelDrops(); err == nil {
+			s.counters.KernelDropped += drops
+		} else {
+			verboseLog.Printf("unable to read the kernel drops: %s\n", err)
+		}
+	}
+	return s.counters
+}
+
+// socketStatsOf returns the counters of 'sock' - zero if it doesn't count
+func socketStatsOf(sock socket) SocketStats {
+	if s, ok := sock.(interface{ stats() SocketStats }); ok {
+		return s.stats()
+	}
+	return SocketStats{}
+}
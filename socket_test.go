@@ -0,0 +1,307 @@
+package arping
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeSocket replaces the platform socket in tests.
+// 'respond' gets called for every sent request and returns the datagrams to receive.
+type fakeSocket struct {
+	respond func(request arpDatagram) []arpDatagram
+
+	mu           sync.Mutex
+	sent         []arpDatagram
+	queue        []arpDatagram
+	queued       chan struct{}
+	senderFilter net.IP
+	closed       bool
+	// sendErrs and receiveErrs are returned by the next calls - before sending / receiving anything
+	sendErrs    []error
+	receiveErrs []error
+	// sendDelay simulates the cost of a send system call
+	sendDelay time.Duration
+}
+
+func newFakeSocket(respond func(request arpDatagram) []arpDatagram) *fakeSocket {
+	return &fakeSocket{
+		respond: respond,
+		queued:  make(chan struct{}, 1),
+	}
+}
+
+func (s *fakeSocket) send(request arpDatagram) (time.Time, error) {
+	s.mu.Lock()
+	if len(s.sendErrs) > 0 {
+		err := s.sendErrs[0]
+		s.sendErrs = s.sendErrs[1:]
+		s.mu.Unlock()
+		return time.Now(), err
+	}
+	s.sent = append(s.sent, request)
+	s.mu.Unlock()
+
+	if s.sendDelay > 0 {
+		time.Sleep(s.sendDelay)
+	}
+
+	if s.respond != nil {
+		s.inject(s.respond(request)...)
+	}
+	return time.Now(), nil
+}
+
+// inject queues 'datagrams' to receive
+func (s *fakeSocket) inject(datagrams ...arpDatagram) {
+	s.mu.Lock()
+	s.queue = append(s.queue, datagrams...)
+	s.mu.Unlock()
+
+	select {
+	case s.queued <- struct{}{}:
+	default:
+	}
+}
+
+func (s *fakeSocket) receive(deadline time.Time) (arpDatagram, time.Time, error) {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	for {
+		s.mu.Lock()
+		if len(s.receiveErrs) > 0 {
+			err := s.receiveErrs[0]
+			s.receiveErrs = s.receiveErrs[1:]
+			s.mu.Unlock()
+			return arpDatagram{}, time.Now(), err
+		}
+		if len(s.queue) > 0 {
+			response := s.queue[0]
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+			return response, time.Now(), nil
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-s.queued:
+		case <-timer.C:
+			return arpDatagram{}, time.Now(), ErrTimeout
+		}
+	}
+}
+
+func (s *fakeSocket) setSenderFilter(ip net.IP) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.senderFilter = ip
+	return nil
+}
+
+func (s *fakeSocket) deinitialize() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *fakeSocket) sentDatagrams() []arpDatagram {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]arpDatagram(nil), s.sent...)
+}
+
+// useFakeSocket replaces the platform socket with 'sock' until the test ends
+func useFakeSocket(t testing.TB, sock *fakeSocket) {
+	t.Helper()
+
+	orig := openSocket
+	openSocket = func(iface net.Interface, cfg *config) (socket, error) {
+		return sock, nil
+	}
+	t.Cleanup(func() {
+		openSocket = orig
+	})
+}
+
+// newArpReply builds a reply from 'mac' for the given request
+func newArpReply(request arpDatagram, mac net.HardwareAddr) arpDatagram {
+	return arpDatagram{
+		htype: request.htype,
+		ptype: request.ptype,
+		hlen:  request.hlen,
+		plen:  request.plen,
+		oper:  responseOper,
+		sha:   mac,
+		spa:   request.tpa,
+		tha:   request.sha,
+		tpa:   request.spa,
+	}
+}
+
+// loopbackInterface returns the loopback interface
+func loopbackInterface(t testing.TB) net.Interface {
+	t.Helper()
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			return iface
+		}
+	}
+	t.Skip("no loopback interface found")
+	return net.Interface{}
+}
+
+func TestRetryingSocketRetriesEINTR(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	sock := newFakeSocket(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{newArpReply(request, mac)}
+	})
+	sock.sendErrs = []error{syscall.EINTR, syscall.EINTR}
+	sock.receiveErrs = []error{syscall.EINTR, ErrTimeout}
+
+	orig := openSocket
+	openSocket = func(iface net.Interface, cfg *config) (socket, error) {
+		return retryingSocket{sock}, nil
+	}
+	t.Cleanup(func() {
+		openSocket = orig
+	})
+
+	results, err := PingOverIface(net.ParseIP("127.0.0.2"), loopbackInterface(t), WithTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Errorf("one result expected, but got: %v", results)
+	}
+	if sent := sock.sentDatagrams(); len(sent) != 1 {
+		t.Errorf("one request expected, but sent: %d", len(sent))
+	}
+}
+
+func TestRetryingSocketGivesUpSend(t *testing.T) {
+	sock := newFakeSocket(nil)
+	for i := 0; i <= maxSendRetries; i++ {
+		sock.sendErrs = append(sock.sendErrs, syscall.EINTR)
+	}
+
+	if _, err := (retryingSocket{sock}).send(arpDatagram{}); err != syscall.EINTR {
+		t.Errorf("EINTR expected after %d retries, but got: %v", maxSendRetries, err)
+	}
+}
+
+// droppingSocket reports kernel drops per 'kernelDrops'
+type droppingSocket struct {
+	*fakeSocket
+	drops int
+}
+
+func (s *droppingSocket) kernelDrops() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	drops := s.drops
+	s.drops = 0
+	return drops, nil
+}
+
+func TestSocketStats(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	sock := &droppingSocket{fakeSocket: newFakeSocket(func(request arpDatagram) []arpDatagram {
+		if request.TargetIP().Equal(net.ParseIP("127.0.0.3")) {
+			return nil
+		}
+		return []arpDatagram{newArpReply(request, mac), newArpReply(request, mac)}
+	}), drops: 2}
+
+	orig := openSocket
+	openSocket = func(iface net.Interface, cfg *config) (socket, error) {
+		return retryingSocket{&countingSocket{socket: sock}}, nil
+	}
+	t.Cleanup(func() {
+		openSocket = orig
+	})
+
+	var stats Stats
+	dstIPs := []net.IP{net.ParseIP("127.0.0.2"), net.ParseIP("127.0.0.3"), net.ParseIP("127.0.0.4")}
+	if _, err := PingManyOverIfaceContext(context.Background(), dstIPs, loopbackInterface(t),
+		WithTimeout(20*time.Millisecond), WithStats(&stats)); err != nil {
+		t.Fatal(err)
+	}
+	if want := (SocketStats{Sent: 3, Received: 4, KernelDropped: 2}); stats.Socket != want {
+		t.Errorf("socket stats %+v expected, but got: %+v", want, stats.Socket)
+	}
+}
+
+func TestPrivilegeError(t *testing.T) {
+	for _, errno := range []syscall.Errno{syscall.EPERM, syscall.EACCES} {
+		bindErr := fmt.Errorf("unable to bind socket to interface 'eth0': %w", errno)
+		for _, err := range []error{errno, bindErr} {
+			mapped := privilegeError(err)
+			if !errors.Is(mapped, ErrInsufficientPrivilege) || !errors.Is(mapped, errno) {
+				t.Errorf("'%v' expected to be mapped to an insufficient privilege, but got: %v", err, mapped)
+			}
+		}
+	}
+
+	if err := privilegeError(syscall.ENODEV); errors.Is(err, ErrInsufficientPrivilege) {
+		t.Errorf("ENODEV expected to be passed as is, but got: %v", err)
+	}
+}
+
+func TestWithSocketRetry(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	sock := newFakeSocket(func(request arpDatagram) []arpDatagram {
+		return []arpDatagram{newArpReply(request, mac)}
+	})
+	opened := useFakeFrameSocket(t, sock)
+	iface, dstIP := loopbackInterface(t), net.ParseIP("127.0.0.2")
+	// the frames of the loopback interface have no source mac to parse
+	timeout, srcMac := WithTimeout(50*time.Millisecond), WithSourceMAC(net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x0a})
+
+	sock.sendErrs = []error{syscall.ENOBUFS}
+	if _, err := PingOverIface(dstIP, iface, timeout, srcMac); !errors.Is(err, syscall.ENOBUFS) {
+		t.Errorf("ENOBUFS expected without 'WithSocketRetry', but got: %v", err)
+	}
+
+	*opened = 0
+	sock.sendErrs = []error{syscall.ENOBUFS}
+	results, err := PingOverIface(dstIP, iface, timeout, srcMac, WithSocketRetry(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].HwAddr.String() != mac.String() {
+		t.Errorf("reply from %s expected, but got: %v", mac, results)
+	}
+	if *opened != 2 {
+		t.Errorf("socket expected to be reopened once, but opened: %d", *opened)
+	}
+
+	*opened = 0
+	sock.sendErrs = []error{syscall.ENOBUFS, syscall.ENOBUFS, syscall.ENOBUFS}
+	if _, err := PingOverIface(dstIP, iface, timeout, srcMac, WithSocketRetry(2)); !errors.Is(err, syscall.ENOBUFS) {
+		t.Errorf("ENOBUFS expected after 2 retries, but got: %v", err)
+	}
+	if *opened != 3 {
+		t.Errorf("socket expected to be reopened twice, but opened: %d", *opened)
+	}
+
+	*opened = 0
+	sock.sendErrs = []error{syscall.ENODEV}
+	if _, err := PingOverIface(dstIP, iface, timeout, srcMac, WithSocketRetry(2)); !errors.Is(err, syscall.ENODEV) {
+		t.Errorf("fatal ENODEV expected, but got: %v", err)
+	}
+	if *opened != 1 {
+		t.Errorf("socket expected not to be reopened on a fatal error, but opened: %d", *opened)
+	}
+}
@@ -0,0 +1,94 @@
+package arping
+
+import (
+	"math"
+	"time"
+)
+
+// Stats holds the statistics of a single call - see 'WithStats'
+type Stats struct {
+	// Replies counts all accepted replies - including the ones not stored per 'WithMaxResults'
+	Replies int
+
+	// the following are only filled by the repeated probes of 'PingN'
+
+	// Sent counts the sent probes
+	Sent int
+	// Lost counts the probes without any attributed reply
+	Lost int
+	// Reordered counts the replies, which were attributed to an earlier probe than the latest one
+	// - because the latest probe was already answered, but an earlier one not
+	Reordered int
+	// Duplicated counts the replies to already answered probes
+	Duplicated int
+
+	// Late counts the replies discarded as older than the max age per 'WithMaxReplyAge'
+	// - only filled by the pings and 'PingN'
+	Late int
+
+	// Dropped counts the frames dropped per 'WithFrameRateLimit' - only filled by 'Sniff',
+	// and the replies dropped by 'Discovery', see 'Discovery.Stats'
+	Dropped int
+
+	// Ignored counts the received arp frames, which aren't a reply to the request - such as the requests
+	// of other hosts. Filled by the pings, 'PingN' and the scans.
+	Ignored int
+
+	// Jitter is the standard deviation of the round trip times of all replies - including the ones not stored.
+	// Only filled by the pings and 'PingN' - zero with less than two replies.
+	Jitter time.Duration
+
+	// FirstReplyLatency is the wall-clock time from the start of the call until the first accepted reply
+	// - including the socket setup, unlike the round trip time per 'Result.Duration'.
+	// Only filled by the pings, 'PingSync' and 'PingN' - zero without reply.
+	FirstReplyLatency time.Duration
+
+	// Socket holds the frame counters of the socket - filled by the pings, 'PingN', the scans and 'Sniff'
+	Socket SocketStats
+}
+
+// SocketStats holds the frame counters of a socket - to tell whether missing replies got lost on the link,
+// or already in our kernel.
+type SocketStats struct {
+	// Sent counts the sent frames
+	Sent int
+	// Received counts the received arp frames - including the ones which weren't accepted as reply
+	Received int
+	// KernelDropped counts the frames, which the kernel dropped as the receive buffer was full.
+	// Read per PACKET_STATISTICS under linux, and per BIOCGSTATS under BSD - counted since the socket was opened.
+	KernelDropped int
+}
+
+// add adds the counters of 'other' - such as of further sockets
+func (s *SocketStats) add(other SocketStats) {
+	s.Sent += other.Sent
+	s.Received += other.Received
+	s.KernelDropped += other.KernelDropped
+}
+
+// firstReply records the latency of a reply received at 'receiveTime' by a call started at 'start'
+// - only the first one counts, see 'FirstReplyLatency'
+func (s *Stats) firstReply(start, receiveTime time.Time) {
+	if s.FirstReplyLatency == 0 {
+		s.FirstReplyLatency = receiveTime.Sub(start)
+	}
+}
+
+// jitter returns the standard deviation of 'durations' - zero with less than two
+func jitter(durations []time.Duration) time.Duration {
+	if len(durations) < 2 {
+		return 0
+	}
+	var mean float64
+	for _, d := range durations {
+		mean += float64(d)
+	}
+	mean /= float64(len(durations))
+
+	var variance float64
+	for _, d := range durations {
+		variance += (float64(d) - mean) * (float64(d) - mean)
+	}
+	variance /= float64(len(durations))
+	return time.Duration(math.Sqrt(variance))
+}
@@ -0,0 +1,25 @@
+package arping
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJitter(t *testing.T) {
+	tests := []struct {
+		durations []time.Duration
+		expected  time.Duration
+	}{
+		{nil, 0},
+		{[]time.Duration{time.Millisecond}, 0},
+		{[]time.Duration{time.Millisecond, time.Millisecond}, 0},
+		{[]time.Duration{time.Millisecond, 3 * time.Millisecond}, time.Millisecond},
+		{[]time.Duration{2 * time.Millisecond, 4 * time.Millisecond, 4 * time.Millisecond, 4 * time.Millisecond,
+			5 * time.Millisecond, 5 * time.Millisecond, 7 * time.Millisecond, 9 * time.Millisecond}, 2 * time.Millisecond},
+	}
+	for _, test := range tests {
+		if jitter := jitter(test.durations); jitter != test.expected {
+			t.Errorf("jitter of %v: %s expected, but got: %s", test.durations, test.expected, jitter)
+		}
+	}
+}